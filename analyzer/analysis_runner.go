@@ -10,24 +10,34 @@ import (
 )
 
 // Analyze a function, recursively handling any anonymous functions
-// within it's body
+// within it's body. Functions annotated @no_analysis are skipped along with
+// the anonymous functions they contain, as are the methods of user-defined
+// lock types.
 func analyzeFunction(
 	fn *ssa.Function,
 	registry *ir.ContractRegistry,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	strictMode bool,
 ) {
 	if fn == nil || len(fn.Blocks) == 0 {
 		return
 	}
+	if contract := contractForFunction(fn, registry); contract != nil && contract.NoAnalysis {
+		return
+	}
+	// Lock methods implement the lock; their callers are checked instead.
+	if op, _ := functionLockOperation(fn, scope); op != noLockOperation {
+		return
+	}
 
-	functionDepthFirstSearch(fn, registry, reporter, fset, recursion, strictMode)
+	functionDepthFirstSearch(fn, registry, reporter, fset, recursion, scope, strictMode)
 
 	// Recurse through any anonymous functions
 	for _, anon := range fn.AnonFuncs {
-		analyzeFunction(anon, registry, reporter, fset, recursion, strictMode)
+		analyzeFunction(anon, registry, reporter, fset, recursion, scope, strictMode)
 	}
 }
 
@@ -41,6 +51,7 @@ func findMethodsForType(
 	reporter *report.Reporter,
 	fset *token.FileSet,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	strictMode bool,
 ) {
 	// Check methods/interface implementing a type
@@ -49,7 +60,7 @@ func findMethodsForType(
 		selection := methodSet.At(i)
 		fn := pkg.Prog.MethodValue(selection)
 		if fn != nil && fn.Pkg == pkg {
-			analyzeFunction(fn, registry, reporter, fset, recursion, strictMode)
+			analyzeFunction(fn, registry, reporter, fset, recursion, scope, strictMode)
 		}
 	}
 
@@ -57,28 +68,85 @@ func findMethodsForType(
 	ptrMset := pkg.Prog.MethodSets.MethodSet(types.NewPointer(t))
 	for i := range ptrMset.Len() {
 		if fn := pkg.Prog.MethodValue(ptrMset.At(i)); fn != nil && fn.Pkg == pkg {
-			analyzeFunction(fn, registry, reporter, fset, recursion, strictMode)
+			analyzeFunction(fn, registry, reporter, fset, recursion, scope, strictMode)
 		}
 	}
 }
 
 func Run(pkg *ssa.Package, registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet, strictMode bool) {
-	recursion := buildRecursionGraph(pkg)
+	scope := newPackageScope(registry)
+	scope.goroutineWaits = collectGoroutineChannelWaits(pkg, scope)
+	recursion := buildRecursionGraph(pkg, scope)
 
+	reportDeclaredLockOrderCycles(registry, reporter, fset)
+	analyzePackageMembers(pkg, registry, reporter, fset, recursion, scope, strictMode)
+	detectPackageWideDeadlocks(pkg, registry, scope, reporter, fset, strictMode)
+}
+
+// RunProgram analyzes pkgs, all built from one SSA program, as a whole:
+// a single call graph and lock-order graph span every package, so lock
+// orders and goroutines are related across package boundaries.
+func RunProgram(pkgs []*ssa.Package, registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet, strictMode bool) {
+	scoped := make([]*ssa.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		if pkg != nil {
+			scoped = append(scoped, pkg)
+		}
+	}
+	if len(scoped) == 0 {
+		return
+	}
+
+	// Package-scoped helpers see the whole program from any package of it.
+	scope := newProgramScope(scoped, registry)
+	scope.goroutineWaits = collectGoroutineChannelWaits(scoped[0], scope)
+	recursion := buildRecursionGraph(scoped[0], scope)
+	reportDeclaredLockOrderCycles(registry, reporter, fset)
+	for _, pkg := range scoped {
+		analyzePackageMembers(pkg, registry, reporter, fset, recursion, scope, strictMode)
+	}
+	detectPackageWideDeadlocks(scoped[0], registry, scope, reporter, fset, strictMode)
+}
+
+func analyzePackageMembers(
+	pkg *ssa.Package,
+	registry *ir.ContractRegistry,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	recursion *recursionGraph,
+	scope *analysisScope,
+	strictMode bool,
+) {
 	for _, member := range pkg.Members {
 		switch n := member.(type) {
 		case *ssa.Function:
-			analyzeFunction(n, registry, reporter, fset, recursion, strictMode)
+			analyzeFunction(n, registry, reporter, fset, recursion, scope, strictMode)
 		case *ssa.Type:
 			// Check if the type has any methods
 			// This appears when using an interface
-			findMethodsForType(pkg, n.Type(), registry, reporter, fset, recursion, strictMode)
+			findMethodsForType(pkg, n.Type(), registry, reporter, fset, recursion, scope, strictMode)
 		}
 	}
+}
 
+func detectPackageWideDeadlocks(
+	pkg *ssa.Package,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	strictMode bool,
+) {
 	if strictMode {
 		// Strict mode also checks lock-order inversions across goroutine launches
 		// that occur in different functions throughout the package.
-		detectPackageWideGoroutineLockOrderInversions(pkg, registry, reporter, fset)
+		detectPackageWideGoroutineLockOrderInversions(pkg, registry, scope, reporter, fset)
+		detectPackageWideGoroutineRWRDeadlocks(pkg, registry, scope, reporter, fset)
 	}
+
+	// Cycles of three or more locks, which pairwise comparison misses.
+	detectLockOrderCycles(pkg, registry, scope, reporter, fset, strictMode)
+
+	// Goroutines blocked on each other through both locks and channels.
+	detectLockChannelCycles(pkg, reporter, fset, scope)
 }
@@ -19,6 +19,8 @@ type lockUsageEvidence struct {
 func detectLikelyMissingLockAnnotations(
 	fn *ssa.Function,
 	contract *ir.FunctionContract,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
@@ -32,7 +34,8 @@ func detectLikelyMissingLockAnnotations(
 		return
 	}
 
-	evidenceByLock := collectLockUsageEvidence(fn)
+	evidenceByLock := collectLockUsageEvidence(fn, scope)
+	addConditionalLockEvidence(fn, registry, scope, evidenceByLock)
 	if len(evidenceByLock) == 0 {
 		return
 	}
@@ -40,10 +43,13 @@ func detectLikelyMissingLockAnnotations(
 	kind, lockObj, ok := firstLikelyMissingAnnotation(
 		evidenceByLock,
 		func(lockObj types.Object) bool {
-			return lockCoveredByContract(fn, contract, ir.Acquires, lockObj)
+			return lockCoveredByContract(fn, contract, ir.Acquires, lockObj) ||
+				lockCoveredByContract(fn, contract, ir.Excludes, lockObj)
 		},
 		func(lockObj types.Object) bool {
-			return lockCoveredByContract(fn, contract, ir.Requires, lockObj)
+			return lockCoveredByContract(fn, contract, ir.Requires, lockObj) ||
+				lockCoveredByContract(fn, contract, ir.RequiresShared, lockObj) ||
+				lockCoveredByContract(fn, contract, ir.Releases, lockObj)
 		},
 	)
 	if !ok {
@@ -167,7 +173,7 @@ func requirementTargetCoversLock(fn *ssa.Function, target string, lockObj types.
 		return false
 	}
 
-	resolved := resolveObjectInScope(fn, target)
+	resolved := resolveLockKeyInScope(fn, target).Obj
 	if resolved == nil {
 		return false
 	}
@@ -235,14 +241,14 @@ func lastTargetSegment(target string) string {
 	return target[idx+1:]
 }
 
-func collectLockUsageEvidence(fn *ssa.Function) map[types.Object]lockUsageEvidence {
+func collectLockUsageEvidence(fn *ssa.Function, scope *analysisScope) map[types.Object]lockUsageEvidence {
 	evidenceByLock := make(map[types.Object]lockUsageEvidence)
 
 	for _, block := range fn.Blocks {
 		for _, instr := range block.Instrs {
 			switch msg := instr.(type) {
 			case *ssa.Call:
-				if isLockCall(msg) {
+				if isLockCall(msg, scope) {
 					obj := getLockObject(msg)
 					if obj == nil {
 						continue
@@ -257,7 +263,7 @@ func collectLockUsageEvidence(fn *ssa.Function) map[types.Object]lockUsageEviden
 					continue
 				}
 
-				if isUnlockCall(msg) {
+				if isUnlockCall(msg, scope) {
 					obj := getLockObject(msg)
 					if obj == nil {
 						continue
@@ -271,7 +277,7 @@ func collectLockUsageEvidence(fn *ssa.Function) map[types.Object]lockUsageEviden
 					evidenceByLock[obj] = ev
 				}
 			case *ssa.Defer:
-				if !isUnlockCallCommon(&msg.Call) {
+				if !isUnlockCallCommon(&msg.Call, scope) {
 					continue
 				}
 
@@ -292,3 +298,27 @@ func collectLockUsageEvidence(fn *ssa.Function) map[types.Object]lockUsageEviden
 
 	return evidenceByLock
 }
+
+// Count TryLock calls, and calls to functions annotated @returns_if, as lock
+// calls: a function that unlocks what they acquired manages the lock itself.
+func addConditionalLockEvidence(fn *ssa.Function, registry *ir.ContractRegistry, scope *analysisScope, evidenceByLock map[types.Object]lockUsageEvidence) {
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+
+			for _, locks := range conditionallyAcquiredLocks(call, registry, scope) {
+				for key := range locks {
+					ev := evidenceByLock[key.Obj]
+					if ev.firstPos == token.NoPos || call.Pos() < ev.firstPos {
+						ev.firstPos = call.Pos()
+					}
+					ev.lockCalls++
+					evidenceByLock[key.Obj] = ev
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"go/token"
+	"gotsan/ir"
+	"gotsan/utils/report"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Blocking while holding a lock keeps every goroutine that needs the lock
+// waiting for as long as the operation blocks. Sends, receives and selects
+// without a default block until a goroutine is ready at the other end of
+// the channel; the registry's blocking functions block on timers, other
+// goroutines, the network or child processes.
+
+// Check an instruction executed while state holds locks. A channel
+// operation is a deadlock when a goroutine launched in the package has to
+// acquire one of the held locks before it gets to the other end of the
+// channel.
+func checkBlockingOperation(
+	fn *ssa.Function,
+	instr ssa.Instruction,
+	state *AnalysisState,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if len(state.HeldLocks) == 0 {
+		return
+	}
+
+	if ops := blockingChannelOps(instr); len(ops) > 0 {
+		if deadlock, ok := findLockChannelDeadlock(ops, state.HeldLocks, scope); ok {
+			reportLockChannelDeadlock(fn, instr, deadlock, reporter, fset)
+			return
+		}
+		reportBlockingUnderLock(fn, instr, describeChannelOps(ops), state.HeldLocks, reporter, fset)
+		return
+	}
+
+	call, ok := instr.(*ssa.Call)
+	if !ok {
+		return
+	}
+	if name := blockingFunctionName(&call.Call, registry); name != "" {
+		reportBlockingUnderLock(fn, instr, "calls "+name, state.HeldLocks, reporter, fset)
+	}
+}
+
+// The name of the function a call calls, if the registry lists it as
+// blocking: its SSA name, or the interface method's for a dynamic call.
+func blockingFunctionName(common *ssa.CallCommon, registry *ir.ContractRegistry) string {
+	name := ""
+	if common.IsInvoke() {
+		name = common.Method.FullName()
+	} else if callee := common.StaticCallee(); callee != nil {
+		name = callee.String()
+	}
+
+	if !registry.IsBlockingFunction(name) {
+		return ""
+	}
+	return name
+}
+
+func describeChannelOps(ops []channelOp) string {
+	if len(ops) == 1 {
+		return ops[0].Dir.verb() + " " + channelDisplayName(ops[0].Chan)
+	}
+
+	names := make([]string, 0, len(ops))
+	for _, op := range ops {
+		names = append(names, channelDisplayName(op.Chan))
+	}
+	return "selects on " + strings.Join(names, ", ")
+}
+
+// A goroutine a held lock keeps from the other end of a channel operation.
+type lockChannelDeadlock struct {
+	Lock string
+	Op   channelOp
+	Wait goroutineChannelWait
+}
+
+// Find, for every operation an instruction may proceed with, a goroutine
+// launched in the run's packages that may acquire a lock in held, in a
+// conflicting mode, before the complementary operation on the same channel.
+// The first operation's is returned.
+func findLockChannelDeadlock(ops []channelOp, held LockSet, scope *analysisScope) (lockChannelDeadlock, bool) {
+	if len(ops) == 0 || len(scope.goroutineWaits) == 0 {
+		return lockChannelDeadlock{}, false
+	}
+
+	var first lockChannelDeadlock
+	for i, op := range ops {
+		deadlock, ok := blockedCounterpart(op, held, scope.goroutineWaits, scope)
+		if !ok {
+			return lockChannelDeadlock{}, false
+		}
+		if i == 0 {
+			first = deadlock
+		}
+	}
+	return first, true
+}
+
+func blockedCounterpart(op channelOp, held LockSet, waits []goroutineChannelWait, scope *analysisScope) (lockChannelDeadlock, bool) {
+	origins := channelOrigins(op.Chan, scope)
+	for _, wait := range waits {
+		if wait.Dir != op.Dir.complement() || !channelsMayAlias(origins, channelOrigins(wait.Chan, scope)) {
+			continue
+		}
+
+		lock := ""
+		for heldKey, heldMode := range held {
+			for key, mode := range wait.Before {
+				name := heldKey.QualifiedName()
+				if acquireConflicts(heldModeEquivalent(LockSet{heldKey: heldMode}, key), mode) && (lock == "" || name < lock) {
+					lock = name
+				}
+			}
+		}
+		if lock != "" {
+			return lockChannelDeadlock{Lock: lock, Op: op, Wait: wait}, true
+		}
+	}
+	return lockChannelDeadlock{}, false
+}
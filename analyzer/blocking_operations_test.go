@@ -0,0 +1,153 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"gotsan/ir"
+	"gotsan/utils/report"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+const blockingFixturePkgPath = "gotsan/tests/testdata/blocking"
+
+func buildBlockingFixture(t *testing.T) (*ssa.Package, *ir.ContractRegistry, *token.FileSet) {
+	t.Helper()
+	ssaPkgs, registry, fset := buildFixturePackages(t, "blocking", 1)
+	return ssaPkgs[0], registry, fset
+}
+
+// The first call in fn whose callee, or invoked method, has the given name.
+func findCallTo(t *testing.T, fn *ssa.Function, name string) *ssa.Call {
+	t.Helper()
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+			if call.Call.IsInvoke() && call.Call.Method.Name() == name {
+				return call
+			}
+			if callee := call.Call.StaticCallee(); callee != nil && callee.Name() == name {
+				return call
+			}
+		}
+	}
+	t.Fatalf("no call to %s in %s", name, fn.Name())
+	return nil
+}
+
+// The blocking-under-lock advisories, by the function they were reported in.
+func blockingAdvisories(reporter *report.Reporter) map[string]string {
+	advisories := make(map[string]string)
+	for _, d := range reporter.Warnings {
+		if d.Rule == report.RuleBlockingUnderLock {
+			advisories[d.Functions[0]] = d.Message
+		}
+	}
+	return advisories
+}
+
+func TestRun_ReportsBlockingUnderLock(t *testing.T) {
+	pkg, registry, fset := buildBlockingFixture(t)
+	registry.AddBlockingFunctions(blockingFixturePkgPath + ".flush")
+
+	reporter := report.NewReporter()
+	Run(pkg, registry, reporter, fset, true)
+
+	want := map[string]string{
+		"Sleeps":  "calls time.Sleep",
+		"Waits":   "calls (*sync.WaitGroup).Wait",
+		"Dials":   "calls net.Dial",
+		"Reads":   "calls (net.Conn).Read",
+		"Selects": "selects on ready, quit",
+		"Flushes": "calls " + blockingFixturePkgPath + ".flush",
+	}
+	got := blockingAdvisories(reporter)
+	for fn, operation := range want {
+		if !strings.Contains(got[fn], "function "+fn+" "+operation+" while holding lock(s) mu") {
+			t.Errorf("expected %s to be reported for %s, got %q", fn, operation, got[fn])
+		}
+	}
+	for _, fn := range []string{"SleepsUnlocked", "SelectsWithDefault"} {
+		if msg, ok := got[fn]; ok {
+			t.Errorf("%s does not block while holding a lock, got %q", fn, msg)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d advisories, got %v", len(want), got)
+	}
+
+	for _, d := range reporter.Findings {
+		if d.Rule == report.RuleLockChannelDeadlock {
+			t.Errorf("no goroutine is at the other end of the channels, got %s", d.Message)
+		}
+	}
+}
+
+func TestRun_BlockingFunctionsDefaultToKnownList(t *testing.T) {
+	pkg, registry, fset := buildBlockingFixture(t)
+
+	reporter := report.NewReporter()
+	Run(pkg, registry, reporter, fset, true)
+
+	got := blockingAdvisories(reporter)
+	if msg, ok := got["Flushes"]; ok {
+		t.Fatalf("flush is only blocking when listed, got %q", msg)
+	}
+	if _, ok := got["Sleeps"]; !ok {
+		t.Fatal("expected time.Sleep to be blocking by default")
+	}
+}
+
+func TestBlockingFunctionName(t *testing.T) {
+	pkg, registry, _ := buildBlockingFixture(t)
+	fn := func(name string) *ssa.Function {
+		f, ok := pkg.Members[name].(*ssa.Function)
+		if !ok {
+			t.Fatalf("expected function %s in the fixture", name)
+		}
+		return f
+	}
+
+	if got := blockingFunctionName(&findCallTo(t, fn("Sleeps"), "Sleep").Call, registry); got != "time.Sleep" {
+		t.Errorf("expected time.Sleep, got %q", got)
+	}
+	if got := blockingFunctionName(&findCallTo(t, fn("Reads"), "Read").Call, registry); got != "(net.Conn).Read" {
+		t.Errorf("expected the interface method (net.Conn).Read, got %q", got)
+	}
+
+	flush := &findCallTo(t, fn("Flushes"), "flush").Call
+	if got := blockingFunctionName(flush, registry); got != "" {
+		t.Errorf("flush is not listed as blocking, got %q", got)
+	}
+	registry.AddBlockingFunctions(blockingFixturePkgPath + ".flush")
+	if got := blockingFunctionName(flush, registry); got != blockingFixturePkgPath+".flush" {
+		t.Errorf("expected the listed flush to be blocking, got %q", got)
+	}
+}
+
+func TestCheckBlockingOperationNeedsHeldLock(t *testing.T) {
+	pkg, registry, fset := buildBlockingFixture(t)
+	fn := pkg.Members["SleepsUnlocked"].(*ssa.Function)
+	sleep := findCallTo(t, fn, "Sleep")
+	scope := newPackageScope(registry)
+
+	state := newAnalysisState(LockSet{})
+	reporter := report.NewReporter()
+	checkBlockingOperation(fn, sleep, &state, registry, scope, reporter, fset)
+	if len(reporter.Warnings) != 0 {
+		t.Fatalf("sleeping without a lock is fine, got %v", reporter.Warnings)
+	}
+
+	mu := lockKey{Obj: types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])}
+	state = newAnalysisState(LockSet{mu: LockExclusive})
+	checkBlockingOperation(fn, sleep, &state, registry, scope, reporter, fset)
+	if len(reporter.Warnings) != 1 || reporter.Warnings[0].Rule != report.RuleBlockingUnderLock {
+		t.Fatalf("expected one blocking-under-lock advisory, got %v", reporter.Warnings)
+	}
+}
@@ -39,6 +39,7 @@ func functionDepthFirstSearch(
 	reporter *report.Reporter,
 	fset *token.FileSet,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	strictMode bool,
 ) {
 	if len(fn.Blocks) == 0 {
@@ -47,26 +48,32 @@ func functionDepthFirstSearch(
 
 	// Setup initial state
 	contract := contractForFunction(fn, registry)
-	initialLockset := createInitialLockset(fn, contract, reporter, fset)
+	initialLockset := createInitialLockset(fn, contract, reporter, fset, scope)
+	checkExcludesContradictions(fn, contract, reporter, fset)
 
 	logger.Debugf("Function being analyzed: %s %v", fn.Name(), contract)
 
 	// Heuristic hints for likely missing lock annotations.
-	detectLikelyMissingLockAnnotations(fn, contract, reporter, fset)
+	detectLikelyMissingLockAnnotations(fn, contract, registry, scope, reporter, fset)
 
 	// Detect lock-order inversions across goroutines launched in this function.
 	// This is always run in both lenient and strict modes.
-	detectGoroutineLockOrderInversions(fn, registry, reporter, fset)
+	detectGoroutineLockOrderInversions(fn, registry, scope, reporter, fset)
+	detectGoroutineRWRDeadlocks(fn, registry, scope, reporter, fset)
 
 	// In strict mode, also detect lock-order inversions within single-threaded execution
 	if strictMode {
-		detectSingleThreadedLockOrderInversions(fn, registry, reporter, fset)
+		detectSingleThreadedLockOrderInversions(fn, registry, scope, reporter, fset)
 	}
 
 	// Begin DFS through function
 	entry := fn.Blocks[0]
+	initialState := newAnalysisState(initialLockset)
+	if explainEnabled(reporter) {
+		recordEntryStep(fn, &initialState)
+	}
 	blockEntryStates := map[int]AnalysisState{
-		entry.Index: newAnalysisState(initialLockset),
+		entry.Index: initialState,
 	}
 
 	worklist := newBlockWorklist(entry)
@@ -77,15 +84,30 @@ func functionDepthFirstSearch(
 		entryState := blockEntryStates[curr.Index]
 		currentState := entryState.Copy()
 
-		analyzeInstructions(fn, curr.Instrs, contract, &currentState, registry, recursion, reporter, fset)
+		analyzeInstructions(fn, curr.Instrs, contract, &currentState, registry, recursion, scope, reporter, fset)
+		currentState.MayHeldSources.Record(curr, currentState.HeldLocks, currentState.MayHeldLocks, currentState.Trace)
 		if logger.IsVerbose() {
-			utils.PrintSSABlock(curr)
+			utils.PrintSSABlock(logger.Writer(), curr)
 		}
 
-		for _, succ := range curr.Succs {
+		// A TryLock, or a call annotated @returns_if, the block branches on
+		// holds its locks on one branch only.
+		branchLocks := branchAcquiredLocks(curr, registry, scope)
+		for i, succ := range curr.Succs {
+			succState := currentState
+			if explainEnabled(reporter) || branchLocks != nil {
+				succState = currentState.Copy()
+			}
+			if explainEnabled(reporter) {
+				recordBranchStep(curr, i, &succState)
+			}
+			if branchLocks != nil {
+				acquireOnBranch(curr, branchLocks[i], &succState, explainEnabled(reporter))
+			}
+
 			updateSuccessorState(
 				succ,
-				currentState,
+				succState,
 				blockEntryStates,
 				worklist,
 			)
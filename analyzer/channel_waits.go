@@ -0,0 +1,406 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Channel operations as waits: a goroutine blocked sending on a channel
+// waits for a goroutine to receive from it, and one blocked receiving waits
+// for a sender. Channels are related through the values they may have been
+// made by (see channelOrigins).
+
+type channelDirection int
+
+const (
+	channelSend channelDirection = iota
+	channelReceive
+)
+
+// The operation at the other end of a channel.
+func (d channelDirection) complement() channelDirection {
+	if d == channelSend {
+		return channelReceive
+	}
+	return channelSend
+}
+
+func (d channelDirection) verb() string {
+	if d == channelSend {
+		return "sends on"
+	}
+	return "receives from"
+}
+
+type channelOp struct {
+	Dir  channelDirection
+	Chan ssa.Value
+}
+
+// The channel operations instr may block on: a send, a receive, or the
+// cases of a select without a default, any of which lets it proceed.
+func blockingChannelOps(instr ssa.Instruction) []channelOp {
+	switch instr := instr.(type) {
+	case *ssa.Send:
+		return []channelOp{{Dir: channelSend, Chan: instr.Chan}}
+	case *ssa.UnOp:
+		if instr.Op == token.ARROW {
+			return []channelOp{{Dir: channelReceive, Chan: instr.X}}
+		}
+	case *ssa.Select:
+		if !instr.Blocking {
+			return nil
+		}
+		ops := make([]channelOp, 0, len(instr.States))
+		for _, state := range instr.States {
+			dir := channelReceive
+			if state.Dir == types.SendOnly {
+				dir = channelSend
+			}
+			ops = append(ops, channelOp{Dir: dir, Chan: state.Chan})
+		}
+		return ops
+	}
+	return nil
+}
+
+// A channel operation a function may block on, with the locks it may have
+// acquired on the way there, whether or not it released them since: a
+// goroutine that waits for one of them never gets to the operation.
+type channelWait struct {
+	channelOp
+	Before LockSet
+	// The operation, in whichever function performs it.
+	Instr ssa.Instruction
+}
+
+// The channel operations fn and the callees it shares the analysis scope
+// with may block on. Locks are expressed in fn's frame; channel values stay
+// in the frame of the function that uses them.
+func collectChannelWaits(fn *ssa.Function, active map[*ssa.Function]bool, scope *analysisScope) []channelWait {
+	if fn == nil || len(fn.Blocks) == 0 || active[fn] {
+		return nil
+	}
+	active[fn] = true
+	defer delete(active, fn)
+
+	entry := mayAcquiredAtBlockEntry(fn, scope)
+	waits := make([]channelWait, 0)
+	for _, block := range fn.Blocks {
+		acquired := entry[block.Index].Copy()
+		for _, instr := range block.Instrs {
+			for _, op := range blockingChannelOps(instr) {
+				waits = append(waits, channelWait{channelOp: op, Before: acquired.Copy(), Instr: instr})
+			}
+
+			if call, ok := instr.(*ssa.Call); ok {
+				if callee := call.Call.StaticCallee(); callee != nil && sharesAnalysisScope(fn, callee, scope) {
+					for _, nested := range collectChannelWaits(callee, active, scope) {
+						before := acquired.Copy()
+						mergeLockSet(before, translateLockSet(nested.Before, callee, &call.Call))
+						nested.Before = before
+						waits = append(waits, nested)
+					}
+				}
+			}
+
+			mergeLockSet(acquired, locksAcquiredBy(instr, scope))
+		}
+	}
+	return waits
+}
+
+// The locks fn may have acquired on some path to the start of each block,
+// by block index. Releases are ignored.
+func mayAcquiredAtBlockEntry(fn *ssa.Function, scope *analysisScope) []LockSet {
+	acquiredIn := make([]LockSet, len(fn.Blocks))
+	entry := make([]LockSet, len(fn.Blocks))
+	for _, block := range fn.Blocks {
+		acquiredIn[block.Index] = make(LockSet)
+		entry[block.Index] = make(LockSet)
+		for _, instr := range block.Instrs {
+			mergeLockSet(acquiredIn[block.Index], locksAcquiredBy(instr, scope))
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, block := range fn.Blocks {
+			out := entry[block.Index].Union(acquiredIn[block.Index])
+			for _, succ := range block.Succs {
+				for key, mode := range out {
+					if entry[succ.Index][key] < mode {
+						entry[succ.Index].Add(key, mode)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return entry
+}
+
+// The locks a call acquires, directly or in its callee, in the caller's
+// frame.
+func locksAcquiredBy(instr ssa.Instruction, scope *analysisScope) LockSet {
+	call, ok := instr.(*ssa.Call)
+	if !ok {
+		return nil
+	}
+
+	if isLockCall(call, scope) {
+		if key := getLockKey(call); !key.IsZero() {
+			return LockSet{key: lockModeForCallCommon(&call.Call, scope)}
+		}
+		return nil
+	}
+	if isUnlockCall(call, scope) {
+		return nil
+	}
+
+	if callee := call.Call.StaticCallee(); callee != nil {
+		locks, _ := collectFunctionLockEffects(callee, make(map[*ssa.Function]bool), scope)
+		return translateLockSet(locks, callee, &call.Call)
+	}
+	return nil
+}
+
+// Whether callee belongs to a package analyzed along with fn's, so that its
+// body is worth summarizing.
+func sharesAnalysisScope(fn *ssa.Function, callee *ssa.Function, scope *analysisScope) bool {
+	if fn.Pkg == nil || callee.Pkg == nil {
+		return false
+	}
+	return slices.Contains(scope.packages(fn.Pkg), callee.Pkg)
+}
+
+// A channel operation a goroutine launched in the package may block on, with
+// the locks the goroutine may acquire first, in the frame of its go
+// statement.
+type goroutineChannelWait struct {
+	channelWait
+	GoInstr *ssa.Go
+	Callee  *ssa.Function
+}
+
+// The channel waits of every goroutine launched in pkg, in the order of
+// their go statements.
+func collectGoroutineChannelWaits(pkg *ssa.Package, scope *analysisScope) []goroutineChannelWait {
+	if pkg == nil {
+		return nil
+	}
+
+	sites := make([]*ssa.Go, 0)
+	for fn := range collectPackageFunctions(pkg, scope) {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if goInstr, ok := instr.(*ssa.Go); ok {
+					sites = append(sites, goInstr)
+				}
+			}
+		}
+	}
+	slices.SortFunc(sites, func(a, b *ssa.Go) int { return int(a.Pos()) - int(b.Pos()) })
+
+	waits := make([]goroutineChannelWait, 0)
+	for _, goInstr := range sites {
+		for _, target := range resolveGoCallTargets(goInstr.Parent(), goInstr, scope) {
+			for _, wait := range collectChannelWaits(target, make(map[*ssa.Function]bool), scope) {
+				wait.Before = translateLockSet(wait.Before, target, &goInstr.Call)
+				waits = append(waits, goroutineChannelWait{channelWait: wait, GoInstr: goInstr, Callee: target})
+			}
+		}
+	}
+	return waits
+}
+
+// The values a channel may have been made by, as identities channels can be
+// related by: the make(chan) instructions that may have made it, and the
+// package variables and struct fields it may have been loaded from. A
+// channel with neither, like one returned by a call, is its own identity.
+// Finding them may scan the run's packages, so they are computed once per
+// channel value and run.
+func channelOrigins(ch ssa.Value, scope *analysisScope) map[any]bool {
+	if origins, ok := scope.channelOrigins[ch]; ok {
+		return origins
+	}
+
+	origins := make(map[any]bool)
+	addChannelOrigins(ch, origins, make(map[ssa.Value]bool), scope)
+	scope.channelOrigins[ch] = origins
+	return origins
+}
+
+// Whether two channel values may be the same channel.
+func channelsMayAlias(a map[any]bool, b map[any]bool) bool {
+	for origin := range a {
+		if b[origin] {
+			return true
+		}
+	}
+	return false
+}
+
+func addChannelOrigins(v ssa.Value, origins map[any]bool, seen map[ssa.Value]bool, scope *analysisScope) {
+	if v == nil || seen[v] {
+		return
+	}
+	seen[v] = true
+
+	switch v := v.(type) {
+	case *ssa.MakeChan:
+		origins[v] = true
+	case *ssa.ChangeType:
+		// Conversions to a send- or receive-only channel type.
+		addChannelOrigins(v.X, origins, seen, scope)
+	case *ssa.Phi:
+		for _, edge := range v.Edges {
+			addChannelOrigins(edge, origins, seen, scope)
+		}
+	case *ssa.UnOp:
+		if v.Op != token.MUL {
+			origins[v] = true
+			return
+		}
+		addStoredChannelOrigins(v.X, origins, seen, scope)
+	case *ssa.Parameter:
+		args := parameterArguments(v, scope)
+		if len(args) == 0 {
+			origins[v] = true
+		}
+		for _, arg := range args {
+			addChannelOrigins(arg, origins, seen, scope)
+		}
+	case *ssa.FreeVar:
+		bindings := freeVarBindings(v)
+		if len(bindings) == 0 {
+			origins[v] = true
+		}
+		for _, bound := range bindings {
+			addChannelOrigins(bound, origins, seen, scope)
+		}
+	default:
+		origins[v] = true
+	}
+}
+
+// Add the origins of the channels stored at addr: a package variable or
+// struct field, whose stores are found package-wide, or a local variable.
+func addStoredChannelOrigins(addr ssa.Value, origins map[any]bool, seen map[ssa.Value]bool, scope *analysisScope) {
+	var pkg *ssa.Package
+	switch a := addr.(type) {
+	case *ssa.Global:
+		origins[a] = true
+		pkg = a.Pkg
+	case *ssa.FieldAddr:
+		strct, ok := getUnderlyingStruct(a.X.Type())
+		if !ok || strct == nil || a.Field >= strct.NumFields() {
+			origins[a] = true
+			return
+		}
+		origins[strct.Field(a.Field)] = true
+		if a.Parent() != nil {
+			pkg = a.Parent().Pkg
+		}
+	case *ssa.Alloc:
+		for _, ref := range *a.Referrers() {
+			if store, ok := ref.(*ssa.Store); ok && store.Addr == a {
+				addChannelOrigins(store.Val, origins, seen, scope)
+			}
+		}
+		return
+	case *ssa.FreeVar:
+		// A local variable captured by a closure.
+		for _, bound := range freeVarBindings(a) {
+			addStoredChannelOrigins(bound, origins, seen, scope)
+		}
+		return
+	default:
+		origins[addr] = true
+		return
+	}
+
+	if pkg == nil {
+		return
+	}
+	for fn := range collectPackageFunctions(pkg, scope) {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				if store, ok := instr.(*ssa.Store); ok && sameStoreAddress(store.Addr, addr) {
+					addChannelOrigins(store.Val, origins, seen, scope)
+				}
+			}
+		}
+	}
+}
+
+// The arguments passed for param by the calls and go statements of its
+// function in the package.
+func parameterArguments(param *ssa.Parameter, scope *analysisScope) []ssa.Value {
+	fn := param.Parent()
+	if fn == nil || fn.Pkg == nil {
+		return nil
+	}
+	idx := slices.Index(fn.Params, param)
+	if idx < 0 {
+		return nil
+	}
+
+	args := make([]ssa.Value, 0)
+	for caller := range collectPackageFunctions(fn.Pkg, scope) {
+		for _, block := range caller.Blocks {
+			for _, instr := range block.Instrs {
+				call, ok := instr.(ssa.CallInstruction)
+				if !ok || call.Common().StaticCallee() != fn || idx >= len(call.Common().Args) {
+					continue
+				}
+				args = append(args, call.Common().Args[idx])
+			}
+		}
+	}
+	return args
+}
+
+// The values bound to a closure's free variable where the closure is made.
+func freeVarBindings(fv *ssa.FreeVar) []ssa.Value {
+	fn := fv.Parent()
+	if fn == nil || fn.Parent() == nil {
+		return nil
+	}
+	idx := slices.Index(fn.FreeVars, fv)
+	if idx < 0 {
+		return nil
+	}
+
+	bindings := make([]ssa.Value, 0, 1)
+	for _, block := range fn.Parent().Blocks {
+		for _, instr := range block.Instrs {
+			if closure, ok := instr.(*ssa.MakeClosure); ok && closure.Fn == fn && idx < len(closure.Bindings) {
+				bindings = append(bindings, closure.Bindings[idx])
+			}
+		}
+	}
+	return bindings
+}
+
+// A source-level name for a channel value.
+func channelDisplayName(ch ssa.Value) string {
+	switch v := ch.(type) {
+	case *ssa.ChangeType:
+		return channelDisplayName(v.X)
+	case *ssa.MakeChan:
+		if name := assignedVariableName(v.Parent(), v.Pos()); name != "" {
+			return name
+		}
+	case *ssa.UnOp, *ssa.Parameter, *ssa.Global, *ssa.FreeVar:
+		if root, path := accessPathForValue(v); root != nil {
+			if name := rootDisplayName(root); name != "" {
+				return joinLockPath(name, path)
+			}
+		}
+	}
+	return "a channel"
+}
@@ -0,0 +1,173 @@
+package analyzer
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"gotsan/ir"
+	"gotsan/utils/report"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Conditional acquisition: TryLock, TryRLock and functions annotated
+// @returns_if acquire a lock only when their result says so, so the lock is
+// held on one branch of the condition that tests the result and not on the
+// other.
+
+// The locks the condition a block branches on reports acquired, for each
+// of its successors: index 0 is the true branch, 1 the false one. Nil when
+// the block doesn't branch on such a condition.
+func branchAcquiredLocks(block *ssa.BasicBlock, registry *ir.ContractRegistry, scope *analysisScope) []LockSet {
+	if len(block.Instrs) == 0 || len(block.Succs) != 2 {
+		return nil
+	}
+	branch, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If)
+	if !ok {
+		return nil
+	}
+
+	call, result := conditionCall(branch.Cond, true)
+	if call == nil {
+		return nil
+	}
+
+	acquired := conditionallyAcquiredLocks(call, registry, scope)
+	if len(acquired[true]) == 0 && len(acquired[false]) == 0 {
+		return nil
+	}
+	return []LockSet{acquired[result], acquired[!result]}
+}
+
+// The call a branch condition tests, and the result of the call for which
+// the condition is true. when is that result for the condition itself;
+// negations and comparisons with a boolean constant are looked through.
+func conditionCall(cond ssa.Value, when bool) (*ssa.Call, bool) {
+	switch v := cond.(type) {
+	case *ssa.Call:
+		return v, when
+	case *ssa.UnOp:
+		if v.Op == token.NOT {
+			return conditionCall(v.X, !when)
+		}
+	case *ssa.BinOp:
+		if v.Op != token.EQL && v.Op != token.NEQ {
+			return nil, false
+		}
+		operand, value, ok := comparedWithBool(v)
+		if !ok {
+			return nil, false
+		}
+		// x == true and x != false hold when x does.
+		if value == (v.Op == token.EQL) {
+			return conditionCall(operand, when)
+		}
+		return conditionCall(operand, !when)
+	}
+	return nil, false
+}
+
+// The operand of a comparison with a boolean constant, and the constant.
+func comparedWithBool(cmp *ssa.BinOp) (ssa.Value, bool, bool) {
+	if value, ok := constantBool(cmp.Y); ok {
+		return cmp.X, value, true
+	}
+	if value, ok := constantBool(cmp.X); ok {
+		return cmp.Y, value, true
+	}
+	return nil, false, false
+}
+
+func constantBool(v ssa.Value) (bool, bool) {
+	c, ok := v.(*ssa.Const)
+	if !ok || c.Value == nil || c.Value.Kind() != constant.Bool {
+		return false, false
+	}
+	return constant.BoolVal(c.Value), true
+}
+
+// The locks call holds on return, by its result: a TryLock holds its
+// receiver when it returns true, and a function annotated @returns_if the
+// locks it names when it returns the result it names.
+func conditionallyAcquiredLocks(call *ssa.Call, registry *ir.ContractRegistry, scope *analysisScope) map[bool]LockSet {
+	acquired := map[bool]LockSet{true: make(LockSet), false: make(LockSet)}
+
+	if isTryLockCallCommon(&call.Call, scope) {
+		if key := getLockKey(call); !key.IsZero() {
+			acquired[true].Add(key, lockModeForCallCommon(&call.Call, scope))
+		}
+		return acquired
+	}
+
+	callee := call.Call.StaticCallee()
+	contract := contractForFunction(callee, registry)
+	if contract == nil {
+		return acquired
+	}
+	// Annotations don't carry a mode; see calleeAcquireMode.
+	for _, exp := range contract.Expectations[ir.ReturnsIf] {
+		if key := resolveLockKeyAtCall(callee, call, exp.Target); !key.IsZero() {
+			acquired[exp.HeldWhen].Add(key, LockExclusive)
+		}
+	}
+	return acquired
+}
+
+// Add the locks acquired on entry to a branch of block to state, as a lock
+// call at the branch condition would.
+func acquireOnBranch(block *ssa.BasicBlock, acquired LockSet, state *AnalysisState, explain bool) {
+	for key, mode := range acquired {
+		state.HeldLocks.Add(key, mode)
+		state.MayHeldLocks.Add(key, mode)
+		if explain {
+			state.addStep(blockDiagnosticPos(block), "acquires "+key.QualifiedName()+", as the condition reports")
+		}
+		state.MayHeldSources[key] = []lockSource{{Block: block, Trace: state.Trace}}
+	}
+}
+
+// Check a @returns_if expectation when fn returns at ret: a return of the
+// declared result must hold the lock, and a return of the other result must
+// not hold it on any path. Results that aren't constant are not checked.
+// Returns the lock, or the zero key when the target can't be resolved.
+func checkConditionalReturn(
+	fn *ssa.Function,
+	ret *ssa.Return,
+	state *AnalysisState,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	exp ir.Requirement,
+	contractPos token.Pos,
+) lockKey {
+	lock := resolveLockKeyInScope(fn, exp.Target)
+	if lock.IsZero() {
+		reportUnresolvableAnnotation(ir.ReturnsIf.String(), exp.Target, contractPos, reporter, fset)
+		return lockKey{}
+	}
+
+	result, ok := returnedBool(ret)
+	if !ok {
+		return lock
+	}
+
+	if result == exp.HeldWhen {
+		if !isHeldLockEquivalent(state.HeldLocks, lock) {
+			reportConditionalReturnLock(fn, ret, exp.Target, result, true, reporter, fset)
+		}
+	} else if state.MayHeldLocks.Contains(lock) {
+		reportConditionalReturnLock(fn, ret, exp.Target, result, false, reporter, fset)
+	}
+	return lock
+}
+
+// The constant value of the first boolean result ret returns.
+func returnedBool(ret *ssa.Return) (bool, bool) {
+	for _, result := range ret.Results {
+		basic, ok := result.Type().Underlying().(*types.Basic)
+		if !ok || basic.Info()&types.IsBoolean == 0 {
+			continue
+		}
+		return constantBool(result)
+	}
+	return false, false
+}
@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"go/token"
+	"go/types"
 	"gotsan/ir"
 	"gotsan/utils/logger"
 	"gotsan/utils/report"
@@ -20,10 +21,32 @@ func receiverTypeName(fn *ssa.Function) string {
 		return ""
 	}
 
-	return ir.NormalizeTypeName(recv.Type().String())
+	return ir.RelativeTypeName(recv.Type())
 }
 
-// Retrieve function contract from the registry
+// The package-qualified registry key of the function or method fn was
+// declared as, and the import path of fn's package. Anonymous functions and
+// synthetic functions without a declaration have no key.
+func qualifiedFunctionKey(fn *ssa.Function) (string, string) {
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+
+	obj, ok := fn.Object().(*types.Func)
+	if !ok || obj.Pkg() == nil {
+		if fn.Pkg != nil && fn.Pkg.Pkg != nil {
+			return "", fn.Pkg.Pkg.Path()
+		}
+		return "", ""
+	}
+
+	return ir.QualifiedFunctionKeyForObject(obj), obj.Pkg().Path()
+}
+
+// Retrieve function contract from the registry. Functions of packages
+// registered with their import path are looked up by qualified key only;
+// the name-based lookup is a fallback for everything else and is logged when
+// it finds a contract.
 func contractForFunction(fn *ssa.Function, registry *ir.ContractRegistry) *ir.FunctionContract {
 	if fn == nil || registry == nil {
 		return nil
@@ -35,54 +58,86 @@ func contractForFunction(fn *ssa.Function, registry *ir.ContractRegistry) *ir.Fu
 		}
 	}
 
+	key, pkgPath := qualifiedFunctionKey(fn)
+	if key != "" {
+		if c := registry.QualifiedFunctions[key]; c != nil {
+			return c
+		}
+	}
+	if registry.HasPackage(pkgPath) {
+		return nil
+	}
+
+	c, looseKey := looseContractForFunction(fn, registry)
+	if c != nil {
+		subject := fn.Name()
+		if fn.Signature != nil {
+			subject = fn.String()
+		}
+		logLooseMatch(registry, subject, looseKey)
+	}
+	return c
+}
+
+// Note once per subject that its contract or guard was found by the loose,
+// package-agnostic key looseKey.
+func logLooseMatch(registry *ir.ContractRegistry, subject string, looseKey string) {
+	if registry.LooseMatches[subject] {
+		return
+	}
+	registry.LooseMatches[subject] = true
+	logger.Warnf("No package-qualified annotation for %s; using the one registered as %q, matched by name", subject, looseKey)
+}
+
+// Name-based contract lookup, returning the contract and the key it was
+// registered under.
+func looseContractForFunction(fn *ssa.Function, registry *ir.ContractRegistry) (*ir.FunctionContract, string) {
 	recv := receiverTypeName(fn)
 
 	// If the function is a method, and has a receiver
 	// retrieve it by normalizing the type name to the function name
 	// Try method key first (if receiver exists)
 	if recv != "" {
-		if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), recv)]; c != nil {
-			return c
-		}
-
-		if strings.HasPrefix(recv, "*") {
-			if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), strings.TrimPrefix(recv, "*"))]; c != nil {
-				return c
-			}
-		} else {
-			if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), "*"+recv)]; c != nil {
-				return c
-			}
+		if c, key := lookupMethodContract(registry, fn.Name(), recv); c != nil {
+			return c, key
 		}
 	}
 
 	// Some SSA variants lose Signature.Recv, but still carry receiver-like first
 	// parameter (e.g., c *tableNameCache). Try that before plain-name fallback.
 	if recv == "" && len(fn.Params) > 0 {
-		paramRecv := ir.NormalizeTypeName(fn.Params[0].Type().String())
-		if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), paramRecv)]; c != nil {
-			return c
-		}
-
-		if strings.HasPrefix(paramRecv, "*") {
-			if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), strings.TrimPrefix(paramRecv, "*"))]; c != nil {
-				return c
-			}
-		} else {
-			if c := registry.Functions[ir.MakeFunctionKey(fn.Name(), "*"+paramRecv)]; c != nil {
-				return c
-			}
+		paramRecv := ir.RelativeTypeName(fn.Params[0].Type())
+		if c, key := lookupMethodContract(registry, fn.Name(), paramRecv); c != nil {
+			return c, key
 		}
 	}
 
 	// Last chance: disambiguate same-name contracts (e.g., remove methods on
 	// different receivers) by preferring expectations resolvable in this function.
-	if c := bestResolvableSameNameContract(fn, registry); c != nil {
-		return c
+	if c, key := bestResolvableSameNameContract(fn, registry); c != nil {
+		return c, key
 	}
 
 	// Final fallback to plain function name.
-	return registry.Functions[fn.Name()]
+	return registry.Functions[fn.Name()], fn.Name()
+}
+
+// Look up a method by loose key, with the receiver as given or with its
+// pointer-ness flipped.
+func lookupMethodContract(registry *ir.ContractRegistry, name string, recv string) (*ir.FunctionContract, string) {
+	keys := []string{ir.MakeFunctionKey(name, recv)}
+	if strings.HasPrefix(recv, "*") {
+		keys = append(keys, ir.MakeFunctionKey(name, strings.TrimPrefix(recv, "*")))
+	} else {
+		keys = append(keys, ir.MakeFunctionKey(name, "*"+recv))
+	}
+
+	for _, key := range keys {
+		if c := registry.Functions[key]; c != nil {
+			return c, key
+		}
+	}
+	return nil, ""
 }
 
 func expectationResolvableScore(fn *ssa.Function, c *ir.FunctionContract) int {
@@ -91,10 +146,10 @@ func expectationResolvableScore(fn *ssa.Function, c *ir.FunctionContract) int {
 	}
 
 	score := 0
-	kinds := []ir.AnnotationKind{ir.Requires, ir.Acquires, ir.Returns}
+	kinds := []ir.AnnotationKind{ir.Requires, ir.RequiresShared, ir.Acquires, ir.Returns, ir.ReturnsIf, ir.Excludes, ir.Releases}
 	for _, kind := range kinds {
 		for _, req := range c.Expectations[kind] {
-			if resolveObjectInScope(fn, req.Target) != nil {
+			if !resolveLockKeyInScope(fn, req.Target).IsZero() {
 				score++
 			}
 		}
@@ -103,13 +158,14 @@ func expectationResolvableScore(fn *ssa.Function, c *ir.FunctionContract) int {
 	return score
 }
 
-func bestResolvableSameNameContract(fn *ssa.Function, registry *ir.ContractRegistry) *ir.FunctionContract {
+func bestResolvableSameNameContract(fn *ssa.Function, registry *ir.ContractRegistry) (*ir.FunctionContract, string) {
 	if fn == nil || registry == nil {
-		return nil
+		return nil, ""
 	}
 
 	suffix := "." + fn.Name()
 	var best *ir.FunctionContract
+	bestKey := ""
 	bestScore := 0
 
 	for key, c := range registry.Functions {
@@ -122,39 +178,77 @@ func bestResolvableSameNameContract(fn *ssa.Function, registry *ir.ContractRegis
 		}
 
 		score := expectationResolvableScore(fn, c)
-		if score > bestScore {
+		if score > bestScore || (score == bestScore && score > 0 && key < bestKey) {
 			best = c
+			bestKey = key
 			bestScore = score
 		}
 	}
 
 	if bestScore > 0 {
-		return best
+		return best, bestKey
 	}
 
-	return nil
+	return nil, ""
 }
 
 // Creates the initial lockset for a function, according to the Requires
-// tag that is provided, and matches the function contract
-func createInitialLockset(fn *ssa.Function, contract *ir.FunctionContract, reporter *report.Reporter, fset *token.FileSet) LockSet {
+// tag that is provided, and matches the function contract.
+// @requires_shared locks start out held in shared mode, and @releases locks
+// in the mode the function releases them in.
+func createInitialLockset(fn *ssa.Function, contract *ir.FunctionContract, reporter *report.Reporter, fset *token.FileSet, scope *analysisScope) LockSet {
 	// Setup initial state
 	initialLockset := make(LockSet)
 
 	if contract != nil {
-		requires := contract.Expectations[ir.Requires]
-		for _, expectation := range requires {
-			obj := resolveObjectInScope(fn, expectation.Target)
-			if obj != nil {
-				initialLockset[obj] = true
-				logger.Debugf("Initialized path with lock: %v", obj.Name())
-			} else {
-				logger.Debugf("Could not resolve @requires target '%s' in %s — reported at call sites",
-					expectation.Target, fn.Name())
-				reportUnresolvableAnnotation(ir.Requires.String(), expectation.Target, contract.Pos, reporter, fset)
+		modes := map[ir.AnnotationKind]LockMode{
+			ir.Requires:       LockExclusive,
+			ir.RequiresShared: LockShared,
+			ir.Releases:       LockExclusive,
+		}
+		_, released := collectFunctionLockEffects(fn, make(map[*ssa.Function]bool), scope)
+		for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared, ir.Releases} {
+			for _, expectation := range contract.Expectations[kind] {
+				key := resolveLockKeyInScope(fn, expectation.Target)
+				if !key.IsZero() {
+					mode := modes[kind]
+					if kind == ir.Releases && released.ModeOf(key) == LockShared {
+						mode = LockShared
+					}
+					initialLockset.Add(key, mode)
+					logger.Debugf("Initialized path with %s lock: %v", mode, key.QualifiedName())
+				} else {
+					logger.Debugf("Could not resolve @%s target '%s' in %s — reported at call sites",
+						kind, expectation.Target, fn.Name())
+					reportUnresolvableAnnotation(kind.String(), expectation.Target, contract.Pos, reporter, fset)
+				}
 			}
 		}
 	}
 
 	return initialLockset
 }
+
+// @excludes is an assumption inside the function: the lock is not held on
+// entry, so the function may acquire it but cannot also require (or release)
+// it.
+func checkExcludesContradictions(fn *ssa.Function, contract *ir.FunctionContract, reporter *report.Reporter, fset *token.FileSet) {
+	if contract == nil {
+		return
+	}
+
+	for _, excluded := range contract.Expectations[ir.Excludes] {
+		key := resolveLockKeyInScope(fn, excluded.Target)
+		if key.IsZero() {
+			continue
+		}
+
+		for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared, ir.Releases} {
+			for _, exp := range contract.Expectations[kind] {
+				if equivalentLockKeys(resolveLockKeyInScope(fn, exp.Target), key) {
+					reportContradictoryContract(fn, kind.String(), excluded.Target, contract.Pos, reporter, fset)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"go/types"
+	"strings"
+	"testing"
+
+	"gotsan/ir"
+	"gotsan/utils/report"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+func fixtureMethod(t *testing.T, pkgs []*ssa.Package, pkgName string, typeName string, method string) *ssa.Function {
+	t.Helper()
+	for _, pkg := range pkgs {
+		if pkg.Pkg.Name() != pkgName {
+			continue
+		}
+		typ, ok := pkg.Members[typeName].(*ssa.Type)
+		if !ok {
+			break
+		}
+		mset := pkg.Prog.MethodSets.MethodSet(types.NewPointer(typ.Type()))
+		if sel := mset.Lookup(pkg.Pkg, method); sel != nil {
+			return pkg.Prog.MethodValue(sel)
+		}
+	}
+	t.Fatalf("expected %s.%s.%s in the fixture", pkgName, typeName, method)
+	return nil
+}
+
+func TestContractForFunctionDistinguishesPackages(t *testing.T) {
+	ssaPkgs, registry, _ := buildFixturePackages(t, "qualified_keys", 2)
+
+	alphaGet := fixtureMethod(t, ssaPkgs, "alpha", "Cache", "Get")
+	if c := contractForFunction(alphaGet, registry); c == nil || len(c.Expectations[ir.Requires]) != 1 {
+		t.Fatalf("expected alpha.(*Cache).Get to carry its @requires contract, got %+v", c)
+	}
+
+	betaGet := fixtureMethod(t, ssaPkgs, "beta", "Cache", "Get")
+	if c := contractForFunction(betaGet, registry); c == nil || len(c.Expectations) != 0 {
+		t.Fatalf("expected beta.(*Cache).Get to carry its own empty contract, got %+v", c)
+	}
+	if len(registry.LooseMatches) != 0 {
+		t.Fatalf("registered packages must not fall back to loose keys, got %v", registry.LooseMatches)
+	}
+}
+
+func TestContractForFunctionLooseFallbackIsRecorded(t *testing.T) {
+	ssaPkgs, _, _ := buildFixturePackages(t, "qualified_keys", 2)
+
+	// A registry populated without package paths only has loose keys.
+	contract := &ir.FunctionContract{Expectations: make(map[ir.AnnotationKind][]ir.Requirement)}
+	registry := ir.NewContractRegistry()
+	registry.Functions["*Cache.Get"] = contract
+
+	betaGet := fixtureMethod(t, ssaPkgs, "beta", "Cache", "Get")
+	if c := contractForFunction(betaGet, registry); c != contract {
+		t.Fatalf("expected the loose lookup to match *Cache.Get, got %+v", c)
+	}
+	if !registry.LooseMatches[betaGet.String()] {
+		t.Fatalf("expected the loose match to be recorded, got %v", registry.LooseMatches)
+	}
+}
+
+func TestRun_SameNamedTypesInDifferentPackages(t *testing.T) {
+	ssaPkgs, registry, fset := buildFixturePackages(t, "qualified_keys", 2)
+
+	reporter := report.NewReporter()
+	for _, pkg := range ssaPkgs {
+		Run(pkg, registry, reporter, fset, true)
+	}
+	for _, d := range append(reporter.Findings, reporter.Warnings...) {
+		if strings.Contains(d.File, "beta") {
+			t.Fatalf("beta.Cache picked up alpha's contracts or guards: %s", d.Message)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"gotsan/ir"
+	"gotsan/utils/report"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Declared lock orders. @acquired_before and @acquired_after annotations on
+// mutex fields and variables declare a partial order over locks (see
+// ir.LockOrder). Every acquisition made while other locks are held, directly
+// or inside a callee, must respect it. The order is declared per field or
+// variable, so it relates every instance of a field alike.
+
+// declaredLock is the name of a lock in the declared orders, and how
+// diagnostics spell it.
+type declaredLock struct {
+	Name    string
+	Display string
+}
+
+// The name of the struct type in obj's package that declares field.
+func fieldOwnerTypeName(field *types.Var) string {
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		typeName, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		structType, ok := typeName.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := range structType.NumFields() {
+			if structType.Field(i) == field {
+				return typeName.Name()
+			}
+		}
+	}
+	return ""
+}
+
+// Whether name appears in any declared order.
+func lockOrderDeclares(registry *ir.ContractRegistry, name string) bool {
+	for _, order := range registry.LockOrders {
+		if order.Before == name || order.After == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The declared-order name of the lock key denotes: its data key, qualified
+// like the orders of its package were registered. Locks no order mentions
+// have no name.
+func declaredLockName(registry *ir.ContractRegistry, key lockKey) (declaredLock, bool) {
+	if registry == nil || len(registry.LockOrders) == 0 {
+		return declaredLock{}, false
+	}
+
+	obj, ok := key.Obj.(*types.Var)
+	if !ok || obj.Pkg() == nil {
+		return declaredLock{}, false
+	}
+
+	dataKey := ""
+	switch {
+	case obj.Parent() == obj.Pkg().Scope():
+		dataKey = obj.Name()
+	case obj.IsField():
+		owner := fieldOwnerTypeName(obj)
+		if owner == "" {
+			return declaredLock{}, false
+		}
+		dataKey = owner + "." + obj.Name()
+	default:
+		return declaredLock{}, false
+	}
+
+	for _, name := range []string{ir.MakeQualifiedDataKey(obj.Pkg().Path(), dataKey), dataKey} {
+		if lockOrderDeclares(registry, name) {
+			return declaredLock{Name: name, Display: dataKey}, true
+		}
+	}
+	return declaredLock{}, false
+}
+
+// A declared-order name without the import path of a registered package,
+// e.g. "Registry.mu".
+func declaredLockDisplayName(registry *ir.ContractRegistry, name string) string {
+	pkgPath := ""
+	for path := range registry.Packages {
+		if strings.HasPrefix(name, path+".") && len(path) > len(pkgPath) {
+			pkgPath = path
+		}
+	}
+	if pkgPath == "" {
+		return name
+	}
+	return name[len(pkgPath)+1:]
+}
+
+// Check the acquisition of acquired at pos, in fn, against the declared
+// order of each lock in held. callee is the function that acquires it, when
+// the acquisition happens inside a call.
+func checkDeclaredLockOrder(
+	fn *ssa.Function,
+	pos token.Pos,
+	callee *ssa.Function,
+	held LockSet,
+	acquired lockKey,
+	registry *ir.ContractRegistry,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if acquired.IsZero() || len(held) == 0 {
+		return
+	}
+
+	acquiredName, ok := declaredLockName(registry, acquired)
+	if !ok {
+		return
+	}
+
+	for heldKey := range held {
+		if heldKey.IsZero() || heldKey.Obj == acquired.Obj {
+			continue
+		}
+
+		heldName, ok := declaredLockName(registry, heldKey)
+		if !ok {
+			continue
+		}
+
+		if chain := registry.DeclaredLockOrder(acquiredName.Name, heldName.Name); chain != nil {
+			reportDeclaredLockOrderViolation(fn, pos, callee, acquired, heldKey, acquiredName, heldName, chain, registry, reporter, fset)
+		}
+	}
+}
+
+// Check the locks a call acquires, from its callee's summary and @acquires
+// contract, against the declared order of the locks held at the call.
+func checkCalleeDeclaredLockOrder(
+	fn *ssa.Function,
+	callSite *ssa.Call,
+	callee *ssa.Function,
+	acquired LockSet,
+	state *AnalysisState,
+	registry *ir.ContractRegistry,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if len(state.HeldLocks) == 0 || len(registry.LockOrders) == 0 {
+		return
+	}
+
+	acquired = acquired.Copy()
+	mergeLockSet(acquired, contractLocksAtCall(ir.Acquires, callee, callSite, contractForFunction(callee, registry)))
+	for key := range acquired {
+		checkDeclaredLockOrder(fn, callSite.Pos(), boundMethodTarget(callee), state.HeldLocks, key, registry, reporter, fset)
+	}
+}
+
+// Report the cycles in the declared lock orders: no acquisition order can
+// satisfy them.
+func reportDeclaredLockOrderCycles(registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet) {
+	if registry == nil {
+		return
+	}
+
+	for _, cycle := range registry.LockOrderCycles() {
+		reportDeclaredLockOrderCycle(cycle, registry, reporter, fset)
+	}
+}
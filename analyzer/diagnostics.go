@@ -2,8 +2,10 @@ package analyzer
 
 import (
 	"go/token"
+	"gotsan/ir"
 	"gotsan/utils/logger"
 	"gotsan/utils/report"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,6 +37,60 @@ func returnDiagnosticPos(fn *ssa.Function, instr ssa.Instruction) token.Pos {
 	return token.NoPos
 }
 
+func lockSetDisplayNames(locks LockSet) []string {
+	countByName := make(map[string]int, len(locks))
+	for key := range locks {
+		if !key.IsZero() {
+			countByName[key.Name()]++
+		}
+	}
+
+	seen := make(map[string]bool, len(locks))
+	names := make([]string, 0, len(locks))
+	for key := range locks {
+		if key.IsZero() {
+			continue
+		}
+
+		name := key.Name()
+		if countByName[name] > 1 {
+			name = key.QualifiedName()
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// The name of fn as diagnostics record it, relative to its package (e.g.,
+// "(*Cache).Get" or "main$1").
+func enclosingFunctionName(fn *ssa.Function) string {
+	if fn == nil {
+		return ""
+	}
+	if fn.Pkg != nil {
+		return fn.RelString(fn.Pkg.Pkg)
+	}
+	return fn.Name()
+}
+
+// A related position for a diagnostic, e.g. the other site of a deadlock.
+func relatedPosition(fset *token.FileSet, pos token.Pos, message string) report.RelatedPosition {
+	position := fset.Position(pos)
+	return report.RelatedPosition{
+		Pos:     pos,
+		File:    position.Filename,
+		Line:    position.Line,
+		Column:  position.Column,
+		Message: message,
+	}
+}
+
 // Analysis reporting helper functions
 
 func reportMissingLock(
@@ -51,11 +107,15 @@ func reportMissingLock(
 
 	position := fset.Position(msg.Pos())
 	reporter.Warn(report.Diagnostic{
-		Pos:     msg.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Call to " + callee.Name() + " requires lock " + target + ", but it's not held",
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleMissingLock,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   "Call to " + callee.Name() + " requires lock " + target + ", but it's not held",
 	})
 }
 
@@ -73,11 +133,65 @@ func reportGuardViolation(
 
 	position := fset.Position(instr.Pos())
 	reporter.Warn(report.Diagnostic{
-		Pos:     instr.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Access to " + dataName + " requires lock " + mutexName + ", but it's not held",
+		Pos:      instr.Pos(),
+		File:     position.Filename,
+		Line:     position.Line,
+		Column:   position.Column,
+		Rule:     report.RuleGuardViolation,
+		Function: enclosingFunctionName(instr.Parent()),
+		Locks:    []string{mutexName},
+		Message:  "Access to " + dataName + " requires lock " + mutexName + ", but it's not held",
+	})
+}
+
+func reportSharedLockInsufficient(
+	msg *ssa.Call,
+	callee *ssa.Function,
+	target string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if reporter == nil || fset == nil {
+		logger.Warnf("Call to %s requires lock %s exclusively, but only a shared (read) lock is held", callee.Name(), target)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleMissingLock,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   "Call to " + callee.Name() + " requires lock " + target + " exclusively, but only a shared (read) lock is held",
+	})
+}
+
+func reportGuardWriteUnderSharedLock(
+	instr ssa.Instruction,
+	dataName string,
+	mutexName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if reporter == nil || fset == nil {
+		logger.Warnf("Write to %s requires lock %s exclusively, but only a shared (read) lock is held", dataName, mutexName)
+		return
+	}
+
+	position := fset.Position(instr.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:      instr.Pos(),
+		File:     position.Filename,
+		Line:     position.Line,
+		Column:   position.Column,
+		Rule:     report.RuleGuardViolation,
+		Function: enclosingFunctionName(instr.Parent()),
+		Locks:    []string{mutexName},
+		Message:  "Write to " + dataName + " requires lock " + mutexName + " exclusively, but only a shared (read) lock is held",
 	})
 }
 
@@ -95,11 +209,15 @@ func reportAlreadyAcquiredLock(
 
 	position := fset.Position(msg.Pos())
 	reporter.Warn(report.Diagnostic{
-		Pos:     msg.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Call to " + callee.Name() + " acquires lock " + target + ", but it is already held",
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReacquire,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   "Call to " + callee.Name() + " acquires lock " + target + ", but it is already held",
 	})
 }
 
@@ -126,11 +244,84 @@ func reportReacquiredLock(
 
 	position := fset.Position(msg.Pos())
 	reporter.Warn(report.Diagnostic{
-		Pos:     msg.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Function " + fnName + " reacquires lock " + lockName + " while it is already held",
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReacquire,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   "Function " + fnName + " reacquires lock " + lockName + " while it is already held",
+	})
+}
+
+// Upgrading a read lock to a write lock on the same RWMutex blocks forever:
+// Lock waits for every reader, including the caller.
+func reportLockUpgrade(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	lockName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := "<unknown>"
+	if fn != nil {
+		fnName = fn.Name()
+	}
+
+	if lockName == "" {
+		lockName = "<lock>"
+	}
+
+	message := "Function " + fnName + " acquires lock " + lockName +
+		" exclusively while holding it shared; upgrading a read lock deadlocks"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReacquire,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+func reportCallUpgradesLock(
+	msg *ssa.Call,
+	callee *ssa.Function,
+	target string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	message := "Call to " + callee.Name() + " acquires lock " + target +
+		" exclusively, but it is already held shared; upgrading a read lock deadlocks"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReacquire,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   message,
 	})
 }
 
@@ -150,14 +341,7 @@ func reportDynamicCallbackWhileHoldingLocks(
 		fnName = fn.Name()
 	}
 
-	lockNames := make([]string, 0, len(heldLocks))
-	for obj := range heldLocks {
-		if obj == nil {
-			continue
-		}
-		lockNames = append(lockNames, obj.Name())
-	}
-	sort.Strings(lockNames)
+	lockNames := lockSetDisplayNames(heldLocks)
 
 	locks := "<lock>"
 	if len(lockNames) > 0 {
@@ -174,11 +358,15 @@ func reportDynamicCallbackWhileHoldingLocks(
 
 	position := fset.Position(msg.Pos())
 	reporter.WarnHeuristic(report.Diagnostic{
-		Pos:     msg.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: message,
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCallbackUnderLock,
+		Function:  enclosingFunctionName(fn),
+		Locks:     lockNames,
+		Functions: []string{fnName},
+		Message:   message,
 	})
 }
 
@@ -201,11 +389,57 @@ func reportReturnMissingLock(
 
 	position := fset.Position(pos)
 	reporter.Warn(report.Diagnostic{
-		Pos:     pos,
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Function " + fn.Name() + " must return with lock " + target + " held",
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReturnsContract,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{target},
+		Functions: []string{fn.Name()},
+		Message:   "Function " + fn.Name() + " must return with lock " + target + " held",
+	})
+}
+
+// Report a return of result from a function annotated @returns_if that
+// breaks the contract: the lock must be held when the function returns the
+// declared result (missing reports that it is not), and must not be held
+// on any path when it returns the other one.
+func reportConditionalReturnLock(
+	fn *ssa.Function,
+	instr ssa.Instruction,
+	target string,
+	result bool,
+	missing bool,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	pos := returnDiagnosticPos(fn, instr)
+	if pos == token.NoPos {
+		return
+	}
+
+	message := "Function " + fn.Name() + " returns " + strconv.FormatBool(result) + " without lock " + target + " held"
+	if !missing {
+		message = "Function " + fn.Name() + " returns " + strconv.FormatBool(result) + " while lock " + target + " may still be held"
+	}
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReturnsContract,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{target},
+		Functions: []string{fn.Name()},
+		Message:   message,
 	})
 }
 
@@ -229,6 +463,8 @@ func reportUnresolvableAnnotation(
 		File:    position.Filename,
 		Line:    position.Line,
 		Column:  position.Column,
+		Rule:    report.RuleUnresolvableAnnotation,
+		Locks:   []string{target},
 		Message: message,
 	})
 }
@@ -255,11 +491,14 @@ func reportCallsiteLocalRootAnnotation(
 
 	position := fset.Position(pos)
 	reporter.WarnHeuristic(report.Diagnostic{
-		Pos:     pos,
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: message,
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleUnresolvableAnnotation,
+		Locks:     []string{target},
+		Functions: []string{fnName},
+		Message:   message,
 	})
 }
 
@@ -275,14 +514,7 @@ func reportUndeclaredReturnedLock(
 		return
 	}
 
-	lockNames := make([]string, 0, len(heldLocks))
-	for obj := range heldLocks {
-		if obj == nil {
-			continue
-		}
-		lockNames = append(lockNames, obj.Name())
-	}
-	sort.Strings(lockNames)
+	lockNames := lockSetDisplayNames(heldLocks)
 
 	locks := "unknown lock"
 	if len(lockNames) > 0 {
@@ -296,11 +528,58 @@ func reportUndeclaredReturnedLock(
 
 	position := fset.Position(pos)
 	reporter.Warn(report.Diagnostic{
-		Pos:     pos,
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: "Function " + fn.Name() + " returns lock(s) " + locks + " but no @returns(...) contract is declared",
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReturnsContract,
+		Function:  enclosingFunctionName(fn),
+		Locks:     lockNames,
+		Functions: []string{fn.Name()},
+		Message:   "Function " + fn.Name() + " returns lock(s) " + locks + " but no @returns(...) contract is declared",
+	})
+}
+
+// witness is where the path that keeps lock held leaves the branch it was last
+// held in; without one the report falls back to the return.
+func reportLockMayBeHeldOnReturn(
+	fn *ssa.Function,
+	ret *ssa.Return,
+	lockName string,
+	witness token.Pos,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	retPos := returnDiagnosticPos(fn, ret)
+	if retPos == token.NoPos {
+		return
+	}
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("Function %s may return with lock %s still held", fn.Name(), lockName)
+		return
+	}
+
+	pos := retPos
+	msg := "Function " + fn.Name() + " may return with lock " + lockName + " still held: it is released on some paths but not others"
+	if witness != token.NoPos {
+		pos = witness
+		msg = "Function " + fn.Name() + " may return with lock " + lockName +
+			" still held: the path from here reaches the return near line " + strconv.Itoa(fset.Position(retPos).Line) +
+			" without releasing it"
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleLockLeak,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fn.Name()},
+		Message:   msg,
 	})
 }
 
@@ -334,11 +613,15 @@ func reportLikelyMissingAnnotation(
 
 	position := fset.Position(pos)
 	reporter.WarnHeuristic(report.Diagnostic{
-		Pos:     pos,
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: message,
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleMissingAnnotation,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fn.Name()},
+		Message:   message,
 	})
 }
 
@@ -378,11 +661,15 @@ func reportRecursiveCallMayReacquireLock(
 
 	position := fset.Position(callSite.Pos())
 	reporter.WarnHeuristic(report.Diagnostic{
-		Pos:     callSite.Pos(),
-		File:    position.Filename,
-		Line:    position.Line,
-		Column:  position.Column,
-		Message: message,
+		Pos:       callSite.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleRecursiveReacquire,
+		Function:  enclosingFunctionName(callSite.Parent()),
+		Locks:     []string{lockName},
+		Functions: []string{callerName, calleeName},
+		Message:   message,
 	})
 }
 
@@ -401,10 +688,6 @@ func reportGoroutineLockOrderInversion(
 	}
 
 	posA := fset.Position(goA.Pos())
-	lineB := 0
-	if goB != nil {
-		lineB = fset.Position(goB.Pos()).Line
-	}
 
 	nameA := "<unknown>"
 	if fnA != nil {
@@ -418,16 +701,108 @@ func reportGoroutineLockOrderInversion(
 	msg := "Potential deadlock between goroutines: " +
 		"go " + nameA + " acquires " + firstLock + " before " + secondLock +
 		", while go " + nameB + " acquires " + secondLock + " before " + firstLock
-	if lineB > 0 {
-		msg += " (other goroutine starts near line " + strconv.Itoa(lineB) + ")"
+	related := []report.RelatedPosition{
+		relatedPosition(fset, goA.Pos(), "go "+nameA+" acquires "+firstLock+" before "+secondLock),
+	}
+	if goB != nil {
+		related = append(related, relatedPosition(fset, goB.Pos(), "go "+nameB+" acquires "+secondLock+" before "+firstLock))
+	}
+
+	reporter.Warn(report.Diagnostic{
+		Pos:       goA.Pos(),
+		File:      posA.Filename,
+		Line:      posA.Line,
+		Column:    posA.Column,
+		Rule:      report.RuleLockOrderInversion,
+		Function:  enclosingFunctionName(goA.Parent()),
+		Locks:     []string{firstLock, secondLock},
+		Functions: []string{nameA, nameB},
+		Message:   msg,
+		Related:   related,
+	})
+}
+
+// Describe the go statement or call whose acquisition order produced edge.
+func lockOrderSiteName(edge lockOrderEdge) string {
+	if _, ok := edge.Site.(*ssa.Go); ok {
+		return "go " + lockOrderSiteCallee(edge)
+	}
+	return "call to " + lockOrderSiteCallee(edge)
+}
+
+// The name of the function launched or called at edge's site.
+func lockOrderSiteCallee(edge lockOrderEdge) string {
+	var common *ssa.CallCommon
+	switch site := edge.Site.(type) {
+	case *ssa.Go:
+		common = &site.Call
+	case *ssa.Call:
+		common = &site.Call
+	default:
+		return "<unknown>"
+	}
+
+	callee := common.StaticCallee()
+	if callee == nil {
+		callee = resolveFunctionFromValue(common.Value)
+	}
+	if callee == nil {
+		return "<unknown>"
+	}
+	return callee.Name()
+}
+
+// Display names for the locks of a cycle, disambiguated by access path when
+// several share a field name.
+func lockCycleDisplayNames(cycle []lockOrderEdge) []string {
+	countByName := make(map[string]int, len(cycle))
+	for _, edge := range cycle {
+		countByName[lockDisplayName(edge.From)]++
+	}
+
+	names := make([]string, 0, len(cycle))
+	for _, edge := range cycle {
+		name := lockDisplayName(edge.From)
+		if countByName[name] > 1 && edge.From.Obj != nil && edge.From.Root != nil {
+			name = edge.From.key().QualifiedName()
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Report a lock-order cycle. Each edge is described by its site and listed as
+// a related position.
+func reportLockOrderCycle(cycle []lockOrderEdge, reporter *report.Reporter, fset *token.FileSet) {
+	if len(cycle) == 0 || cycle[0].Site == nil || reporter == nil || fset == nil {
+		return
 	}
 
+	names := lockCycleDisplayNames(cycle)
+	functions := make([]string, 0, len(cycle))
+	steps := make([]string, 0, len(cycle))
+	related := make([]report.RelatedPosition, 0, len(cycle))
+	for i, edge := range cycle {
+		functions = append(functions, lockOrderSiteCallee(edge))
+		step := lockOrderSiteName(edge) + " acquires " + names[i] + " before " + names[(i+1)%len(names)]
+		steps = append(steps, step)
+
+		related = append(related, relatedPosition(fset, edgePos(edge), step))
+	}
+
+	pos := cycle[0].Site.Pos()
+	position := fset.Position(pos)
 	reporter.Warn(report.Diagnostic{
-		Pos:     goA.Pos(),
-		File:    posA.Filename,
-		Line:    posA.Line,
-		Column:  posA.Column,
-		Message: msg,
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleLockOrderInversion,
+		Function:  enclosingFunctionName(cycle[0].SiteFn),
+		Locks:     names,
+		Functions: functions,
+		Message:   "Potential deadlock cycle across locks " + strings.Join(names, ", ") + ": " + strings.Join(steps, ", "),
+		Related:   related,
 	})
 }
 
@@ -445,10 +820,6 @@ func reportGoroutineRecursiveLockPotentialDeadlock(
 	}
 
 	posA := fset.Position(goA.Pos())
-	lineB := 0
-	if goB != nil {
-		lineB = fset.Position(goB.Pos()).Line
-	}
 
 	nameA := "<unknown>"
 	if fnA != nil {
@@ -462,16 +833,24 @@ func reportGoroutineRecursiveLockPotentialDeadlock(
 	msg := "Potential deadlock between goroutines: " +
 		"go " + nameA + " may reacquire " + lockName + " while already held, " +
 		"and go " + nameB + " also acquires " + lockName
-	if lineB > 0 {
-		msg += " (other goroutine starts near line " + strconv.Itoa(lineB) + ")"
+	related := []report.RelatedPosition{
+		relatedPosition(fset, goA.Pos(), "go "+nameA+" may reacquire "+lockName+" while already held"),
+	}
+	if goB != nil {
+		related = append(related, relatedPosition(fset, goB.Pos(), "go "+nameB+" acquires "+lockName))
 	}
 
 	reporter.Warn(report.Diagnostic{
-		Pos:     goA.Pos(),
-		File:    posA.Filename,
-		Line:    posA.Line,
-		Column:  posA.Column,
-		Message: msg,
+		Pos:       goA.Pos(),
+		File:      posA.Filename,
+		Line:      posA.Line,
+		Column:    posA.Column,
+		Rule:      report.RuleGoroutineReacquire,
+		Function:  enclosingFunctionName(goA.Parent()),
+		Locks:     []string{lockName},
+		Functions: []string{nameA, nameB},
+		Message:   msg,
+		Related:   related,
 	})
 }
 
@@ -490,10 +869,6 @@ func reportSingleThreadedLockOrderInversion(
 	}
 
 	posA := fset.Position(callA.Pos())
-	lineB := 0
-	if callB != nil {
-		lineB = fset.Position(callB.Pos()).Line
-	}
 
 	nameA := "<unknown>"
 	if fnA != nil {
@@ -507,15 +882,720 @@ func reportSingleThreadedLockOrderInversion(
 	msg := "Potential deadlock in single-threaded code: " +
 		"call to " + nameA + " acquires " + firstLock + " before " + secondLock +
 		", while call to " + nameB + " acquires " + secondLock + " before " + firstLock
-	if lineB > 0 {
-		msg += " (other call near line " + strconv.Itoa(lineB) + ")"
+	related := []report.RelatedPosition{
+		relatedPosition(fset, callA.Pos(), "call to "+nameA+" acquires "+firstLock+" before "+secondLock),
+	}
+	if callB != nil {
+		related = append(related, relatedPosition(fset, callB.Pos(), "call to "+nameB+" acquires "+secondLock+" before "+firstLock))
 	}
 
 	reporter.Warn(report.Diagnostic{
-		Pos:     callA.Pos(),
-		File:    posA.Filename,
-		Line:    posA.Line,
-		Column:  posA.Column,
-		Message: msg,
+		Pos:       callA.Pos(),
+		File:      posA.Filename,
+		Line:      posA.Line,
+		Column:    posA.Column,
+		Rule:      report.RuleLockOrderInversion,
+		Function:  enclosingFunctionName(callA.Parent()),
+		Locks:     []string{firstLock, secondLock},
+		Functions: []string{nameA, nameB},
+		Message:   msg,
+		Related:   related,
+	})
+}
+
+func reportGoroutineRWRDeadlock(
+	goA *ssa.Go,
+	goB *ssa.Go,
+	fnA *ssa.Function,
+	fnB *ssa.Function,
+	readPos token.Pos,
+	lockName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if goA == nil || reporter == nil || fset == nil {
+		return
+	}
+
+	posA := fset.Position(goA.Pos())
+
+	nameA := "<unknown>"
+	if fnA != nil {
+		nameA = fnA.Name()
+	}
+	nameB := "<unknown>"
+	if fnB != nil {
+		nameB = fnB.Name()
+	}
+
+	msg := "Potential RWR deadlock between goroutines: " +
+		"go " + nameA + " read-locks " + lockName + " again while already holding it shared"
+	related := []report.RelatedPosition{
+		relatedPosition(fset, goA.Pos(), "go "+nameA+" read-locks "+lockName+" while holding it shared"),
+	}
+	if readPos != token.NoPos {
+		related = append(related, relatedPosition(fset, readPos, "read-locks "+lockName+" again"))
+	}
+
+	if goB == goA {
+		msg += ", and another instance of go " + nameA + " write-locks " + lockName + " in between"
+	} else {
+		msg += ", and go " + nameB + " write-locks " + lockName + " in between"
+		if goB != nil {
+			related = append(related, relatedPosition(fset, goB.Pos(), "go "+nameB+" write-locks "+lockName))
+		}
+	}
+
+	reporter.Warn(report.Diagnostic{
+		Pos:       goA.Pos(),
+		File:      posA.Filename,
+		Line:      posA.Line,
+		Column:    posA.Column,
+		Rule:      report.RuleRWRDeadlock,
+		Function:  enclosingFunctionName(goA.Parent()),
+		Locks:     []string{lockName},
+		Functions: []string{nameA, nameB},
+		Message:   msg,
+		Related:   related,
+	})
+}
+
+func unlockCallName(mode LockMode) string {
+	if mode == LockShared {
+		return "RUnlock"
+	}
+	return "Unlock"
+}
+
+func reportUnlockOfUnheldLock(
+	fn *ssa.Function,
+	pos token.Pos,
+	lockName string,
+	deferred bool,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := "<unknown>"
+	if fn != nil {
+		fnName = fn.Name()
+	}
+
+	message := "Function " + fnName + " unlocks lock " + lockName + ", but it is not held"
+	if deferred {
+		message = "Deferred unlock in function " + fnName + " releases lock " + lockName +
+			", but it is no longer held on return (already unlocked)"
+	}
+
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleUnlockNotHeld,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+func reportUnlockOfMaybeHeldLock(
+	fn *ssa.Function,
+	pos token.Pos,
+	lockName string,
+	deferred bool,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := "<unknown>"
+	if fn != nil {
+		fnName = fn.Name()
+	}
+
+	message := "Function " + fnName + " unlocks lock " + lockName + ", but it is only held on some paths"
+	if deferred {
+		message = "Deferred unlock in function " + fnName + " releases lock " + lockName +
+			", but it is only held on some paths to return"
+	}
+
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleUnlockNotHeld,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+func reportUnlockModeMismatch(
+	fn *ssa.Function,
+	pos token.Pos,
+	lockName string,
+	heldMode LockMode,
+	unlockMode LockMode,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := "<unknown>"
+	if fn != nil {
+		fnName = fn.Name()
+	}
+
+	message := "Function " + fnName + " calls " + unlockCallName(unlockMode) + " on lock " + lockName +
+		", but it is held " + heldMode.String() + "; use " + unlockCallName(heldMode)
+
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleUnlockNotHeld,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+// The lock is held on at least one path reaching the call.
+func reportExcludedLockHeld(
+	msg *ssa.Call,
+	callee *ssa.Function,
+	target string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	message := "Call to " + callee.Name() + " excludes lock " + target + ", but it may be held here"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleExcludedLockHeld,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   message,
+	})
+}
+
+func reportContradictoryContract(
+	fn *ssa.Function,
+	kind string,
+	target string,
+	pos token.Pos,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	message := "Function " + fn.Name() + " is annotated both @" + kind + " and @excludes for lock " + target
+
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleContradictoryContract,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{target},
+		Functions: []string{fn.Name()},
+		Message:   message,
+	})
+}
+
+// The lock is held on none (maybe unset) or only some (maybe set) of the
+// paths reaching the call.
+func reportReleasedLockNotHeld(
+	msg *ssa.Call,
+	callee *ssa.Function,
+	target string,
+	maybe bool,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	message := "Call to " + callee.Name() + " releases lock " + target + ", but it's not held"
+	if maybe {
+		message = "Call to " + callee.Name() + " releases lock " + target + ", but it is only held on some paths"
+	}
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleUnlockNotHeld,
+		Function:  enclosingFunctionName(msg.Parent()),
+		Locks:     []string{target},
+		Functions: []string{callee.Name()},
+		Message:   message,
+	})
+}
+
+func reportReturnWithoutRelease(
+	fn *ssa.Function,
+	instr ssa.Instruction,
+	target string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	pos := returnDiagnosticPos(fn, instr)
+	if pos == token.NoPos {
+		return
+	}
+
+	message := "Function " + fn.Name() + " must release lock " + target + " before returning, but it may still be held"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleReleasesContract,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{target},
+		Functions: []string{fn.Name()},
+		Message:   message,
+	})
+}
+
+// Related positions for a chain of declared lock orders, one per annotation.
+func declaredLockOrderRelated(chain []ir.LockOrder, registry *ir.ContractRegistry, fset *token.FileSet) []report.RelatedPosition {
+	related := make([]report.RelatedPosition, 0, len(chain))
+	for _, order := range chain {
+		step := declaredLockDisplayName(registry, order.Before) + " is declared to be acquired before " + declaredLockDisplayName(registry, order.After)
+		related = append(related, relatedPosition(fset, order.Pos, step))
+	}
+	return related
+}
+
+func reportDeclaredLockOrderViolation(
+	fn *ssa.Function,
+	pos token.Pos,
+	callee *ssa.Function,
+	acquired lockKey,
+	held lockKey,
+	acquiredName declaredLock,
+	heldName declaredLock,
+	chain []ir.LockOrder,
+	registry *ir.ContractRegistry,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	subject := "Function " + fn.Name()
+	functions := []string{fn.Name()}
+	if callee != nil {
+		subject = "Call to " + callee.Name()
+		functions = []string{callee.Name()}
+	}
+
+	message := subject + " acquires lock " + acquired.QualifiedName() + " while holding " + held.QualifiedName() +
+		", but " + acquiredName.Display + " is declared to be acquired before " + heldName.Display
+
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	related := declaredLockOrderRelated(chain, registry, fset)
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleLockOrderViolation,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{acquiredName.Display, heldName.Display},
+		Functions: functions,
+		Message:   message,
+		Related:   related,
+	})
+}
+
+// Report a cycle in the declared lock orders at its first annotation. A
+// cycle of imported orders alone is reported in the package that declares
+// them; one that closes in this package, at its first order of this package.
+func reportDeclaredLockOrderCycle(cycle []ir.LockOrder, registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet) {
+	first := slices.IndexFunc(cycle, func(order ir.LockOrder) bool { return !order.Imported })
+	if first < 0 {
+		return
+	}
+
+	names := make([]string, 0, len(cycle))
+	for _, order := range cycle {
+		names = append(names, declaredLockDisplayName(registry, order.Before))
+	}
+	message := "Declared lock orders form a cycle: " + strings.Join(append(names, names[0]), " before ")
+
+	pos := cycle[first].Pos
+	if reporter == nil || fset == nil || pos == token.NoPos {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	related := declaredLockOrderRelated(cycle, registry, fset)
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:     pos,
+		File:    position.Filename,
+		Line:    position.Line,
+		Column:  position.Column,
+		Rule:    report.RuleContradictoryContract,
+		Locks:   names,
+		Message: message,
+		Related: related,
+	})
+}
+
+// Report a sync.Cond Wait made without its lock held in the mode the Cond's
+// Locker releases it in: Wait panics unlocking it.
+func reportCondWaitUnlocked(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	condName string,
+	lockName string,
+	held LockMode,
+	want LockMode,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	message := "Function " + fnName + " waits on " + condName + " without holding its lock " + lockName
+	if held != LockNotHeld {
+		message = "Function " + fnName + " waits on " + condName + " holding its lock " + lockName + " in " + held.String() +
+			" mode, but Wait releases it in " + want.String() + " mode"
+	}
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCondWaitUnlocked,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+// Report a sync.Cond Wait made while holding a lock other than the Cond's:
+// it stays held while the goroutine is parked, so a goroutine that needs it
+// before it can signal never does.
+func reportCondWaitHoldingLock(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	condName string,
+	heldName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	message := "Function " + fnName + " waits on " + condName + " while holding lock " + heldName +
+		", which stays held while it waits; a goroutine that needs " + heldName + " to signal it deadlocks"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCondWaitHoldingLock,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{heldName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+// Report a call, made while holding a lock, of a function that waits on a
+// sync.Cond: see reportCondWaitHoldingLock.
+func reportCalleeCondWaitHoldingLock(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	callee *ssa.Function,
+	heldName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	message := "Function " + fnName + " calls " + callee.Name() + ", which waits on a sync.Cond, while holding lock " + heldName +
+		", which stays held while it waits; a goroutine that needs " + heldName + " to signal it deadlocks"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCondWaitHoldingLock,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{heldName},
+		Functions: []string{fnName, callee.Name()},
+		Message:   message,
+	})
+}
+
+func reportCondWaitOutsideLoop(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	condName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	message := "Heuristic: function " + fnName + " waits on " + condName +
+		" outside a loop; the condition may no longer hold when Wait returns, so recheck it in a loop"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.WarnHeuristic(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCondWaitOutsideLoop,
+		Function:  enclosingFunctionName(fn),
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+func reportCondSignalUnlocked(
+	msg *ssa.Call,
+	fn *ssa.Function,
+	condName string,
+	lockName string,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	method := msg.Call.StaticCallee().Name()
+	message := "Heuristic: function " + fnName + " calls " + condName + "." + method + " without ever taking its lock " + lockName +
+		"; a waiter that has checked its condition but not yet waited may miss it"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(msg.Pos())
+	reporter.WarnHeuristic(report.Diagnostic{
+		Pos:       msg.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleCondSignalUnlocked,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{lockName},
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+func reportBlockingUnderLock(
+	fn *ssa.Function,
+	instr ssa.Instruction,
+	operation string,
+	heldLocks LockSet,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	lockNames := lockSetDisplayNames(heldLocks)
+	message := "Heuristic: function " + fnName + " " + operation + " while holding lock(s) " + strings.Join(lockNames, ", ") +
+		"; goroutines that need them wait for as long as it blocks"
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(instr.Pos())
+	reporter.WarnHeuristic(report.Diagnostic{
+		Pos:       instr.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleBlockingUnderLock,
+		Function:  enclosingFunctionName(fn),
+		Locks:     lockNames,
+		Functions: []string{fnName},
+		Message:   message,
+	})
+}
+
+// Report a channel operation blocked while holding a lock that the
+// goroutine at the other end of the channel acquires first.
+func reportLockChannelDeadlock(
+	fn *ssa.Function,
+	instr ssa.Instruction,
+	deadlock lockChannelDeadlock,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	fnName := fn.Name()
+	goName := deadlock.Wait.Callee.Name()
+	chanName := channelDisplayName(deadlock.Op.Chan)
+	otherEnd := deadlock.Wait.Dir.verb() + " " + channelDisplayName(deadlock.Wait.Chan)
+	message := "Potential deadlock: function " + fnName + " " + deadlock.Op.Dir.verb() + " " + chanName +
+		" while holding lock " + deadlock.Lock + ", which goroutine " + goName + " acquires before it " + otherEnd
+
+	if reporter == nil || fset == nil {
+		logger.Warnf("%s", message)
+		return
+	}
+
+	position := fset.Position(instr.Pos())
+	reporter.Warn(report.Diagnostic{
+		Pos:       instr.Pos(),
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleLockChannelDeadlock,
+		Function:  enclosingFunctionName(fn),
+		Locks:     []string{deadlock.Lock},
+		Functions: []string{fnName, goName},
+		Message:   message,
+		Related: []report.RelatedPosition{
+			relatedPosition(fset, deadlock.Wait.Instr.Pos(), goName+" "+otherEnd+" after acquiring "+deadlock.Lock),
+			relatedPosition(fset, deadlock.Wait.GoInstr.Pos(), "go "+goName),
+		},
+	})
+}
+
+// Report a cycle of the combined lock/channel wait-for graph, starting with
+// the edge into a channel operation. Each edge is listed as a related
+// position.
+func reportLockChannelCycle(cycle []lockOrderEdge, reporter *report.Reporter, fset *token.FileSet) {
+	if len(cycle) == 0 || reporter == nil || fset == nil {
+		return
+	}
+
+	countByName := make(map[string]int, len(cycle))
+	for _, edge := range cycle {
+		if !edge.From.isChannel() {
+			countByName[lockDisplayName(edge.From)]++
+		}
+	}
+	lockName := func(lock lockRef) string {
+		name := lockDisplayName(lock)
+		if countByName[name] > 1 && lock.Obj != nil && lock.Root != nil {
+			name = lock.key().QualifiedName()
+		}
+		return name
+	}
+
+	locks := make([]string, 0, len(cycle))
+	functions := make([]string, 0, len(cycle))
+	steps := make([]string, 0, len(cycle))
+	related := make([]report.RelatedPosition, 0, len(cycle))
+	for _, edge := range cycle {
+		var step string
+		switch {
+		case edge.To.isChannel():
+			holder := lockName(edge.From)
+			locks = append(locks, holder)
+			functions = append(functions, edge.SiteFn.Name())
+			step = edge.SiteFn.Name() + " " + edge.To.Dir.verb() + " " + channelDisplayName(edge.To.Chan) + " while holding " + holder
+		case edge.From.isChannel():
+			goName := lockOrderSiteCallee(edge)
+			functions = append(functions, goName)
+			step = "goroutine " + goName + " acquires " + lockName(edge.To) + " before it " + edge.From.Dir.complement().verb() + " it"
+		default:
+			holder := lockName(edge.From)
+			locks = append(locks, holder)
+			functions = append(functions, edge.SiteFn.Name())
+			step = edge.SiteFn.Name() + " acquires " + lockName(edge.To) + " while holding " + holder
+		}
+		steps = append(steps, step)
+		pos := edge.Site.Pos()
+		if edge.From.isChannel() {
+			pos = edgePos(edge)
+		}
+		related = append(related, relatedPosition(fset, pos, step))
+	}
+
+	// The lock is held where the channel operation, or the call that
+	// performs it, is made.
+	pos := cycle[0].Site.Pos()
+	position := fset.Position(pos)
+	reporter.Warn(report.Diagnostic{
+		Pos:       pos,
+		File:      position.Filename,
+		Line:      position.Line,
+		Column:    position.Column,
+		Rule:      report.RuleLockChannelDeadlock,
+		Function:  enclosingFunctionName(cycle[0].SiteFn),
+		Locks:     locks,
+		Functions: functions,
+		Message:   "Potential deadlock cycle across locks and channels: " + strings.Join(steps, ", "),
+		Related:   related,
 	})
 }
@@ -86,7 +86,7 @@ func findFunctionByName(pkg *ssa.Package, name string) *ssa.Function {
 		return nil
 	}
 
-	for fn := range collectPackageFunctions(pkg) {
+	for fn := range collectPackageFunctions(pkg, newPackageScope(nil)) {
 		if fn != nil && fn.Name() == name {
 			return fn
 		}
@@ -137,7 +137,7 @@ func TestResolveDynamicCallTargets_FunctionParameterBinding(t *testing.T) {
 		t.Fatal("expected dynamic call in callThroughParam")
 	}
 
-	targets := resolveDynamicCallTargets(caller, dynCall)
+	targets := resolveDynamicCallTargets(caller, dynCall, newPackageScope(nil))
 	if !hasTargetByName(targets, "targetOne") {
 		t.Fatalf("expected targetOne in dynamic targets, got %d targets", len(targets))
 	}
@@ -155,7 +155,7 @@ func TestResolveDynamicCallTargets_InterfaceParameterBinding(t *testing.T) {
 		t.Fatal("expected dynamic interface call in callThroughInterface")
 	}
 
-	targets := resolveDynamicCallTargets(caller, dynCall)
+	targets := resolveDynamicCallTargets(caller, dynCall, newPackageScope(nil))
 	if !hasTargetByName(targets, "Do") {
 		t.Fatalf("expected worker.Do in dynamic interface targets, got %d targets", len(targets))
 	}
@@ -173,7 +173,7 @@ func TestResolveDynamicCallTargets_InterfaceParameterBindingViaGo(t *testing.T)
 		t.Fatal("expected dynamic interface call in runDoerInGoroutine")
 	}
 
-	targets := resolveDynamicCallTargets(caller, dynCall)
+	targets := resolveDynamicCallTargets(caller, dynCall, newPackageScope(nil))
 	if !hasTargetByName(targets, "Do") {
 		t.Fatalf("expected worker.Do in dynamic interface targets via go callsite, got %d targets", len(targets))
 	}
@@ -181,7 +181,7 @@ func TestResolveDynamicCallTargets_InterfaceParameterBindingViaGo(t *testing.T)
 
 func TestBuildRecursionGraph_UsesDynamicTargets(t *testing.T) {
 	pkg := buildTestSSAPackageFromFile(t, dynamicDispatchFixturePath(t))
-	graph := buildRecursionGraph(pkg)
+	graph := buildRecursionGraph(pkg, newPackageScope(nil))
 
 	caller := findFunctionByName(pkg, "dynamicTrampoline")
 	target := findFunctionByName(pkg, "recursiveDriver")
@@ -210,7 +210,7 @@ func TestCollectDeferredCallLockEffects_Serving3148_NoStackOverflow(t *testing.T
 			}
 
 			foundDefer = true
-			locks, unlocks := collectDeferredCallLockEffects(&deferInstr.Call)
+			locks, unlocks := collectDeferredCallLockEffects(&deferInstr.Call, newPackageScope(nil))
 			if locks == nil || unlocks == nil {
 				t.Fatal("expected non-nil lock effect sets")
 			}
@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"go/types"
+	"strings"
 
 	"golang.org/x/tools/go/ssa"
 )
@@ -247,7 +248,7 @@ func appendUniqueFunction(targets []*ssa.Function, fn *ssa.Function, seen map[*s
 	return append(targets, fn)
 }
 
-func resolveParameterBindingTargets(fn *ssa.Function, param *ssa.Parameter, pkg *ssa.Package) []*ssa.Function {
+func resolveParameterBindingTargets(fn *ssa.Function, param *ssa.Parameter, pkg *ssa.Package, scope *analysisScope) []*ssa.Function {
 	if fn == nil || param == nil || pkg == nil {
 		return nil
 	}
@@ -266,7 +267,7 @@ func resolveParameterBindingTargets(fn *ssa.Function, param *ssa.Parameter, pkg
 	seen := make(map[*ssa.Function]bool)
 	out := make([]*ssa.Function, 0)
 
-	for caller := range collectPackageFunctions(pkg) {
+	for caller := range collectPackageFunctions(pkg, scope) {
 		for _, block := range caller.Blocks {
 			for _, instr := range block.Instrs {
 				switch callLike := instr.(type) {
@@ -315,6 +316,7 @@ func resolveParameterBindingMethodTargets(
 	param *ssa.Parameter,
 	pkg *ssa.Package,
 	methodName string,
+	scope *analysisScope,
 ) []*ssa.Function {
 	if fn == nil || param == nil || pkg == nil || methodName == "" {
 		return nil
@@ -334,7 +336,7 @@ func resolveParameterBindingMethodTargets(
 	seen := make(map[*ssa.Function]bool)
 	out := make([]*ssa.Function, 0)
 
-	for caller := range collectPackageFunctions(pkg) {
+	for caller := range collectPackageFunctions(pkg, scope) {
 		for _, block := range caller.Blocks {
 			for _, instr := range block.Instrs {
 				switch callLike := instr.(type) {
@@ -386,7 +388,7 @@ func resolveParameterBindingMethodTargets(
 	return out
 }
 
-func resolveFreeVarBindingTargets(fn *ssa.Function, freeVar *ssa.FreeVar, pkg *ssa.Package) []*ssa.Function {
+func resolveFreeVarBindingTargets(fn *ssa.Function, freeVar *ssa.FreeVar, pkg *ssa.Package, scope *analysisScope) []*ssa.Function {
 	if fn == nil || freeVar == nil || pkg == nil {
 		return nil
 	}
@@ -415,7 +417,7 @@ func resolveFreeVarBindingTargets(fn *ssa.Function, freeVar *ssa.FreeVar, pkg *s
 	seen := make(map[*ssa.Function]bool)
 	out := make([]*ssa.Function, 0)
 
-	for caller := range collectPackageFunctions(pkg) {
+	for caller := range collectPackageFunctions(pkg, scope) {
 		for _, block := range caller.Blocks {
 			for _, instr := range block.Instrs {
 				closure, ok := instr.(*ssa.MakeClosure)
@@ -439,7 +441,7 @@ func resolveFreeVarBindingTargets(fn *ssa.Function, freeVar *ssa.FreeVar, pkg *s
 				}
 
 				if param := resolveParameterFromValue(bound); param != nil {
-					for _, boundTarget := range resolveParameterBindingTargets(caller, param, pkg) {
+					for _, boundTarget := range resolveParameterBindingTargets(caller, param, pkg, scope) {
 						out = appendUniqueFunction(out, boundTarget, seen)
 					}
 				}
@@ -450,47 +452,57 @@ func resolveFreeVarBindingTargets(fn *ssa.Function, freeVar *ssa.FreeVar, pkg *s
 	return out
 }
 
-func resolveDynamicCallTargets(callerFn *ssa.Function, msg *ssa.Call) []*ssa.Function {
-	if callerFn == nil || msg == nil {
+func resolveDynamicCallTargets(callerFn *ssa.Function, msg *ssa.Call, scope *analysisScope) []*ssa.Function {
+	if msg == nil {
+		return nil
+	}
+	return resolveDynamicCallCommonTargets(callerFn, &msg.Call, scope)
+}
+
+// The functions a dynamic call, made in callerFn, may invoke: closures and
+// function values traced to their definitions, and the methods of the
+// concrete types that may flow into an interface receiver.
+func resolveDynamicCallCommonTargets(callerFn *ssa.Function, common *ssa.CallCommon, scope *analysisScope) []*ssa.Function {
+	if callerFn == nil || common == nil {
 		return nil
 	}
 
 	targets := make([]*ssa.Function, 0)
 	seen := make(map[*ssa.Function]bool)
 
-	if direct := resolveFunctionFromValue(msg.Call.Value); direct != nil {
+	if direct := resolveFunctionFromValue(common.Value); direct != nil {
 		targets = appendUniqueFunction(targets, direct, seen)
 	}
 
 	if callerFn.Pkg != nil {
-		if param := resolveParameterFromValue(msg.Call.Value); param != nil {
-			for _, bound := range resolveParameterBindingTargets(callerFn, param, callerFn.Pkg) {
+		if param := resolveParameterFromValue(common.Value); param != nil {
+			for _, bound := range resolveParameterBindingTargets(callerFn, param, callerFn.Pkg, scope) {
 				targets = appendUniqueFunction(targets, bound, seen)
 			}
 
-			if msg.Call.Method != nil {
-				for _, bound := range resolveParameterBindingMethodTargets(callerFn, param, callerFn.Pkg, msg.Call.Method.Name()) {
+			if common.Method != nil {
+				for _, bound := range resolveParameterBindingMethodTargets(callerFn, param, callerFn.Pkg, common.Method.Name(), scope) {
 					targets = appendUniqueFunction(targets, bound, seen)
 				}
 			}
 		}
 
-		if freeVar := resolveFreeVarFromValue(msg.Call.Value); freeVar != nil {
-			for _, bound := range resolveFreeVarBindingTargets(callerFn, freeVar, callerFn.Pkg) {
+		if freeVar := resolveFreeVarFromValue(common.Value); freeVar != nil {
+			for _, bound := range resolveFreeVarBindingTargets(callerFn, freeVar, callerFn.Pkg, scope) {
 				targets = appendUniqueFunction(targets, bound, seen)
 			}
 		}
 	}
 
-	if msg.Call.Method != nil {
-		for _, recvType := range resolveConcreteTypesFromValue(msg.Call.Value) {
-			for _, target := range resolveMethodTargetsForType(callerFn.Pkg, recvType, msg.Call.Method.Name()) {
+	if common.Method != nil {
+		for _, recvType := range resolveConcreteTypesFromValue(common.Value) {
+			for _, target := range resolveMethodTargetsForType(callerFn.Pkg, recvType, common.Method.Name()) {
 				targets = appendUniqueFunction(targets, target, seen)
 			}
 		}
 	}
 
-	unop, ok := msg.Call.Value.(*ssa.UnOp)
+	unop, ok := common.Value.(*ssa.UnOp)
 	if !ok {
 		return targets
 	}
@@ -500,7 +512,7 @@ func resolveDynamicCallTargets(callerFn *ssa.Function, msg *ssa.Call) []*ssa.Fun
 		return targets
 	}
 
-	for fn := range collectPackageFunctions(callerFn.Pkg) {
+	for fn := range collectPackageFunctions(callerFn.Pkg, scope) {
 		for _, block := range fn.Blocks {
 			for _, instr := range block.Instrs {
 				store, ok := instr.(*ssa.Store)
@@ -527,12 +539,12 @@ func resolveDynamicCallTargets(callerFn *ssa.Function, msg *ssa.Call) []*ssa.Fun
 				if target == nil {
 					param := resolveParameterFromValue(store.Val)
 					if param != nil {
-						for _, bound := range resolveParameterBindingTargets(fn, param, callerFn.Pkg) {
+						for _, bound := range resolveParameterBindingTargets(fn, param, callerFn.Pkg, scope) {
 							targets = appendUniqueFunction(targets, bound, seen)
 						}
 
-						if msg.Call.Method != nil {
-							for _, bound := range resolveParameterBindingMethodTargets(fn, param, callerFn.Pkg, msg.Call.Method.Name()) {
+						if common.Method != nil {
+							for _, bound := range resolveParameterBindingMethodTargets(fn, param, callerFn.Pkg, common.Method.Name(), scope) {
 								targets = appendUniqueFunction(targets, bound, seen)
 							}
 						}
@@ -544,3 +556,21 @@ func resolveDynamicCallTargets(callerFn *ssa.Function, msg *ssa.Call) []*ssa.Fun
 
 	return targets
 }
+
+// The method a method value's synthetic wrapper (e.g., "(*T).flush$bound")
+// calls, or fn itself for any other function. Annotations name the method's
+// own receiver and parameters.
+func boundMethodTarget(fn *ssa.Function) *ssa.Function {
+	if fn == nil || fn.Prog == nil || len(fn.FreeVars) != 1 || !strings.HasSuffix(fn.Name(), "$bound") {
+		return fn
+	}
+
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		return fn
+	}
+	if method := fn.Prog.FuncValue(obj); method != nil {
+		return method
+	}
+	return fn
+}
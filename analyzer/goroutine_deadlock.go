@@ -5,13 +5,66 @@ import (
 	"go/types"
 	"gotsan/ir"
 	"gotsan/utils/report"
+	"slices"
+	"sort"
 
 	"golang.org/x/tools/go/ssa"
 )
 
+// lockRef is a lock observed in an acquisition order. Obj, Root and Path
+// carry its lockKey identity; Name is the annotation target it came from.
+// Mode is how the lock is taken; the zero value counts as exclusive.
+// Instr is the call in Fn through which the acquisition was observed.
+//
+// A lockRef with Chan set is not a lock but a channel operation, a node of
+// the combined lock/channel wait-for graph (see detectLockChannelCycles):
+// Instr, in Fn, blocked on Chan in direction Dir until a goroutine gets to
+// the other end.
 type lockRef struct {
-	Obj  types.Object
-	Name string
+	Obj   types.Object
+	Root  ssa.Value
+	Path  string
+	Name  string
+	Mode  LockMode
+	Fn    *ssa.Function
+	Instr ssa.Instruction
+	Chan  ssa.Value
+	Dir   channelDirection
+}
+
+func lockRefForKey(key lockKey, name string, mode LockMode) lockRef {
+	return lockRef{Obj: key.Obj, Root: key.Root, Path: key.Path, Name: name, Mode: mode}
+}
+
+func channelRef(op channelOp, instr ssa.Instruction) lockRef {
+	return lockRef{Fn: instr.Parent(), Instr: instr, Chan: op.Chan, Dir: op.Dir}
+}
+
+func (l lockRef) isChannel() bool {
+	return l.Chan != nil
+}
+
+// atSite attributes an acquisition not yet tied to a call to instr in fn.
+func (l lockRef) atSite(fn *ssa.Function, instr ssa.Instruction) lockRef {
+	if l.Instr == nil {
+		l.Fn = fn
+		l.Instr = instr
+	}
+	return l
+}
+
+func (l lockRef) shared() bool {
+	return l.Mode == LockShared
+}
+
+// Two acquisitions of the same lock only exclude each other if at least one
+// of them is a write lock.
+func acquisitionsConflict(a lockRef, b lockRef) bool {
+	return !a.shared() || !b.shared()
+}
+
+func (l lockRef) key() lockKey {
+	return lockKey{Root: l.Root, Path: l.Path, Obj: l.Obj}
 }
 
 type goroutineAcquireSite struct {
@@ -29,7 +82,7 @@ type functionCallSite struct {
 func firstRepeatedLock(order []lockRef) (lockRef, bool) {
 	for i := 0; i < len(order); i++ {
 		for j := i + 1; j < len(order); j++ {
-			if sameLock(order[i], order[j]) {
+			if sameLock(order[i], order[j]) && acquisitionsConflict(order[i], order[j]) {
 				return order[i], true
 			}
 		}
@@ -42,6 +95,17 @@ func containsLock(order []lockRef, lock lockRef) bool {
 	return indexOfLock(order, lock) != -1
 }
 
+// containsConflictingLock reports whether order acquires lock in a mode
+// that excludes the given acquisition.
+func containsConflictingLock(order []lockRef, lock lockRef) bool {
+	for _, curr := range order {
+		if sameLock(curr, lock) && acquisitionsConflict(curr, lock) {
+			return true
+		}
+	}
+	return false
+}
+
 func lockDisplayName(l lockRef) string {
 	if l.Obj != nil {
 		return l.Obj.Name()
@@ -52,10 +116,32 @@ func lockDisplayName(l lockRef) string {
 	return "<unknown lock>"
 }
 
+// Display names for two locks reported together. Distinct instances of the
+// same field are disambiguated by their access path (e.g., "a.mu", "b.mu").
+func lockPairDisplayNames(a lockRef, b lockRef) (string, string) {
+	nameA := lockDisplayName(a)
+	nameB := lockDisplayName(b)
+	if nameA != nameB {
+		return nameA, nameB
+	}
+
+	if a.Obj != nil && a.Root != nil {
+		nameA = a.key().QualifiedName()
+	}
+	if b.Obj != nil && b.Root != nil {
+		nameB = b.key().QualifiedName()
+	}
+	return nameA, nameB
+}
+
 func sameLock(a lockRef, b lockRef) bool {
+	if a.isChannel() || b.isChannel() {
+		return a.Chan == b.Chan && a.Dir == b.Dir && a.Instr == b.Instr
+	}
 	if a.Obj != nil && b.Obj != nil {
 		if a.Obj == b.Obj {
-			return true
+			// Distinct instances of the same field are different locks.
+			return equivalentLockKeys(a.key(), b.key())
 		}
 	}
 	if a.Name != "" && b.Name != "" {
@@ -88,6 +174,11 @@ func findOrderInversion(a []lockRef, b []lockRef) (lockRef, lockRef, bool) {
 				continue
 			}
 
+			// Neither side blocks the other on a lock both only read-lock.
+			if !acquisitionsConflict(first, b[posFirst]) || !acquisitionsConflict(second, b[posSecond]) {
+				continue
+			}
+
 			if posSecond < posFirst {
 				return first, second, true
 			}
@@ -97,7 +188,22 @@ func findOrderInversion(a []lockRef, b []lockRef) (lockRef, lockRef, bool) {
 	return lockRef{}, lockRef{}, false
 }
 
-func acquireOrderForGoCall(goInstr *ssa.Go, callee *ssa.Function, contract *ir.FunctionContract) []lockRef {
+// The mode in which callee acquires an @acquires target, judged from its
+// lock calls; targets it never locks directly count as exclusive.
+func acquireModeForTarget(callee *ssa.Function, target string, scope *analysisScope) LockMode {
+	key := resolveLockKeyInScope(callee, target)
+	if key.IsZero() {
+		return LockExclusive
+	}
+
+	acquired, _ := collectFunctionLockEffects(callee, make(map[*ssa.Function]bool), scope)
+	if mode := acquired.ModeOf(key); mode != LockNotHeld {
+		return mode
+	}
+	return LockExclusive
+}
+
+func acquireOrderForGoCall(goInstr *ssa.Go, callee *ssa.Function, contract *ir.FunctionContract, scope *analysisScope) []lockRef {
 	if goInstr == nil || callee == nil || contract == nil {
 		return nil
 	}
@@ -109,14 +215,14 @@ func acquireOrderForGoCall(goInstr *ssa.Go, callee *ssa.Function, contract *ir.F
 
 	order := make([]lockRef, 0, len(acquires))
 	for _, req := range acquires {
-		obj := resolveObjectAtInvocation(callee, goInstr.Call.Args, req.Target)
-		order = append(order, lockRef{Obj: obj, Name: req.Target})
+		key := resolveLockKeyAtInvocation(callee, goInstr.Call.Args, req.Target)
+		order = append(order, lockRefForKey(key, req.Target, acquireModeForTarget(callee, req.Target, scope)))
 	}
 
 	return order
 }
 
-func acquireOrderForCall(callInstr *ssa.Call, callee *ssa.Function, contract *ir.FunctionContract) []lockRef {
+func acquireOrderForCall(callInstr *ssa.Call, callee *ssa.Function, contract *ir.FunctionContract, scope *analysisScope) []lockRef {
 	if callInstr == nil || callee == nil || contract == nil {
 		return nil
 	}
@@ -128,8 +234,8 @@ func acquireOrderForCall(callInstr *ssa.Call, callee *ssa.Function, contract *ir
 
 	order := make([]lockRef, 0, len(acquires))
 	for _, req := range acquires {
-		obj := resolveObjectAtInvocation(callee, callInstr.Call.Args, req.Target)
-		order = append(order, lockRef{Obj: obj, Name: req.Target})
+		key := resolveLockKeyAtInvocation(callee, callInstr.Call.Args, req.Target)
+		order = append(order, lockRefForKey(key, req.Target, acquireModeForTarget(callee, req.Target, scope)))
 	}
 
 	return order
@@ -145,7 +251,7 @@ func appendLockIfMissing(order []lockRef, lock lockRef) []lockRef {
 	return append(order, lock)
 }
 
-func resolveGoCallTargets(callerFn *ssa.Function, goInstr *ssa.Go) []*ssa.Function {
+func resolveGoCallTargets(callerFn *ssa.Function, goInstr *ssa.Go, scope *analysisScope) []*ssa.Function {
 	if callerFn == nil || goInstr == nil {
 		return nil
 	}
@@ -163,12 +269,12 @@ func resolveGoCallTargets(callerFn *ssa.Function, goInstr *ssa.Go) []*ssa.Functi
 
 	if callerFn.Pkg != nil {
 		if param := resolveParameterFromValue(goInstr.Call.Value); param != nil {
-			for _, bound := range resolveParameterBindingTargets(callerFn, param, callerFn.Pkg) {
+			for _, bound := range resolveParameterBindingTargets(callerFn, param, callerFn.Pkg, scope) {
 				targets = appendUniqueFunction(targets, bound, seen)
 			}
 
 			if goInstr.Call.Method != nil {
-				for _, bound := range resolveParameterBindingMethodTargets(callerFn, param, callerFn.Pkg, goInstr.Call.Method.Name()) {
+				for _, bound := range resolveParameterBindingMethodTargets(callerFn, param, callerFn.Pkg, goInstr.Call.Method.Name(), scope) {
 					targets = appendUniqueFunction(targets, bound, seen)
 				}
 			}
@@ -190,6 +296,7 @@ func collectTransitiveAcquireOrder(
 	callee *ssa.Function,
 	invocationArgs []ssa.Value,
 	registry *ir.ContractRegistry,
+	scope *analysisScope,
 	active map[*ssa.Function]bool,
 ) []lockRef {
 	if callee == nil || registry == nil {
@@ -210,8 +317,8 @@ func collectTransitiveAcquireOrder(
 	if contract != nil {
 		acquires := contract.Expectations[ir.Acquires]
 		for _, req := range acquires {
-			obj := resolveObjectAtInvocation(callee, invocationArgs, req.Target)
-			order = append(order, lockRef{Obj: obj, Name: req.Target})
+			key := resolveLockKeyAtInvocation(callee, invocationArgs, req.Target)
+			order = append(order, lockRefForKey(key, req.Target, acquireModeForTarget(callee, req.Target, scope)))
 		}
 	}
 
@@ -227,7 +334,7 @@ func collectTransitiveAcquireOrder(
 			if nestedCallee := callInstr.Call.StaticCallee(); nestedCallee != nil {
 				targets = appendUniqueFunction(targets, nestedCallee, seenTargets)
 			} else {
-				for _, dynamicTarget := range resolveDynamicCallTargets(callee, callInstr) {
+				for _, dynamicTarget := range resolveDynamicCallTargets(callee, callInstr, scope) {
 					targets = appendUniqueFunction(targets, dynamicTarget, seenTargets)
 				}
 			}
@@ -237,8 +344,15 @@ func collectTransitiveAcquireOrder(
 					continue
 				}
 
-				nestedOrder := collectTransitiveAcquireOrder(target, callInstr.Call.Args, registry, active)
-				order = append(order, nestedOrder...)
+				// Nested orders are in callee's frame; map them into the
+				// frame of the invocation being summarized.
+				nestedOrder := collectTransitiveAcquireOrder(target, callInstr.Call.Args, registry, scope, active)
+				for _, nested := range nestedOrder {
+					translated := translateLockKey(nested.key(), callee, invocationArgs, nil)
+					ref := lockRefForKey(translated, nested.Name, nested.Mode)
+					ref.Fn, ref.Instr = nested.Fn, nested.Instr
+					order = append(order, ref.atSite(callee, callInstr))
+				}
 			}
 		}
 	}
@@ -246,12 +360,12 @@ func collectTransitiveAcquireOrder(
 	return order
 }
 
-func acquireOrderForGoSite(callerFn *ssa.Function, goInstr *ssa.Go, registry *ir.ContractRegistry) []lockRef {
+func acquireOrderForGoSite(callerFn *ssa.Function, goInstr *ssa.Go, registry *ir.ContractRegistry, scope *analysisScope) []lockRef {
 	if callerFn == nil || goInstr == nil || registry == nil {
 		return nil
 	}
 
-	targets := resolveGoCallTargets(callerFn, goInstr)
+	targets := resolveGoCallTargets(callerFn, goInstr, scope)
 	if len(targets) == 0 {
 		return nil
 	}
@@ -261,14 +375,16 @@ func acquireOrderForGoSite(callerFn *ssa.Function, goInstr *ssa.Go, registry *ir
 		if callee == nil {
 			continue
 		}
-		nested := collectTransitiveAcquireOrder(callee, goInstr.Call.Args, registry, map[*ssa.Function]bool{})
-		order = append(order, nested...)
+		nested := collectTransitiveAcquireOrder(callee, goInstr.Call.Args, registry, scope, map[*ssa.Function]bool{})
+		for _, ref := range nested {
+			order = append(order, ref.atSite(callerFn, goInstr))
+		}
 	}
 
 	return order
 }
 
-func acquireOrderForCallSite(callerFn *ssa.Function, callInstr *ssa.Call, registry *ir.ContractRegistry) []lockRef {
+func acquireOrderForCallSite(callerFn *ssa.Function, callInstr *ssa.Call, registry *ir.ContractRegistry, scope *analysisScope) []lockRef {
 	if callerFn == nil || callInstr == nil || registry == nil {
 		return nil
 	}
@@ -278,7 +394,7 @@ func acquireOrderForCallSite(callerFn *ssa.Function, callInstr *ssa.Call, regist
 	if callee := callInstr.Call.StaticCallee(); callee != nil {
 		targets = appendUniqueFunction(targets, callee, seenTargets)
 	} else {
-		for _, dynamicTarget := range resolveDynamicCallTargets(callerFn, callInstr) {
+		for _, dynamicTarget := range resolveDynamicCallTargets(callerFn, callInstr, scope) {
 			targets = appendUniqueFunction(targets, dynamicTarget, seenTargets)
 		}
 	}
@@ -292,8 +408,10 @@ func acquireOrderForCallSite(callerFn *ssa.Function, callInstr *ssa.Call, regist
 		if callee == nil {
 			continue
 		}
-		nested := collectTransitiveAcquireOrder(callee, callInstr.Call.Args, registry, map[*ssa.Function]bool{})
-		order = append(order, nested...)
+		nested := collectTransitiveAcquireOrder(callee, callInstr.Call.Args, registry, scope, map[*ssa.Function]bool{})
+		for _, ref := range nested {
+			order = append(order, ref.atSite(callerFn, callInstr))
+		}
 	}
 
 	return order
@@ -302,6 +420,7 @@ func acquireOrderForCallSite(callerFn *ssa.Function, callInstr *ssa.Call, regist
 func detectGoroutineLockOrderInversions(
 	fn *ssa.Function,
 	registry *ir.ContractRegistry,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
@@ -318,7 +437,7 @@ func detectGoroutineLockOrderInversions(
 			}
 
 			callee := goInstr.Call.StaticCallee()
-			order := acquireOrderForGoSite(fn, goInstr, registry)
+			order := acquireOrderForGoSite(fn, goInstr, registry, scope)
 			if len(order) == 0 {
 				continue
 			}
@@ -337,7 +456,7 @@ func detectGoroutineLockOrderInversions(
 	for i := 0; i < len(sites); i++ {
 		for j := i + 1; j < len(sites); j++ {
 			repeatedLockA, repeatedA := firstRepeatedLock(sites[i].Order)
-			if repeatedA && containsLock(sites[j].Order, repeatedLockA) {
+			if repeatedA && containsConflictingLock(sites[j].Order, repeatedLockA) {
 				reportGoroutineRecursiveLockPotentialDeadlock(
 					sites[i].GoInstr,
 					sites[j].GoInstr,
@@ -350,7 +469,7 @@ func detectGoroutineLockOrderInversions(
 			}
 
 			repeatedLockB, repeatedB := firstRepeatedLock(sites[j].Order)
-			if repeatedB && containsLock(sites[i].Order, repeatedLockB) {
+			if repeatedB && containsConflictingLock(sites[i].Order, repeatedLockB) {
 				reportGoroutineRecursiveLockPotentialDeadlock(
 					sites[j].GoInstr,
 					sites[i].GoInstr,
@@ -367,13 +486,14 @@ func detectGoroutineLockOrderInversions(
 				continue
 			}
 
+			firstName, secondName := lockPairDisplayNames(firstLock, secondLock)
 			reportGoroutineLockOrderInversion(
 				sites[i].GoInstr,
 				sites[j].GoInstr,
 				sites[i].Callee,
 				sites[j].Callee,
-				lockDisplayName(firstLock),
-				lockDisplayName(secondLock),
+				firstName,
+				secondName,
 				reporter,
 				fset,
 			)
@@ -384,6 +504,7 @@ func detectGoroutineLockOrderInversions(
 func detectSingleThreadedLockOrderInversions(
 	fn *ssa.Function,
 	registry *ir.ContractRegistry,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
@@ -404,7 +525,7 @@ func detectSingleThreadedLockOrderInversions(
 				continue
 			}
 
-			order := acquireOrderForCallSite(fn, callInstr, registry)
+			order := acquireOrderForCallSite(fn, callInstr, registry, scope)
 			if len(order) < 2 {
 				continue
 			}
@@ -424,13 +545,14 @@ func detectSingleThreadedLockOrderInversions(
 				continue
 			}
 
+			firstName, secondName := lockPairDisplayNames(firstLock, secondLock)
 			reportSingleThreadedLockOrderInversion(
 				sites[i].CallInstr,
 				sites[j].CallInstr,
 				sites[i].Callee,
 				sites[j].Callee,
-				lockDisplayName(firstLock),
-				lockDisplayName(secondLock),
+				firstName,
+				secondName,
 				reporter,
 				fset,
 			)
@@ -441,6 +563,7 @@ func detectSingleThreadedLockOrderInversions(
 func detectPackageWideGoroutineLockOrderInversions(
 	pkg *ssa.Package,
 	registry *ir.ContractRegistry,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
@@ -449,7 +572,7 @@ func detectPackageWideGoroutineLockOrderInversions(
 	}
 
 	sites := make([]goroutineAcquireSite, 0)
-	for fn := range collectPackageFunctions(pkg) {
+	for fn := range collectPackageFunctions(pkg, scope) {
 		if fn == nil || len(fn.Blocks) == 0 {
 			continue
 		}
@@ -461,7 +584,7 @@ func detectPackageWideGoroutineLockOrderInversions(
 					continue
 				}
 
-				order := acquireOrderForGoSite(fn, goInstr, registry)
+				order := acquireOrderForGoSite(fn, goInstr, registry, scope)
 				if len(order) == 0 {
 					continue
 				}
@@ -483,7 +606,7 @@ func detectPackageWideGoroutineLockOrderInversions(
 	for i := 0; i < len(sites); i++ {
 		for j := i + 1; j < len(sites); j++ {
 			repeatedLockA, repeatedA := firstRepeatedLock(sites[i].Order)
-			if repeatedA && containsLock(sites[j].Order, repeatedLockA) {
+			if repeatedA && containsConflictingLock(sites[j].Order, repeatedLockA) {
 				reportGoroutineRecursiveLockPotentialDeadlock(
 					sites[i].GoInstr,
 					sites[j].GoInstr,
@@ -496,7 +619,7 @@ func detectPackageWideGoroutineLockOrderInversions(
 			}
 
 			repeatedLockB, repeatedB := firstRepeatedLock(sites[j].Order)
-			if repeatedB && containsLock(sites[i].Order, repeatedLockB) {
+			if repeatedB && containsConflictingLock(sites[i].Order, repeatedLockB) {
 				reportGoroutineRecursiveLockPotentialDeadlock(
 					sites[j].GoInstr,
 					sites[i].GoInstr,
@@ -513,16 +636,209 @@ func detectPackageWideGoroutineLockOrderInversions(
 				continue
 			}
 
+			firstName, secondName := lockPairDisplayNames(firstLock, secondLock)
 			reportGoroutineLockOrderInversion(
 				sites[i].GoInstr,
 				sites[j].GoInstr,
 				sites[i].Callee,
 				sites[j].Callee,
-				lockDisplayName(firstLock),
-				lockDisplayName(secondLock),
+				firstName,
+				secondName,
 				reporter,
 				fset,
 			)
 		}
 	}
 }
+
+// Combined lock/channel wait-for graph. A goroutine blocked on a channel
+// operation waits for a goroutine to get to the other end, and that
+// goroutine first has to acquire the locks it takes on the way there. Edges
+// run from each lock held to the lock or channel operation waited for while
+// holding it, and from each channel operation to the locks a goroutine at
+// the other end acquires first. A cycle through a channel operation is a
+// deadlock between the goroutines that contributed its edges.
+func detectLockChannelCycles(pkg *ssa.Package, reporter *report.Reporter, fset *token.FileSet, scope *analysisScope) {
+	if pkg == nil {
+		return
+	}
+
+	functions := make([]*ssa.Function, 0)
+	for fn := range collectPackageFunctions(pkg, scope) {
+		if fn != nil && len(fn.Blocks) > 0 {
+			functions = append(functions, fn)
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Pos() != functions[j].Pos() {
+			return functions[i].Pos() < functions[j].Pos()
+		}
+		return functions[i].String() < functions[j].String()
+	})
+
+	graph := newLockOrderGraph()
+	for _, fn := range functions {
+		addHeldWaitEdges(graph, fn, scope)
+	}
+	addCounterpartEdges(graph, scope.goroutineWaits, scope)
+	graph.reportChannelWaitCycles(reporter, fset)
+}
+
+// Add the edges fn contributes while holding locks: to each lock it
+// acquires and each channel operation it blocks on, directly or in a
+// callee, from every lock it may hold at that point.
+func addHeldWaitEdges(graph *lockOrderGraph, fn *ssa.Function, scope *analysisScope) {
+	entry := mayHeldAtBlockEntry(fn, scope)
+	for _, block := range fn.Blocks {
+		held := entry[block.Index].Copy()
+		for _, instr := range block.Instrs {
+			if len(held) > 0 {
+				for _, to := range waitedForBy(fn, instr, scope) {
+					for _, key := range sortedLockKeys(held) {
+						if !to.isChannel() && equivalentLockKeys(key, to.key()) {
+							continue
+						}
+						graph.addEdge(lockRefForKey(key, key.Name(), held[key]), to, fn, instr)
+					}
+				}
+			}
+			applyHeldEffect(held, instr, scope)
+		}
+	}
+}
+
+// The locks and channel operations instr waits for: the lock a lock call
+// acquires, the channel operation it performs, or those of a callee.
+// Selects with several cases are left out: another case may proceed.
+func waitedForBy(fn *ssa.Function, instr ssa.Instruction, scope *analysisScope) []lockRef {
+	if ops := blockingChannelOps(instr); len(ops) == 1 {
+		return []lockRef{channelRef(ops[0], instr)}
+	}
+
+	call, ok := instr.(*ssa.Call)
+	if !ok || isUnlockCall(call, scope) {
+		return nil
+	}
+
+	if isLockCall(call, scope) {
+		key := getLockKey(call)
+		if key.IsZero() {
+			return nil
+		}
+		ref := lockRefForKey(key, key.Name(), lockModeForCallCommon(&call.Call, scope))
+		ref.Fn, ref.Instr = fn, call
+		return []lockRef{ref}
+	}
+
+	callee := call.Call.StaticCallee()
+	if callee == nil || !sharesAnalysisScope(fn, callee, scope) {
+		return nil
+	}
+
+	refs := make([]lockRef, 0)
+	acquired, _ := collectFunctionLockEffects(callee, make(map[*ssa.Function]bool), scope)
+	acquired = translateLockSet(acquired, callee, &call.Call)
+	for _, key := range sortedLockKeys(acquired) {
+		ref := lockRefForKey(key, key.Name(), acquired[key])
+		ref.Fn, ref.Instr = fn, call
+		refs = append(refs, ref)
+	}
+	for _, wait := range collectChannelWaits(callee, make(map[*ssa.Function]bool), scope) {
+		if len(blockingChannelOps(wait.Instr)) == 1 {
+			refs = append(refs, channelRef(wait.channelOp, wait.Instr))
+		}
+	}
+	return refs
+}
+
+// Add, for every channel operation in graph, an edge to each lock a
+// goroutine at the other end of the channel acquires before getting there.
+func addCounterpartEdges(graph *lockOrderGraph, waits []goroutineChannelWait, scope *analysisScope) {
+	for _, node := range slices.Clone(graph.nodes) {
+		if !node.isChannel() {
+			continue
+		}
+
+		nodeOrigins := channelOrigins(node.Chan, scope)
+		for _, wait := range waits {
+			if wait.Dir != node.Dir.complement() || !channelsMayAlias(nodeOrigins, channelOrigins(wait.Chan, scope)) {
+				continue
+			}
+			for _, key := range sortedLockKeys(wait.Before) {
+				to := lockRefForKey(key, key.Name(), wait.Before[key])
+				to.Fn, to.Instr = wait.Instr.Parent(), wait.Instr
+				graph.addEdge(node, to, wait.GoInstr.Parent(), wait.GoInstr)
+			}
+		}
+	}
+}
+
+// The locks fn may hold at the start of each block, by block index.
+// Deferred releases only happen on return and are ignored.
+func mayHeldAtBlockEntry(fn *ssa.Function, scope *analysisScope) []LockSet {
+	entry := make([]LockSet, len(fn.Blocks))
+	for _, block := range fn.Blocks {
+		entry[block.Index] = make(LockSet)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, block := range fn.Blocks {
+			out := entry[block.Index].Copy()
+			for _, instr := range block.Instrs {
+				applyHeldEffect(out, instr, scope)
+			}
+			for _, succ := range block.Succs {
+				for key, mode := range out {
+					if entry[succ.Index][key] < mode {
+						entry[succ.Index].Add(key, mode)
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return entry
+}
+
+func applyHeldEffect(held LockSet, instr ssa.Instruction, scope *analysisScope) {
+	call, ok := instr.(*ssa.Call)
+	if !ok {
+		return
+	}
+	if isLockCall(call, scope) {
+		if key := getLockKey(call); !key.IsZero() {
+			held.Add(key, lockModeForCallCommon(&call.Call, scope))
+		}
+	} else if isUnlockCall(call, scope) {
+		if key := getLockKey(call); !key.IsZero() {
+			held.Remove(key)
+		}
+	}
+}
+
+// The keys of locks in a stable order, so graphs are built the same way on
+// every run.
+func sortedLockKeys(locks LockSet) []lockKey {
+	keys := make([]lockKey, 0, len(locks))
+	for key := range locks {
+		if !key.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		nameI, nameJ := keys[i].QualifiedName(), keys[j].QualifiedName()
+		if nameI != nameJ {
+			return nameI < nameJ
+		}
+		return rootPos(keys[i]) < rootPos(keys[j])
+	})
+	return keys
+}
+
+func rootPos(key lockKey) token.Pos {
+	if key.Root == nil {
+		return token.NoPos
+	}
+	return key.Root.Pos()
+}
@@ -126,6 +126,34 @@ func TestFirstRepeatedLock(t *testing.T) {
 	}
 }
 
+func TestSharedAcquisitionsDoNotConflict(t *testing.T) {
+	readA := lockRef{Name: "a", Mode: LockShared}
+	writeA := lockRef{Name: "a", Mode: LockExclusive}
+	readB := lockRef{Name: "b", Mode: LockShared}
+	writeB := lockRef{Name: "b"}
+
+	if _, ok := firstRepeatedLock([]lockRef{readA, readA}); ok {
+		t.Fatal("recursive read lock is not a reacquire")
+	}
+	if _, ok := firstRepeatedLock([]lockRef{readA, writeA}); !ok {
+		t.Fatal("expected read then write lock to be a repeated acquisition")
+	}
+
+	if _, _, ok := findOrderInversion([]lockRef{readA, readB}, []lockRef{readB, readA}); ok {
+		t.Fatal("did not expect inversion between read-only orders")
+	}
+	if _, _, ok := findOrderInversion([]lockRef{readA, writeB}, []lockRef{readB, writeA}); !ok {
+		t.Fatal("expected inversion when each side write-locks the other's read lock")
+	}
+
+	if containsConflictingLock([]lockRef{readA}, readA) {
+		t.Fatal("two read locks do not conflict")
+	}
+	if !containsConflictingLock([]lockRef{writeA}, readA) {
+		t.Fatal("expected write lock to conflict with read lock")
+	}
+}
+
 func TestContainsLock(t *testing.T) {
 	a := lockRef{Name: "a"}
 	b := lockRef{Name: "b"}
@@ -145,10 +173,10 @@ func TestContainsLock(t *testing.T) {
 
 func TestAcquireOrderHelpers(t *testing.T) {
 	// nil inputs
-	if ord := acquireOrderForGoCall(nil, nil, nil); ord != nil {
+	if ord := acquireOrderForGoCall(nil, nil, nil, newPackageScope(nil)); ord != nil {
 		t.Errorf("expected nil for nil inputs, got %v", ord)
 	}
-	if ord := acquireOrderForCall(nil, nil, nil); ord != nil {
+	if ord := acquireOrderForCall(nil, nil, nil, newPackageScope(nil)); ord != nil {
 		t.Errorf("expected nil for nil inputs, got %v", ord)
 	}
 
@@ -156,11 +184,11 @@ func TestAcquireOrderHelpers(t *testing.T) {
 	empty := &ir.FunctionContract{Expectations: make(map[ir.AnnotationKind][]ir.Requirement)}
 	g := &ssa.Go{Call: ssa.CallCommon{Args: nil}}
 	f := &ssa.Function{}
-	if ord := acquireOrderForGoCall(g, f, empty); ord != nil {
+	if ord := acquireOrderForGoCall(g, f, empty, newPackageScope(nil)); ord != nil {
 		t.Errorf("expected nil when contract has no acquires")
 	}
 	call := &ssa.Call{Call: ssa.CallCommon{Args: nil}}
-	if ord := acquireOrderForCall(call, f, empty); ord != nil {
+	if ord := acquireOrderForCall(call, f, empty, newPackageScope(nil)); ord != nil {
 		t.Errorf("expected nil when contract has no acquires")
 	}
 
@@ -168,12 +196,12 @@ func TestAcquireOrderHelpers(t *testing.T) {
 	contract := &ir.FunctionContract{Expectations: make(map[ir.AnnotationKind][]ir.Requirement)}
 	contract.Expectations[ir.Acquires] = []ir.Requirement{{Target: "foo"}, {Target: "bar"}}
 
-	ord := acquireOrderForGoCall(g, f, contract)
+	ord := acquireOrderForGoCall(g, f, contract, newPackageScope(nil))
 	if len(ord) != 2 || ord[0].Name != "foo" || ord[1].Name != "bar" {
 		t.Errorf("unexpected order for go call: %v", ord)
 	}
 
-	ord = acquireOrderForCall(call, f, contract)
+	ord = acquireOrderForCall(call, f, contract, newPackageScope(nil))
 	if len(ord) != 2 || ord[0].Name != "foo" || ord[1].Name != "bar" {
 		t.Errorf("unexpected order for call: %v", ord)
 	}
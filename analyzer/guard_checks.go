@@ -64,14 +64,27 @@ func dataInvariantForAddress(addr ssa.Value, registry *ir.ContractRegistry) (str
 
 	// address data type contains an owner
 	ownerType := ownerTypeNameForAddress(addr)
+	key := obj.Name()
 	if ownerType != "" {
-		qualifiedKey := ownerType + "." + obj.Name()
+		key = ownerType + "." + obj.Name()
+	}
 
-		// Check for the data invariant in the registry
-		// with the resolved name
-		invariant, ok := registry.Data[qualifiedKey]
+	// Data of a package registered with its import path is only looked up
+	// by qualified key.
+	if obj.Pkg() != nil && registry.HasPackage(obj.Pkg().Path()) {
+		invariant, ok := registry.QualifiedData[ir.MakeQualifiedDataKey(obj.Pkg().Path(), key)]
 		if ok {
-			return qualifiedKey, invariant
+			return key, invariant
+		}
+		return "", nil
+	}
+
+	// Check for the data invariant in the registry
+	// with the resolved name
+	if ownerType != "" {
+		if invariant, ok := registry.Data[key]; ok {
+			logLooseMatch(registry, key, key)
+			return key, invariant
 		}
 	}
 
@@ -79,32 +92,61 @@ func dataInvariantForAddress(addr ssa.Value, registry *ir.ContractRegistry) (str
 	// and not defined within a struct
 	invariant, ok := registry.Data[obj.Name()]
 	if ok {
+		logLooseMatch(registry, key, obj.Name())
 		return obj.Name(), invariant
 	}
 
 	return "", nil
 }
 
-func resolveGuardLockObject(fn *ssa.Function, addr ssa.Value, mutexName string) types.Object {
+// Resolve the guarding lock of an access. For struct fields the guard is
+// resolved against the same instance that owns the accessed field.
+func resolveGuardLock(fn *ssa.Function, addr ssa.Value, mutexName string) lockKey {
 	if fn == nil || mutexName == "" {
-		return nil
+		return lockKey{}
 	}
 
 	parts := strings.Split(mutexName, ".")
 
 	if fieldAddr, ok := addr.(*ssa.FieldAddr); ok {
-		if obj := resolveValueField(fieldAddr.X, parts); obj != nil {
-			return obj
+		if key := lockKeyForField(fieldAddr.X, parts); !key.IsZero() {
+			return key
 		}
 	}
 
-	return resolveObjectInScope(fn, mutexName)
+	if key := resolveLockKeyInScope(fn, mutexName); !key.IsZero() {
+		return key
+	}
+
+	// A guard naming a global of the package that declares the data, seen
+	// from an access in another package.
+	return resolveGlobalInDeclaringPackage(fn, resolveValueToObject(addr), parts)
+}
+
+func resolveGlobalInDeclaringPackage(fn *ssa.Function, obj types.Object, parts []string) lockKey {
+	if fn == nil || fn.Prog == nil || obj == nil || obj.Pkg() == nil || len(parts) == 0 {
+		return lockKey{}
+	}
+
+	pkg := fn.Prog.ImportedPackage(obj.Pkg().Path())
+	if pkg == nil || pkg == fn.Pkg {
+		return lockKey{}
+	}
+
+	global, ok := pkg.Members[parts[0]].(*ssa.Global)
+	if !ok {
+		return lockKey{}
+	}
+	return lockKeyForField(global, parts[1:])
 }
 
+// Check an access to addr against its @guarded_by invariant. Reads are
+// allowed under a shared hold; writes need the lock exclusively.
 func checkGuardedByAccess(
 	instr ssa.Instruction,
 	fn *ssa.Function,
 	addr ssa.Value,
+	write bool,
 	state *AnalysisState,
 	registry *ir.ContractRegistry,
 	reporter *report.Reporter,
@@ -119,15 +161,18 @@ func checkGuardedByAccess(
 		return
 	}
 
-	requiredLock := resolveGuardLockObject(fn, addr, invariant.MutexName)
-	if requiredLock == nil {
+	requiredLock := resolveGuardLock(fn, addr, invariant.MutexName)
+	if requiredLock.IsZero() {
 		logger.Debugf("Could not resolve @guarded_by target '%s' in %s for field %s",
 			invariant.MutexName, fn.Name(), dataName)
 		reportUnresolvableAnnotation("guarded_by", invariant.MutexName, invariant.Pos, reporter, fset)
 		return
 	}
 
-	if !state.HeldLocks[requiredLock] {
+	switch heldMode := state.HeldLocks.ModeOf(requiredLock); {
+	case heldMode == LockNotHeld:
 		reportGuardViolation(instr, dataName, invariant.MutexName, reporter, fset)
+	case heldMode == LockShared && write:
+		reportGuardWriteUnderSharedLock(instr, dataName, invariant.MutexName, reporter, fset)
 	}
 }
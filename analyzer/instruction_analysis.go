@@ -2,9 +2,10 @@ package analyzer
 
 import (
 	"go/token"
-	"go/types"
 	"gotsan/ir"
 	"gotsan/utils/report"
+	"slices"
+	"strings"
 
 	"golang.org/x/tools/go/ssa"
 )
@@ -17,39 +18,55 @@ func analyzeInstructions(
 	state *AnalysisState,
 	registry *ir.ContractRegistry,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
+	explain := explainEnabled(reporter)
 	for _, instr := range instrs {
+		before := 0
+		if explain {
+			before = len(reporter.Findings)
+		}
+
+		checkBlockingOperation(fn, instr, state, registry, scope, reporter, fset)
+
 		switch msg := instr.(type) {
 		case *ssa.Call:
-			handleCallInstruction(fn, msg, state, registry, recursion, reporter, fset)
+			handleCallInstruction(fn, msg, state, registry, recursion, scope, reporter, fset)
 		case *ssa.Defer:
-			registerDeferInstruction(msg, state)
+			registerDeferInstruction(msg, state, scope)
 		case *ssa.RunDefers:
-			applyDeferredEffects(state)
+			applyDeferredEffects(fn, contract, state, reporter, fset, scope)
 		case *ssa.UnOp:
 			// Dereference (MUL referring to a * in a pointer dereference access)
 			// Will become a pointer in SSA addressable memory accesses (i.e., shared memory constructs)
 			if msg.Op == token.MUL {
-				checkGuardedByAccess(msg, fn, msg.X, state, registry, reporter, fset)
+				checkGuardedByAccess(msg, fn, msg.X, false, state, registry, reporter, fset)
 			}
 		case *ssa.Store:
 			// Store
-			checkGuardedByAccess(msg, fn, msg.Addr, state, registry, reporter, fset)
+			checkGuardedByAccess(msg, fn, msg.Addr, true, state, registry, reporter, fset)
 		case *ssa.Return:
 			checkReturnPath(fn, msg, contract, state, reporter, fset)
 		}
+
+		if explain {
+			attachTrace(state.Trace, before, reporter, fset)
+			recordInstructionStep(instr, state, registry, scope)
+		}
 	}
 }
 
 func mergeLockSet(dst LockSet, src LockSet) {
-	for obj := range src {
-		dst[obj] = true
+	for key, mode := range src {
+		dst.Add(key, mode)
 	}
 }
 
-func collectFunctionLockEffects(fn *ssa.Function, seen map[*ssa.Function]bool) (LockSet, LockSet) {
+// Collect the locks acquired and released by fn and its transitive callees,
+// expressed in fn's frame.
+func collectFunctionLockEffects(fn *ssa.Function, seen map[*ssa.Function]bool, scope *analysisScope) (LockSet, LockSet) {
 	locks := make(LockSet)
 	unlocks := make(LockSet)
 	if fn == nil {
@@ -68,41 +85,41 @@ func collectFunctionLockEffects(fn *ssa.Function, seen map[*ssa.Function]bool) (
 				continue
 			}
 
-			if isLockCall(callInstr) {
-				if obj := getLockObject(callInstr); obj != nil {
-					locks[obj] = true
+			if isLockCall(callInstr, scope) {
+				if key := getLockKey(callInstr); !key.IsZero() {
+					locks.Add(key, lockModeForCallCommon(&callInstr.Call, scope))
 				}
 				continue
 			}
 
-			if isUnlockCall(callInstr) {
-				if obj := getLockObject(callInstr); obj != nil {
-					unlocks[obj] = true
+			if isUnlockCall(callInstr, scope) {
+				if key := getLockKey(callInstr); !key.IsZero() {
+					unlocks.Add(key, lockModeForCallCommon(&callInstr.Call, scope))
 				}
 				continue
 			}
 
 			if callee := callInstr.Call.StaticCallee(); callee != nil {
-				nestedLocks, nestedUnlocks := collectFunctionLockEffects(callee, seen)
-				mergeLockSet(locks, nestedLocks)
-				mergeLockSet(unlocks, nestedUnlocks)
+				nestedLocks, nestedUnlocks := collectFunctionLockEffects(callee, seen, scope)
+				mergeLockSet(locks, translateLockSet(nestedLocks, callee, &callInstr.Call))
+				mergeLockSet(unlocks, translateLockSet(nestedUnlocks, callee, &callInstr.Call))
 				continue
 			}
 
 			if nested := resolveFunctionFromValue(callInstr.Call.Value); nested != nil {
-				nestedLocks, nestedUnlocks := collectFunctionLockEffects(nested, seen)
-				mergeLockSet(locks, nestedLocks)
-				mergeLockSet(unlocks, nestedUnlocks)
+				nestedLocks, nestedUnlocks := collectFunctionLockEffects(nested, seen, scope)
+				mergeLockSet(locks, translateLockSet(nestedLocks, nested, &callInstr.Call))
+				mergeLockSet(unlocks, translateLockSet(nestedUnlocks, nested, &callInstr.Call))
 				continue
 			}
 
-			for _, target := range resolveDynamicCallTargets(fn, callInstr) {
+			for _, target := range resolveDynamicCallTargets(fn, callInstr, scope) {
 				if target == nil {
 					continue
 				}
-				nestedLocks, nestedUnlocks := collectFunctionLockEffects(target, seen)
-				mergeLockSet(locks, nestedLocks)
-				mergeLockSet(unlocks, nestedUnlocks)
+				nestedLocks, nestedUnlocks := collectFunctionLockEffects(target, seen, scope)
+				mergeLockSet(locks, translateLockSet(nestedLocks, target, &callInstr.Call))
+				mergeLockSet(unlocks, translateLockSet(nestedUnlocks, target, &callInstr.Call))
 			}
 		}
 	}
@@ -110,7 +127,7 @@ func collectFunctionLockEffects(fn *ssa.Function, seen map[*ssa.Function]bool) (
 	return locks, unlocks
 }
 
-func collectDirectFunctionLockEffects(fn *ssa.Function) (LockSet, LockSet) {
+func collectDirectFunctionLockEffects(fn *ssa.Function, scope *analysisScope) (LockSet, LockSet) {
 	locks := make(LockSet)
 	unlocks := make(LockSet)
 	if fn == nil {
@@ -124,16 +141,16 @@ func collectDirectFunctionLockEffects(fn *ssa.Function) (LockSet, LockSet) {
 				continue
 			}
 
-			if isLockCall(callInstr) {
-				if obj := getLockObject(callInstr); obj != nil {
-					locks[obj] = true
+			if isLockCall(callInstr, scope) {
+				if key := getLockKey(callInstr); !key.IsZero() {
+					locks.Add(key, lockModeForCallCommon(&callInstr.Call, scope))
 				}
 				continue
 			}
 
-			if isUnlockCall(callInstr) {
-				if obj := getLockObject(callInstr); obj != nil {
-					unlocks[obj] = true
+			if isUnlockCall(callInstr, scope) {
+				if key := getLockKey(callInstr); !key.IsZero() {
+					unlocks.Add(key, lockModeForCallCommon(&callInstr.Call, scope))
 				}
 			}
 		}
@@ -142,23 +159,23 @@ func collectDirectFunctionLockEffects(fn *ssa.Function) (LockSet, LockSet) {
 	return locks, unlocks
 }
 
-func collectDeferredCallLockEffects(common *ssa.CallCommon) (LockSet, LockSet) {
+func collectDeferredCallLockEffects(common *ssa.CallCommon, scope *analysisScope) (LockSet, LockSet) {
 	locks := make(LockSet)
 	unlocks := make(LockSet)
 	if common == nil {
 		return locks, unlocks
 	}
 
-	if isLockCallCommon(common) {
-		if obj := getLockObjectFromCallCommon(common); obj != nil {
-			locks[obj] = true
+	if isLockCallCommon(common, scope) {
+		if key := getLockKeyFromCallCommon(common); !key.IsZero() {
+			locks.Add(key, lockModeForCallCommon(common, scope))
 		}
 		return locks, unlocks
 	}
 
-	if isUnlockCallCommon(common) {
-		if obj := getLockObjectFromCallCommon(common); obj != nil {
-			unlocks[obj] = true
+	if isUnlockCallCommon(common, scope) {
+		if key := getLockKeyFromCallCommon(common); !key.IsZero() {
+			unlocks.Add(key, lockModeForCallCommon(common, scope))
 		}
 		return locks, unlocks
 	}
@@ -166,15 +183,15 @@ func collectDeferredCallLockEffects(common *ssa.CallCommon) (LockSet, LockSet) {
 	seen := make(map[*ssa.Function]bool)
 
 	if callee := common.StaticCallee(); callee != nil {
-		nestedLocks, nestedUnlocks := collectFunctionLockEffects(callee, seen)
-		mergeLockSet(locks, nestedLocks)
-		mergeLockSet(unlocks, nestedUnlocks)
+		nestedLocks, nestedUnlocks := collectFunctionLockEffects(callee, seen, scope)
+		mergeLockSet(locks, translateLockSet(nestedLocks, callee, common))
+		mergeLockSet(unlocks, translateLockSet(nestedUnlocks, callee, common))
 	}
 
 	if dynamic := resolveFunctionFromValue(common.Value); dynamic != nil {
-		nestedLocks, nestedUnlocks := collectFunctionLockEffects(dynamic, seen)
-		mergeLockSet(locks, nestedLocks)
-		mergeLockSet(unlocks, nestedUnlocks)
+		nestedLocks, nestedUnlocks := collectFunctionLockEffects(dynamic, seen, scope)
+		mergeLockSet(locks, translateLockSet(nestedLocks, dynamic, common))
+		mergeLockSet(unlocks, translateLockSet(nestedUnlocks, dynamic, common))
 	}
 
 	if closure, ok := common.Value.(*ssa.MakeClosure); ok {
@@ -183,58 +200,82 @@ func collectDeferredCallLockEffects(common *ssa.CallCommon) (LockSet, LockSet) {
 			if boundFn == nil {
 				continue
 			}
-			nestedLocks, nestedUnlocks := collectFunctionLockEffects(boundFn, seen)
-			mergeLockSet(locks, nestedLocks)
-			mergeLockSet(unlocks, nestedUnlocks)
+			// The bound function is invoked from inside the closure, so
+			// its parameters can't be mapped to this frame.
+			nestedLocks, nestedUnlocks := collectFunctionLockEffects(boundFn, seen, scope)
+			mergeLockSet(locks, translateLockSet(nestedLocks, boundFn, nil))
+			mergeLockSet(unlocks, translateLockSet(nestedUnlocks, boundFn, nil))
 		}
 	}
 
 	return locks, unlocks
 }
 
-func isHeldLockEquivalent(heldLocks LockSet, candidate types.Object) bool {
-	if candidate == nil || len(heldLocks) == 0 {
-		return false
-	}
+// Looser than LockSet.Contains: when the instance can't be told apart,
+// locks with the same name are treated as equivalent.
+func isHeldLockEquivalent(heldLocks LockSet, candidate lockKey) bool {
+	return heldModeEquivalent(heldLocks, candidate) != LockNotHeld
+}
 
-	if heldLocks[candidate] {
-		return true
+// The strongest mode in which a lock loosely equivalent to candidate is held
+// (see isHeldLockEquivalent).
+func heldModeEquivalent(heldLocks LockSet, candidate lockKey) LockMode {
+	if candidate.IsZero() || len(heldLocks) == 0 {
+		return LockNotHeld
 	}
 
-	for heldObj := range heldLocks {
-		if heldObj == nil {
+	mode := heldLocks.ModeOf(candidate)
+	for held, heldMode := range heldLocks {
+		if held.IsZero() || heldMode <= mode {
 			continue
 		}
-		if heldObj.Name() == candidate.Name() {
-			return true
+		if held.Root != nil && candidate.Root != nil && rootsComparable(held.Root, candidate.Root) {
+			// Both instances are known and differ.
+			continue
+		}
+		if held.Name() == candidate.Name() {
+			mode = heldMode
 		}
 	}
 
-	return false
+	return mode
 }
 
-func applyReleasedRequiresEffects(state *AnalysisState, callSite *ssa.Call, requires []ir.Requirement, released LockSet) {
-	if state == nil || callSite == nil || len(requires) == 0 || len(released) == 0 {
-		return
+// Acquiring a lock blocks on an existing hold unless both are shared.
+func acquireConflicts(held LockMode, acquiring LockMode) bool {
+	if held == LockNotHeld {
+		return false
 	}
+	return held == LockExclusive || acquiring == LockExclusive
+}
 
-	for _, exp := range requires {
-		requiredLockObject := resolveObjectAtCallSite(callSite, exp.Target)
-		if requiredLockObject == nil {
-			continue
-		}
-
-		if !state.HeldLocks[requiredLockObject] {
-			continue
-		}
+// The mode in which calleeFn acquires lock (a key in the caller's frame),
+// judged from its lock calls. Annotations don't carry a mode, so locks the
+// body never acquires directly are treated as exclusive.
+func calleeAcquireMode(calleeFn *ssa.Function, callSite *ssa.Call, lock lockKey, scope *analysisScope) LockMode {
+	acquired, _ := collectFunctionLockEffects(calleeFn, make(map[*ssa.Function]bool), scope)
+	if callSite != nil {
+		acquired = translateLockSet(acquired, calleeFn, &callSite.Call)
+	}
+	if mode := acquired.ModeOf(lock); mode != LockNotHeld {
+		return mode
+	}
+	return LockExclusive
+}
 
-		if !isHeldLockEquivalent(released, requiredLockObject) {
-			continue
-		}
+// Report a call whose callee acquires lock while the caller already holds
+// it in a conflicting mode.
+func reportConflictingAcquire(msg *ssa.Call, callee *ssa.Function, lockName string, held LockMode, acquiring LockMode,
+	reporter *report.Reporter, fset *token.FileSet) {
+	if !acquireConflicts(held, acquiring) {
+		return
+	}
 
-		delete(state.HeldLocks, requiredLockObject)
-		delete(state.MayHeldLocks, requiredLockObject)
+	if held == LockShared {
+		reportCallUpgradesLock(msg, callee, lockName, reporter, fset)
+		return
 	}
+	reportAlreadyAcquiredLock(msg, callee, lockName, reporter, fset)
 }
 
 func checkReturnPath(
@@ -245,7 +286,26 @@ func checkReturnPath(
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
+	heldLocks := state.HeldLocks
 	if contract != nil {
+		// Locks the function must release are reported by their own check.
+		for _, exp := range contract.Expectations[ir.Releases] {
+			key := checkReleasesOnReturn(fn, ret, state, reporter, fset, exp)
+			if !key.IsZero() && heldLocks.Contains(key) {
+				heldLocks = heldLocks.Copy()
+				heldLocks.Remove(key)
+			}
+		}
+
+		// So are locks the function returns holding depending on its result.
+		for _, exp := range contract.Expectations[ir.ReturnsIf] {
+			key := checkConditionalReturn(fn, ret, state, reporter, fset, exp, contract.Pos)
+			if !key.IsZero() && heldLocks.Contains(key) {
+				heldLocks = heldLocks.Copy()
+				heldLocks.Remove(key)
+			}
+		}
+
 		returns := contract.Expectations[ir.Returns]
 		if len(returns) > 0 {
 			for _, exp := range returns {
@@ -255,9 +315,90 @@ func checkReturnPath(
 		}
 	}
 
-	if len(state.HeldLocks) > 0 {
-		reportUndeclaredReturnedLock(fn, ret, state.HeldLocks, reporter, fset)
+	if len(heldLocks) > 0 {
+		reportUndeclaredReturnedLock(fn, ret, heldLocks, reporter, fset)
 	}
+
+	checkMayHeldOnReturn(fn, ret, contract, state, reporter, fset)
+}
+
+// Report locks held on some, but not all, paths reaching ret. The lock was
+// released on the other paths, so the path that skips the release is a leak.
+// Locks held on entry through @requires are the caller's and are skipped, as
+// are @releases and @returns_if locks, which checkReleasesOnReturn and
+// checkConditionalReturn cover.
+func checkMayHeldOnReturn(
+	fn *ssa.Function,
+	ret *ssa.Return,
+	contract *ir.FunctionContract,
+	state *AnalysisState,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	required := make(LockSet)
+	if contract != nil {
+		for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared, ir.Releases, ir.ReturnsIf} {
+			for _, exp := range contract.Expectations[kind] {
+				if key := resolveLockKeyInScope(fn, exp.Target); !key.IsZero() {
+					required.Add(key, LockExclusive)
+				}
+			}
+		}
+	}
+
+	leaked := make([]lockKey, 0)
+	for key := range state.MayHeldLocks {
+		if key.IsZero() || state.HeldLocks.Contains(key) || required.Contains(key) {
+			continue
+		}
+		leaked = append(leaked, key)
+	}
+	slices.SortFunc(leaked, func(a, b lockKey) int { return strings.Compare(a.QualifiedName(), b.QualifiedName()) })
+
+	for _, key := range leaked {
+		witness := token.NoPos
+		var trace []traceStep
+		for _, source := range state.MayHeldSources[key] {
+			if witness = blockDiagnosticPos(source.Block); witness != token.NoPos {
+				trace = source.Trace
+				break
+			}
+		}
+
+		before := 0
+		if explainEnabled(reporter) {
+			before = len(reporter.Findings)
+		}
+		reportLockMayBeHeldOnReturn(fn, ret, key.Name(), witness, reporter, fset)
+		if explainEnabled(reporter) {
+			// The leaking path, rather than the merged state's trace.
+			trace = append(slices.Clip(trace), traceStep{Pos: returnDiagnosticPos(fn, ret), Message: "returns with " + key.QualifiedName() + " still held"})
+			attachTrace(trace, before, reporter, fset)
+		}
+	}
+}
+
+// A source position for the end of block: the branch condition it ends in,
+// or its last positioned instruction.
+func blockDiagnosticPos(block *ssa.BasicBlock) token.Pos {
+	if block == nil {
+		return token.NoPos
+	}
+
+	for i := len(block.Instrs) - 1; i >= 0; i-- {
+		instr := block.Instrs[i]
+		if branch, ok := instr.(*ssa.If); ok {
+			if cond, ok := branch.Cond.(ssa.Instruction); ok && cond.Block() == block && branch.Cond.Pos() != token.NoPos {
+				return branch.Cond.Pos()
+			}
+			continue
+		}
+		if instr.Pos() != token.NoPos {
+			return instr.Pos()
+		}
+	}
+
+	return token.NoPos
 }
 
 func checkReturnsExpectation(
@@ -269,43 +410,70 @@ func checkReturnsExpectation(
 	exp ir.Requirement,
 	contractPos token.Pos,
 ) {
-	requiredLockObject := resolveObjectInScope(fn, exp.Target)
-	if requiredLockObject == nil {
+	requiredLock := resolveLockKeyInScope(fn, exp.Target)
+	if requiredLock.IsZero() {
 		reportUnresolvableAnnotation(ir.Returns.String(), exp.Target, contractPos, reporter, fset)
 		return
 	}
 
-	if !isHeldLockEquivalent(state.HeldLocks, requiredLockObject) {
+	if !isHeldLockEquivalent(state.HeldLocks, requiredLock) {
 		reportReturnMissingLock(fn, ret, exp.Target, reporter, fset)
 	}
 }
 
-func checkRequiresExpectation(exp ir.Requirement, calleeFn *ssa.Function, callSite *ssa.Call, state *AnalysisState, reporter *report.Reporter,
-	fset *token.FileSet) {
-	// Map the requirement to the caller's objects
-	// Turn the mutex name in the annotation to an SSA object
-	requiredLockObject := resolveObjectAtCallSite(callSite, exp.Target)
-	if requiredLockObject == nil {
+// Check that a lock annotated @releases is no longer held, on any path, when
+// fn returns at ret. Returns the lock, or the zero key when the target can't
+// be resolved (reported with the initial lockset).
+func checkReleasesOnReturn(
+	fn *ssa.Function,
+	ret *ssa.Return,
+	state *AnalysisState,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	exp ir.Requirement,
+) lockKey {
+	releasedLock := resolveLockKeyInScope(fn, exp.Target)
+	if releasedLock.IsZero() {
+		return lockKey{}
+	}
+
+	if state.MayHeldLocks.Contains(releasedLock) {
+		reportReturnWithoutRelease(fn, ret, exp.Target, reporter, fset)
+	}
+	return releasedLock
+}
+
+// Check a @requires or @requires_shared expectation at a call site. kind
+// selects the mode the caller must hold the lock in.
+func checkRequiresExpectation(kind ir.AnnotationKind, exp ir.Requirement, calleeFn *ssa.Function, callSite *ssa.Call, state *AnalysisState,
+	reporter *report.Reporter, fset *token.FileSet) {
+	// Map the requirement to the caller's locks
+	// Turn the mutex name in the annotation to a lock instance
+	requiredLock := resolveLockKeyAtCallSite(callSite, exp.Target)
+	if requiredLock.IsZero() {
 		if annotationRootIsCallsiteLocal(calleeFn, exp.Target) {
-			reportCallsiteLocalRootAnnotation(ir.Requires.String(), exp.Target, calleeFn, callSite.Pos(), reporter, fset)
+			reportCallsiteLocalRootAnnotation(kind.String(), exp.Target, calleeFn, callSite.Pos(), reporter, fset)
 			return
 		}
 
-		reportUnresolvableAnnotation(ir.Requires.String(), exp.Target, callSite.Pos(), reporter, fset)
+		reportUnresolvableAnnotation(kind.String(), exp.Target, callSite.Pos(), reporter, fset)
 		return
 	}
 
-	if !state.HeldLocks[requiredLockObject] {
+	switch heldMode := state.HeldLocks.ModeOf(requiredLock); {
+	case heldMode == LockNotHeld:
 		reportMissingLock(callSite, calleeFn, exp.Target, reporter, fset)
+	case heldMode == LockShared && kind == ir.Requires:
+		reportSharedLockInsufficient(callSite, calleeFn, exp.Target, reporter, fset)
 	}
 }
 
 func checkAcquiresExpectation(exp ir.Requirement, calleeFn *ssa.Function, callSite *ssa.Call, state *AnalysisState, reporter *report.Reporter,
-	fset *token.FileSet) {
-	// Map the requirement to the caller's objects
-	// Turn the mutex name in the annotation to an SSA object
-	acquiredLockObject := resolveObjectAtCallSite(callSite, exp.Target)
-	if acquiredLockObject == nil {
+	fset *token.FileSet, scope *analysisScope) {
+	// Map the requirement to the caller's locks
+	// Turn the mutex name in the annotation to a lock instance
+	acquiredLock := resolveLockKeyAtCallSite(callSite, exp.Target)
+	if acquiredLock.IsZero() {
 		if annotationRootIsCallsiteLocal(calleeFn, exp.Target) {
 			reportCallsiteLocalRootAnnotation(ir.Acquires.String(), exp.Target, calleeFn, callSite.Pos(), reporter, fset)
 			return
@@ -315,37 +483,161 @@ func checkAcquiresExpectation(exp ir.Requirement, calleeFn *ssa.Function, callSi
 		return
 	}
 
-	if state.HeldLocks[acquiredLockObject] {
-		reportAlreadyAcquiredLock(callSite, calleeFn, exp.Target, reporter, fset)
+	heldMode := state.HeldLocks.ModeOf(acquiredLock)
+	if heldMode == LockNotHeld {
+		return
 	}
+	reportConflictingAcquire(callSite, calleeFn, exp.Target, heldMode, calleeAcquireMode(calleeFn, callSite, acquiredLock, scope), reporter, fset)
+}
+
+// Check an @excludes expectation at a call site: the caller must not hold
+// the lock on any path reaching it. Returns whether a violation was reported.
+func checkExcludesExpectation(exp ir.Requirement, calleeFn *ssa.Function, callSite *ssa.Call, state *AnalysisState, reporter *report.Reporter,
+	fset *token.FileSet) bool {
+	excludedLock := resolveLockKeyAtCall(calleeFn, callSite, exp.Target)
+	if excludedLock.IsZero() {
+		if annotationRootIsCallsiteLocal(calleeFn, exp.Target) {
+			reportCallsiteLocalRootAnnotation(ir.Excludes.String(), exp.Target, calleeFn, callSite.Pos(), reporter, fset)
+			return false
+		}
+
+		reportUnresolvableAnnotation(ir.Excludes.String(), exp.Target, callSite.Pos(), reporter, fset)
+		return false
+	}
+
+	// MayHeldLocks covers HeldLocks. Unlike must-held facts, may-held facts
+	// only grow while the traversal converges, so a report made on an
+	// early visit of the block stays true.
+	if !state.MayHeldLocks.Contains(excludedLock) {
+		return false
+	}
+	reportExcludedLockHeld(callSite, boundMethodTarget(calleeFn), exp.Target, reporter, fset)
+	return true
+}
+
+// The locks calleeFn's annotations of kind denote in the caller at callSite.
+func contractLocksAtCall(kind ir.AnnotationKind, calleeFn *ssa.Function, callSite *ssa.Call, contract *ir.FunctionContract) LockSet {
+	locks := make(LockSet)
+	if contract == nil {
+		return locks
+	}
+
+	for _, exp := range contract.Expectations[kind] {
+		if key := resolveLockKeyAtCall(calleeFn, callSite, exp.Target); !key.IsZero() {
+			locks.Add(key, LockExclusive)
+		}
+	}
+	return locks
+}
+
+// Check a @releases expectation at a call site: the caller must hold the
+// lock, which the callee releases.
+func checkReleasesExpectation(exp ir.Requirement, calleeFn *ssa.Function, callSite *ssa.Call, state *AnalysisState, reporter *report.Reporter,
+	fset *token.FileSet) {
+	releasedLock := resolveLockKeyAtCall(calleeFn, callSite, exp.Target)
+	if releasedLock.IsZero() {
+		if annotationRootIsCallsiteLocal(calleeFn, exp.Target) {
+			reportCallsiteLocalRootAnnotation(ir.Releases.String(), exp.Target, calleeFn, callSite.Pos(), reporter, fset)
+			return
+		}
+
+		reportUnresolvableAnnotation(ir.Releases.String(), exp.Target, callSite.Pos(), reporter, fset)
+		return
+	}
+
+	switch {
+	case state.HeldLocks.Contains(releasedLock):
+	case state.MayHeldLocks.Contains(releasedLock):
+		reportReleasedLockNotHeld(callSite, boundMethodTarget(calleeFn), exp.Target, true, reporter, fset)
+	default:
+		reportReleasedLockNotHeld(callSite, boundMethodTarget(calleeFn), exp.Target, false, reporter, fset)
+	}
+}
+
+// Drop the locks a call released (see @releases) from the caller's state,
+// as an unlock would.
+func applyReleasedLocks(state *AnalysisState, released LockSet) {
+	for key := range released {
+		if state.NestedLocks.Contains(key) {
+			state.NestedLocks.Remove(key)
+			continue
+		}
+		state.HeldLocks.Remove(key)
+		state.MayHeldLocks.Remove(key)
+	}
+}
+
+// The locks a call releases: those the callee declares with @releases or,
+// when it declares none, the locks it requires (see @requires) and unlocks
+// directly without locking them again, as code written before @releases
+// existed does.
+func releasedLocksAtCall(calleeFn *ssa.Function, callSite *ssa.Call, contract *ir.FunctionContract, scope *analysisScope) LockSet {
+	if contract == nil || len(contract.Expectations[ir.Releases]) > 0 {
+		return contractLocksAtCall(ir.Releases, calleeFn, callSite, contract)
+	}
+
+	released := make(LockSet)
+	locked, unlocked := collectDirectFunctionLockEffects(calleeFn, scope)
+	locked = translateLockSet(locked, calleeFn, &callSite.Call)
+	unlocked = translateLockSet(unlocked, calleeFn, &callSite.Call)
+	for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared} {
+		for key := range contractLocksAtCall(kind, calleeFn, callSite, contract) {
+			if isHeldLockEquivalent(unlocked, key) && !isHeldLockEquivalent(locked, key) {
+				released.Add(key, LockExclusive)
+			}
+		}
+	}
+	return released
 }
 
 // For a new function that is called, retrieve the contract
 // and verify that all expectations are met with respect to
 // the current lockset
-// fn is the callee function, this function is invoked from the caller
+// fn is the callee function, this function is invoked from the caller.
+// Returns whether the call was reported for holding a lock the callee
+// excludes.
 func handleStaticCalleeFunction(calleeFn *ssa.Function, callSite *ssa.Call, registry *ir.ContractRegistry, state *AnalysisState, reporter *report.Reporter,
-	recursion *recursionGraph, fset *token.FileSet, callerFn *ssa.Function) {
+	recursion *recursionGraph, scope *analysisScope, fset *token.FileSet, callerFn *ssa.Function) bool {
 	if calleeFn == nil {
-		return
+		return false
 	}
 
-	checkRecursiveCallLockReacquireHeuristic(callerFn, calleeFn, callSite, state, registry, recursion, reporter, fset)
+	checkRecursiveCallLockReacquireHeuristic(callerFn, calleeFn, callSite, state, registry, recursion, scope, reporter, fset)
 
 	contract := contractForFunction(calleeFn, registry)
 	if contract == nil {
-		return
+		return false
+	}
+
+	for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared} {
+		for _, exp := range contract.Expectations[kind] {
+			checkRequiresExpectation(kind, exp, calleeFn, callSite, state, reporter, fset)
+		}
 	}
 
-	requires := contract.Expectations[ir.Requires]
-	for _, exp := range requires {
-		checkRequiresExpectation(exp, calleeFn, callSite, state, reporter, fset)
+	reportedExcluded := false
+	for _, exp := range contract.Expectations[ir.Excludes] {
+		if checkExcludesExpectation(exp, calleeFn, callSite, state, reporter, fset) {
+			reportedExcluded = true
+		}
 	}
 
+	for _, exp := range contract.Expectations[ir.Releases] {
+		checkReleasesExpectation(exp, calleeFn, callSite, state, reporter, fset)
+	}
+
+	// A held lock the callee acquires is reported by the @excludes check,
+	// not again as a reacquire.
+	excluded := contractLocksAtCall(ir.Excludes, calleeFn, callSite, contract)
 	acquires := contract.Expectations[ir.Acquires]
 	for _, exp := range acquires {
-		checkAcquiresExpectation(exp, calleeFn, callSite, state, reporter, fset)
+		if excluded.Contains(resolveLockKeyAtCallSite(callSite, exp.Target)) {
+			continue
+		}
+		checkAcquiresExpectation(exp, calleeFn, callSite, state, reporter, fset, scope)
 	}
+
+	return reportedExcluded
 }
 
 func handleCallInstruction(
@@ -354,78 +646,129 @@ func handleCallInstruction(
 	state *AnalysisState,
 	registry *ir.ContractRegistry,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
-	if isLockCall(msg) {
-		obj := getLockObject(msg)
-		if obj != nil {
-			if state.MayHeldLocks[obj] {
-				reportReacquiredLock(msg, fn, obj.Name(), reporter, fset)
+	if op := callCondOperation(&msg.Call); op != noCondOperation {
+		checkCondCall(fn, msg, op, state, registry, scope, reporter, fset)
+		return
+	}
+
+	if isTryLockCallCommon(&msg.Call, scope) {
+		// Never blocks; the lock is held on the branch where it succeeded
+		// (see branchAcquiredLocks).
+		return
+	}
+
+	if isLockCall(msg, scope) {
+		key := getLockKey(msg)
+		if !key.IsZero() {
+			mode := lockModeForCallCommon(&msg.Call, scope)
+			heldMode := state.MayHeldLocks.ModeOf(key)
+			// A second RLock over a shared hold is a recursive read lock; it
+			// only blocks if a writer queues in between (see the goroutine
+			// checks).
+			if acquireConflicts(heldMode, mode) {
+				if heldMode == LockShared {
+					reportLockUpgrade(msg, fn, key.Name(), reporter, fset)
+				} else {
+					reportReacquiredLock(msg, fn, key.Name(), reporter, fset)
+				}
+			}
+
+			checkDeclaredLockOrder(fn, msg.Pos(), nil, state.HeldLocks, key, registry, reporter, fset)
+
+			if heldMode != LockNotHeld && state.HeldLocks.Contains(key) {
+				state.NestedLocks.Add(key, mode)
+			} else {
+				state.HeldLocks.Add(key, mode)
+				state.MayHeldLocks.Add(key, mode)
 			}
-			state.HeldLocks[obj] = true
-			state.MayHeldLocks[obj] = true
 		}
-	} else if isUnlockCall(msg) {
-		obj := getLockObject(msg)
-		if obj != nil {
-			delete(state.HeldLocks, obj)
-			delete(state.MayHeldLocks, obj)
+	} else if isUnlockCall(msg, scope) {
+		key := getLockKey(msg)
+		if !key.IsZero() {
+			if state.NestedLocks.Contains(key) {
+				// Releases the nested hold; the outer one remains.
+				state.NestedLocks.Remove(key)
+				return
+			}
+
+			contract := contractForFunction(fn, registry)
+			checkUnlockHeld(fn, contract, msg.Pos(), key, lockModeForCallCommon(&msg.Call, scope), false, state, reporter, fset, scope)
+			state.HeldLocks.Remove(key)
+			state.MayHeldLocks.Remove(key)
 		}
 	} else {
 		callee := msg.Call.StaticCallee()
 		if callee != nil {
-			handleStaticCalleeFunction(callee, msg, registry, state, reporter, recursion, fset, fn)
+			handleStaticCalleeFunction(callee, msg, registry, state, reporter, recursion, scope, fset, fn)
+			checkCalleeCondWaits(fn, msg, callee, state, reporter, fset, scope)
 
 			contract := contractForFunction(callee, registry)
-			requires := []ir.Requirement(nil)
-			if contract != nil {
-				requires = contract.Expectations[ir.Requires]
-			}
 			hasExplicitAcquires := contract != nil && len(contract.Expectations[ir.Acquires]) > 0
-			acquiredLocks, _ := collectFunctionLockEffects(callee, make(map[*ssa.Function]bool))
-			_, directReleasedLocks := collectDirectFunctionLockEffects(callee)
-			applyReleasedRequiresEffects(state, msg, requires, directReleasedLocks)
+			excluded := contractLocksAtCall(ir.Excludes, callee, msg, contract)
+			acquiredLocks, _ := collectFunctionLockEffects(callee, make(map[*ssa.Function]bool), scope)
+			acquiredLocks = translateLockSet(acquiredLocks, callee, &msg.Call)
+			checkCalleeDeclaredLockOrder(fn, msg, callee, acquiredLocks, state, registry, reporter, fset)
+			applyReleasedLocks(state, releasedLocksAtCall(callee, msg, contract, scope))
 
 			if len(state.HeldLocks) > 0 && !hasExplicitAcquires {
-				for obj := range acquiredLocks {
-					if obj == nil || !isHeldLockEquivalent(state.HeldLocks, obj) {
+				for key, mode := range acquiredLocks {
+					if key.IsZero() || excluded.Contains(key) {
 						continue
 					}
-					reportAlreadyAcquiredLock(msg, callee, obj.Name(), reporter, fset)
+					reportConflictingAcquire(msg, callee, key.Name(), heldModeEquivalent(state.HeldLocks, key), mode, reporter, fset)
 				}
 			}
 
 			return
 		}
 
-		targets := resolveDynamicCallTargets(fn, msg)
+		targets := resolveDynamicCallTargets(fn, msg, scope)
 		if len(targets) == 0 {
 			reportDynamicCallbackWhileHoldingLocks(msg, fn, state.HeldLocks, reporter, fset)
 			return
 		}
 
+		// Only locks every target releases are known to be released.
+		var released LockSet
 		reportedReacquire := false
 		for _, target := range targets {
 			if target == nil {
 				continue
 			}
 
-			handleStaticCalleeFunction(target, msg, registry, state, reporter, recursion, fset, fn)
+			if handleStaticCalleeFunction(target, msg, registry, state, reporter, recursion, scope, fset, fn) {
+				reportedReacquire = true
+			}
 
 			contract := contractForFunction(target, registry)
+			targetAcquired, _ := collectFunctionLockEffects(target, make(map[*ssa.Function]bool), scope)
+			targetAcquired = translateLockSet(targetAcquired, target, &msg.Call)
+			checkCalleeDeclaredLockOrder(fn, msg, target, targetAcquired, state, registry, reporter, fset)
+
+			targetReleased := releasedLocksAtCall(target, msg, contract, scope)
+			if released == nil {
+				released = targetReleased
+			} else {
+				released = released.Intersect(targetReleased)
+			}
+
 			hasExplicitAcquires := contract != nil && len(contract.Expectations[ir.Acquires]) > 0
 			if hasExplicitAcquires {
 				continue
 			}
 
-			acquiredLocks, _ := collectFunctionLockEffects(target, make(map[*ssa.Function]bool))
-			for obj := range acquiredLocks {
-				if obj == nil || !isHeldLockEquivalent(state.HeldLocks, obj) {
+			excluded := contractLocksAtCall(ir.Excludes, target, msg, contract)
+			for key, mode := range targetAcquired {
+				heldMode := heldModeEquivalent(state.HeldLocks, key)
+				if key.IsZero() || excluded.Contains(key) || !acquireConflicts(heldMode, mode) {
 					continue
 				}
 
-				reportAlreadyAcquiredLock(msg, target, obj.Name(), reporter, fset)
+				reportConflictingAcquire(msg, target, key.Name(), heldMode, mode, reporter, fset)
 				reportedReacquire = true
 			}
 		}
@@ -433,6 +776,7 @@ func handleCallInstruction(
 		if !reportedReacquire {
 			reportDynamicCallbackWhileHoldingLocks(msg, fn, state.HeldLocks, reporter, fset)
 		}
+		applyReleasedLocks(state, released)
 	}
 }
 
@@ -441,17 +785,19 @@ func handleCallInstruction(
 
 // Run at the end of the function to handle any state modifications
 // made in the "defer" keyword, seen earlier in the function
-func applyDeferredEffects(state *AnalysisState) {
+func applyDeferredEffects(fn *ssa.Function, contract *ir.FunctionContract, state *AnalysisState, reporter *report.Reporter, fset *token.FileSet, scope *analysisScope) {
 	// Add any locks that were deferred to the lockset
-	for obj := range state.DeferredLocks {
-		state.HeldLocks[obj] = true
-		state.MayHeldLocks[obj] = true
+	for key, mode := range state.DeferredLocks {
+		state.HeldLocks.Add(key, mode)
+		state.MayHeldLocks.Add(key, mode)
 	}
 
-	// Remove any locks from the lockset that were unlocked in a defer step
-	for obj := range state.DeferredUnlocks {
-		delete(state.HeldLocks, obj)
-		delete(state.MayHeldLocks, obj)
+	// Remove any locks from the lockset that were unlocked in a defer step,
+	// checking that they are still held (e.g., not already unlocked explicitly)
+	for key, mode := range state.DeferredUnlocks {
+		checkUnlockHeld(fn, contract, deferredUnlockPos(fn, key, scope), key, mode, true, state, reporter, fset, scope)
+		state.HeldLocks.Remove(key)
+		state.MayHeldLocks.Remove(key)
 	}
 	state.DeferredLocks = make(LockSet)
 	state.DeferredUnlocks = make(LockSet)
@@ -459,12 +805,81 @@ func applyDeferredEffects(state *AnalysisState) {
 
 // Add deferred statements to the state, such that they are later run when the function
 // is being returned (or when ssa.RunDefers exists in the SSA)
-func registerDeferInstruction(msg *ssa.Defer, state *AnalysisState) {
-	deferredLocks, deferredUnlocks := collectDeferredCallLockEffects(&msg.Call)
-	for obj := range deferredLocks {
-		state.DeferredLocks[obj] = true
+func registerDeferInstruction(msg *ssa.Defer, state *AnalysisState, scope *analysisScope) {
+	deferredLocks, deferredUnlocks := collectDeferredCallLockEffects(&msg.Call, scope)
+	mergeLockSet(state.DeferredLocks, deferredLocks)
+	mergeLockSet(state.DeferredUnlocks, deferredUnlocks)
+}
+
+// Position of the defer statement that releases key, for reporting deferred
+// unlocks at their source.
+func deferredUnlockPos(fn *ssa.Function, key lockKey, scope *analysisScope) token.Pos {
+	if fn == nil {
+		return token.NoPos
+	}
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			deferInstr, ok := instr.(*ssa.Defer)
+			if !ok {
+				continue
+			}
+			if _, unlocks := collectDeferredCallLockEffects(&deferInstr.Call, scope); unlocks.Contains(key) {
+				return deferInstr.Pos()
+			}
+		}
 	}
-	for obj := range deferredUnlocks {
-		state.DeferredUnlocks[obj] = true
+
+	return returnDiagnosticPos(fn, nil)
+}
+
+// UNLOCK CHECKS
+// ---------------------------------------------------------------------------
+
+// Whether fn manages key itself: it locks it somewhere in its body or names
+// it in its contract. Only then can an unlock of key be judged in isolation;
+// otherwise the lock may be held by an unknown caller.
+func functionOwnsLock(fn *ssa.Function, contract *ir.FunctionContract, key lockKey, scope *analysisScope) bool {
+	if locks, _ := collectDirectFunctionLockEffects(fn, scope); locks.Contains(key) {
+		return true
+	}
+	if contract == nil {
+		return false
+	}
+
+	for _, kind := range []ir.AnnotationKind{ir.Requires, ir.RequiresShared, ir.Acquires, ir.Excludes, ir.Releases} {
+		for _, exp := range contract.Expectations[kind] {
+			if equivalentLockKeys(resolveLockKeyInScope(fn, exp.Target), key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check that key is held, in the mode the unlock releases, before it is
+// unlocked at pos. Unlocking a lock that is not held is a fatal runtime error.
+func checkUnlockHeld(
+	fn *ssa.Function,
+	contract *ir.FunctionContract,
+	pos token.Pos,
+	key lockKey,
+	mode LockMode,
+	deferred bool,
+	state *AnalysisState,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	scope *analysisScope,
+) {
+	heldMode := state.HeldLocks.ModeOf(key)
+	switch {
+	case heldMode != LockNotHeld:
+		if heldMode != mode {
+			reportUnlockModeMismatch(fn, pos, key.Name(), heldMode, mode, reporter, fset)
+		}
+	case state.MayHeldLocks.Contains(key):
+		reportUnlockOfMaybeHeldLock(fn, pos, key.Name(), deferred, reporter, fset)
+	case functionOwnsLock(fn, contract, key, scope):
+		reportUnlockOfUnheldLock(fn, pos, key.Name(), deferred, reporter, fset)
 	}
 }
@@ -6,75 +6,184 @@ import (
 	"golang.org/x/tools/go/ssa"
 )
 
-func isLockCallCommon(common *ssa.CallCommon) bool {
+// lockOperation is what a call does to the lock it is made on.
+type lockOperation int
+
+const (
+	noLockOperation lockOperation = iota
+	acquireLockOperation
+	releaseLockOperation
+	// Acquires the lock only if it is free, reporting success in its
+	// result; see branchAcquiredLocks.
+	tryAcquireLockOperation
+)
+
+// The lock operation a call performs, and the mode it acquires or releases
+// the lock in. Lock calls are the methods of sync.Mutex and sync.RWMutex,
+// methods declared with @lock_method/@unlock_method or on a @lock_type (see
+// declaredLockOperation), and Lock/Unlock invoked through an interface such
+// as sync.Locker.
+func callLockOperation(common *ssa.CallCommon, scope *analysisScope) (lockOperation, LockMode) {
 	if common == nil {
-		return false
+		return noLockOperation, LockExclusive
+	}
+
+	if common.IsInvoke() {
+		return invokedLockOperation(common, scope)
 	}
 
 	fn := common.StaticCallee()
 	if fn == nil {
-		return false // It's a dynamic call (interface or func variable)
+		return noLockOperation, LockExclusive // It's a dynamic call (func variable)
 	}
+	return functionLockOperation(fn, scope)
+}
 
-	name := fn.Name()
-	if name != "Lock" && name != "RLock" {
-		return false
+// The lock operation fn performs on its receiver.
+func functionLockOperation(fn *ssa.Function, scope *analysisScope) (lockOperation, LockMode) {
+	if fn == nil {
+		return noLockOperation, LockExclusive
+	}
+
+	switch fn.String() {
+	case "(*sync.Mutex).Lock", "(*sync.RWMutex).Lock":
+		return acquireLockOperation, LockExclusive
+	case "(*sync.RWMutex).RLock", "(*sync.rlocker).Lock":
+		return acquireLockOperation, LockShared
+	case "(*sync.Mutex).Unlock", "(*sync.RWMutex).Unlock":
+		return releaseLockOperation, LockExclusive
+	case "(*sync.RWMutex).RUnlock", "(*sync.rlocker).Unlock":
+		return releaseLockOperation, LockShared
+	case "(*sync.Mutex).TryLock", "(*sync.RWMutex).TryLock":
+		return tryAcquireLockOperation, LockExclusive
+	case "(*sync.RWMutex).TryRLock":
+		return tryAcquireLockOperation, LockShared
 	}
 
 	if fn.Pkg != nil && fn.Pkg.Pkg.Path() == "sync" {
-		return true
+		switch fn.Name() {
+		case "Lock":
+			return acquireLockOperation, LockExclusive
+		case "RLock":
+			return acquireLockOperation, LockShared
+		}
+		return noLockOperation, LockExclusive
 	}
 
-	fullPath := fn.String()
-	return fullPath == "(*sync.Mutex).Lock" ||
-		fullPath == "(*sync.RWMutex).Lock" ||
-		fullPath == "(*sync.RWMutex).RLock"
+	return declaredLockOperation(fn, scope)
 }
 
-func isLockCall(call *ssa.Call) bool {
-	return isLockCallCommon(&call.Call)
-}
+// Lock and Unlock invoked through an interface value. The operation is the
+// one of the concrete methods the call dispatches to; when none can be
+// resolved, a sync.Locker is still known to be locked or unlocked.
+func invokedLockOperation(common *ssa.CallCommon, scope *analysisScope) (lockOperation, LockMode) {
+	op, mode := noLockOperation, LockExclusive
+	switch common.Method.Name() {
+	case "Lock", "RLock", "Unlock", "RUnlock", "TryLock", "TryRLock":
+	default:
+		return op, mode
+	}
 
-func isUnlockCallCommon(common *ssa.CallCommon) bool {
-	if common == nil {
-		return false
+	for _, target := range resolveDynamicCallCommonTargets(common.Value.Parent(), common, scope) {
+		targetOp, targetMode := functionLockOperation(target, scope)
+		if targetOp == noLockOperation {
+			continue
+		}
+		if op == noLockOperation {
+			op, mode = targetOp, targetMode
+			continue
+		}
+		// A lock is only known to be taken shared when every target does.
+		mode = max(mode, targetMode)
+	}
+	if op != noLockOperation || !isSyncLocker(common.Value.Type()) {
+		return op, mode
 	}
 
-	fn := common.StaticCallee()
-	if fn == nil {
-		return false
+	switch common.Method.Name() {
+	case "Lock":
+		return acquireLockOperation, LockExclusive
+	case "Unlock":
+		return releaseLockOperation, LockExclusive
 	}
+	return noLockOperation, LockExclusive
+}
 
-	name := fn.Name()
-	if name != "Unlock" && name != "RUnlock" {
+func isSyncLocker(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
 		return false
 	}
+	return named.Obj().Pkg().Path() == "sync" && named.Obj().Name() == "Locker"
+}
 
-	fullPath := fn.String()
-	return fullPath == "(*sync.Mutex).Unlock" ||
-		fullPath == "(*sync.RWMutex).Unlock" ||
-		fullPath == "(*sync.RWMutex).RUnlock"
+// TryLock and TryRLock, and their counterparts on lock types.
+func isTryLockCallCommon(common *ssa.CallCommon, scope *analysisScope) bool {
+	op, _ := callLockOperation(common, scope)
+	return op == tryAcquireLockOperation
 }
 
-func isUnlockCall(call *ssa.Call) bool {
-	return isUnlockCallCommon(&call.Call)
+func isLockCallCommon(common *ssa.CallCommon, scope *analysisScope) bool {
+	op, _ := callLockOperation(common, scope)
+	return op == acquireLockOperation
 }
 
-func getLockObject(instr *ssa.Call) types.Object {
-	if len(instr.Call.Args) == 0 {
+func isLockCall(call *ssa.Call, scope *analysisScope) bool {
+	return isLockCallCommon(&call.Call, scope)
+}
+
+// The mode a lock or unlock call operates on: RLock takes and RUnlock
+// releases a shared hold, as do lock methods declared shared; everything
+// else is exclusive.
+func lockModeForCallCommon(common *ssa.CallCommon, scope *analysisScope) LockMode {
+	_, mode := callLockOperation(common, scope)
+	return mode
+}
+
+func isUnlockCallCommon(common *ssa.CallCommon, scope *analysisScope) bool {
+	op, _ := callLockOperation(common, scope)
+	return op == releaseLockOperation
+}
+
+func isUnlockCall(call *ssa.Call, scope *analysisScope) bool {
+	return isUnlockCallCommon(&call.Call, scope)
+}
+
+// The lock a lock operation is made on: the receiver of the method, or the
+// value behind the interface it is invoked through.
+func lockReceiver(common *ssa.CallCommon) ssa.Value {
+	if common == nil {
 		return nil
 	}
+	if common.IsInvoke() {
+		return common.Value
+	}
+	if len(common.Args) == 0 {
+		return nil
+	}
+	return common.Args[0]
+}
 
-	receiver := instr.Call.Args[0]
-
-	return resolveValueToObject(receiver)
+func getLockObject(instr *ssa.Call) types.Object {
+	return getLockObjectFromCallCommon(&instr.Call)
 }
 
 func getLockObjectFromCallCommon(common *ssa.CallCommon) types.Object {
-	if common == nil || len(common.Args) == 0 {
+	receiver := lockReceiver(common)
+	if receiver == nil {
 		return nil
 	}
+	return resolveValueToObject(stripInterfaceConversions(receiver))
+}
 
-	receiver := common.Args[0]
-	return resolveValueToObject(receiver)
+func getLockKey(instr *ssa.Call) lockKey {
+	return getLockKeyFromCallCommon(&instr.Call)
+}
+
+func getLockKeyFromCallCommon(common *ssa.CallCommon) lockKey {
+	receiver := lockReceiver(common)
+	if receiver == nil {
+		return lockKey{}
+	}
+	return lockKeyForValue(receiver)
 }
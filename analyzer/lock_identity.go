@@ -0,0 +1,351 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// lockKey identifies a lock instance by its access path: the SSA value the
+// path starts from (a parameter, global, free variable or allocation) and the
+// dotted field selection from that root. Obj is the object the full path
+// denotes (the mutex field, or the root variable itself).
+//
+// When the root cannot be named (e.g., a lock reached through a call result,
+// a phi or a slice element), Root is nil and the lock is identified by Obj
+// alone. This is the field-only identity used before instance tracking and
+// conservatively equals every instance of that field.
+type lockKey struct {
+	Root ssa.Value
+	Path string
+	Obj  types.Object
+}
+
+func (k lockKey) IsZero() bool {
+	return k.Obj == nil
+}
+
+func (k lockKey) Name() string {
+	if k.Obj == nil {
+		return ""
+	}
+	return k.Obj.Name()
+}
+
+// fieldOnly drops the instance root, keeping the object-level identity.
+func (k lockKey) fieldOnly() lockKey {
+	return lockKey{Obj: k.Obj}
+}
+
+// QualifiedName renders the access path using source-level names where
+// possible (e.g., "from.mu"), falling back to the object name.
+func (k lockKey) QualifiedName() string {
+	if k.Root == nil {
+		return k.Name()
+	}
+
+	root := rootDisplayName(k.Root)
+	if root == "" {
+		return k.Name()
+	}
+	if k.Path == "" {
+		return root
+	}
+	return root + "." + k.Path
+}
+
+func rootDisplayName(root ssa.Value) string {
+	switch r := root.(type) {
+	case *ssa.Alloc:
+		// Synthetic allocations (composite literals, new(T)) carry no
+		// variable name; recover it from the assignment they appear in.
+		switch r.Comment {
+		case "", "complit", "new", "slicelit", "varargs":
+			return assignedVariableName(r.Parent(), r.Pos())
+		}
+		return r.Comment
+	case *ssa.Parameter, *ssa.Global, *ssa.FreeVar:
+		return r.Name()
+	}
+	return ""
+}
+
+// assignedVariableName returns the identifier a value at pos is assigned to
+// in fn's source (e.g., "a" for "a := &Account{}"), or "" if there is none.
+func assignedVariableName(fn *ssa.Function, pos token.Pos) string {
+	if fn == nil || fn.Syntax() == nil || pos == token.NoPos {
+		return ""
+	}
+
+	name := ""
+	ast.Inspect(fn.Syntax(), func(n ast.Node) bool {
+		if name != "" || n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != len(assign.Rhs) {
+			return true
+		}
+
+		for i, rhs := range assign.Rhs {
+			if pos < rhs.Pos() || pos >= rhs.End() {
+				continue
+			}
+			if ident, ok := assign.Lhs[i].(*ast.Ident); ok {
+				name = ident.Name
+			}
+		}
+		return false
+	})
+
+	return name
+}
+
+// equivalentLockKeys reports whether two keys may denote the same lock.
+// Keys rooted at comparable values must match exactly; if either side lost
+// its root, the object-level identity decides.
+func equivalentLockKeys(a lockKey, b lockKey) bool {
+	if a.IsZero() || b.IsZero() {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	if a.Obj != b.Obj {
+		return false
+	}
+	if a.Root == nil || b.Root == nil {
+		return true
+	}
+
+	// Roots local to different functions cannot be related here, so fall
+	// back to the field-only identity.
+	return !rootsComparable(a.Root, b.Root)
+}
+
+// rootsComparable reports whether two roots live in the same frame (or are
+// package-level), so that differing roots imply different instances.
+func rootsComparable(a ssa.Value, b ssa.Value) bool {
+	_, globalA := a.(*ssa.Global)
+	_, globalB := b.(*ssa.Global)
+	if globalA || globalB {
+		return true
+	}
+	return a.Parent() == b.Parent()
+}
+
+func joinLockPath(base string, rest string) string {
+	if base == "" {
+		return rest
+	}
+	if rest == "" {
+		return base
+	}
+	return base + "." + rest
+}
+
+// accessPathForValue walks a pointer-valued expression back to the value it
+// is rooted at, collecting the field selections on the way. A nil root means
+// the expression is not rooted at a nameable value.
+func accessPathForValue(val ssa.Value) (ssa.Value, string) {
+	for {
+		switch v := val.(type) {
+		case *ssa.FieldAddr:
+			ptr, ok := v.X.Type().Underlying().(*types.Pointer)
+			if !ok {
+				return nil, ""
+			}
+			strct, ok := ptr.Elem().Underlying().(*types.Struct)
+			if !ok {
+				return nil, ""
+			}
+			root, path := accessPathForValue(v.X)
+			if root == nil {
+				return nil, ""
+			}
+			return root, joinLockPath(path, strct.Field(v.Field).Name())
+		case *ssa.UnOp:
+			val = v.X
+		case *ssa.Parameter, *ssa.Global, *ssa.FreeVar:
+			return v, ""
+		case *ssa.Alloc:
+			return normalizeAllocRoot(v), ""
+		default:
+			return nil, ""
+		}
+	}
+}
+
+// Address-taken parameters are spilled to a local allocation on entry
+// (t0 = local T (p); *t0 = p). Treat such allocations as the parameter so
+// that annotation targets naming the parameter match the accesses.
+func normalizeAllocRoot(alloc *ssa.Alloc) ssa.Value {
+	refs := alloc.Referrers()
+	if refs == nil {
+		return alloc
+	}
+
+	for _, ref := range *refs {
+		store, ok := ref.(*ssa.Store)
+		if !ok || store.Addr != alloc {
+			continue
+		}
+		if param, ok := store.Val.(*ssa.Parameter); ok && param.Name() == alloc.Comment {
+			return param
+		}
+	}
+
+	return alloc
+}
+
+// lockKeyForValue resolves the receiver of a lock operation to its
+// instance-sensitive identity. A lock converted to an interface, such as a
+// sync.Locker, is the value it was converted from.
+func lockKeyForValue(val ssa.Value) lockKey {
+	val = stripInterfaceConversions(val)
+	obj := resolveValueToObject(val)
+	if obj == nil {
+		return lockKey{}
+	}
+
+	switch v := stripLoads(val).(type) {
+	case *ssa.FieldAddr:
+		root, path := accessPathForValue(v)
+		if root == nil {
+			return lockKey{Obj: obj}
+		}
+		return lockKey{Root: root, Path: path, Obj: obj}
+	case *ssa.Parameter, *ssa.Global:
+		return lockKey{Root: v, Obj: obj}
+	default:
+		// Slice/array elements and other unnamed containers keep the
+		// object-level identity.
+		return lockKey{Obj: obj}
+	}
+}
+
+func stripInterfaceConversions(val ssa.Value) ssa.Value {
+	for {
+		switch v := val.(type) {
+		case *ssa.MakeInterface:
+			val = v.X
+		case *ssa.ChangeInterface:
+			val = v.X
+		default:
+			return val
+		}
+	}
+}
+
+func stripLoads(val ssa.Value) ssa.Value {
+	for {
+		unop, ok := val.(*ssa.UnOp)
+		if !ok {
+			return val
+		}
+		val = unop.X
+	}
+}
+
+// lockKeyForField resolves the lock reached by selecting fieldPath from base.
+func lockKeyForField(base ssa.Value, fieldPath []string) lockKey {
+	if len(fieldPath) == 0 {
+		return lockKeyForValue(base)
+	}
+
+	obj := resolveNestedField(base.Type(), fieldPath)
+	if obj == nil {
+		return lockKey{}
+	}
+
+	root, path := accessPathForValue(base)
+	if root == nil {
+		return lockKey{Obj: obj}
+	}
+	return lockKey{Root: root, Path: joinLockPath(path, strings.Join(fieldPath, ".")), Obj: obj}
+}
+
+// invocationArgs returns the arguments of a call in terms of the callee's
+// parameters, prepending the receiver for interface method invocations.
+func invocationArgs(common *ssa.CallCommon) []ssa.Value {
+	if common == nil {
+		return nil
+	}
+	if common.IsInvoke() {
+		return append([]ssa.Value{common.Value}, common.Args...)
+	}
+	return common.Args
+}
+
+// closureBindings returns the values bound to a closure's free variables
+// when the call target is a closure literal.
+func closureBindings(common *ssa.CallCommon) []ssa.Value {
+	if common == nil {
+		return nil
+	}
+	if closure, ok := common.Value.(*ssa.MakeClosure); ok {
+		return closure.Bindings
+	}
+	return nil
+}
+
+// translateLockKey maps a key expressed in callee's frame into the frame of
+// the caller, substituting parameters and free variables with the values
+// bound at the invocation. Keys rooted at callee-local values can't be
+// named by the caller and degrade to their field-only identity.
+func translateLockKey(key lockKey, callee *ssa.Function, args []ssa.Value, bindings []ssa.Value) lockKey {
+	if key.IsZero() || key.Root == nil || callee == nil {
+		return key
+	}
+
+	var bound ssa.Value
+	switch root := key.Root.(type) {
+	case *ssa.Global:
+		return key
+	case *ssa.Parameter:
+		for i, p := range callee.Params {
+			if p == root && i < len(args) {
+				bound = args[i]
+				break
+			}
+		}
+	case *ssa.FreeVar:
+		for i, fv := range callee.FreeVars {
+			if fv == root && i < len(bindings) {
+				bound = bindings[i]
+				break
+			}
+		}
+	}
+
+	if bound == nil {
+		return key.fieldOnly()
+	}
+
+	if key.Path == "" {
+		if translated := lockKeyForValue(bound); !translated.IsZero() {
+			return translated
+		}
+		return key.fieldOnly()
+	}
+
+	root, path := accessPathForValue(bound)
+	if root == nil {
+		return key.fieldOnly()
+	}
+	return lockKey{Root: root, Path: joinLockPath(path, key.Path), Obj: key.Obj}
+}
+
+func translateLockSet(locks LockSet, callee *ssa.Function, common *ssa.CallCommon) LockSet {
+	out := make(LockSet, len(locks))
+	args := invocationArgs(common)
+	bindings := closureBindings(common)
+	for key, mode := range locks {
+		out.Add(translateLockKey(key, callee, args, bindings), mode)
+	}
+	return out
+}
@@ -0,0 +1,391 @@
+package analyzer
+
+import (
+	"go/token"
+	"gotsan/ir"
+	"gotsan/utils/report"
+	"sort"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Lock-order graph. Every acquisition order observed at a go statement or
+// call site contributes an edge A -> B for each lock A acquired before a lock
+// B. A cycle in the graph is a potential deadlock between the sites that
+// contributed its edges. Pairwise inversions (two-lock cycles) are reported by
+// findOrderInversion with their own messages; the graph reports the longer
+// cycles pairwise comparison cannot see.
+
+// lockOrderEdge is one observation of From being acquired before To. Fn and
+// Instr are where To was acquired; Site is the go statement or call, in
+// SiteFn, whose acquisition order contained the pair.
+type lockOrderEdge struct {
+	From   lockRef
+	To     lockRef
+	Fn     *ssa.Function
+	Instr  ssa.Instruction
+	SiteFn *ssa.Function
+	Site   ssa.Instruction
+}
+
+type lockOrderGraph struct {
+	nodes []lockRef
+	// edges[from][to] lists every observation of the edge, in insertion order.
+	edges map[int]map[int][]lockOrderEdge
+}
+
+func newLockOrderGraph() *lockOrderGraph {
+	return &lockOrderGraph{edges: make(map[int]map[int][]lockOrderEdge)}
+}
+
+// node returns the index of the node for lock, adding it if needed.
+func (g *lockOrderGraph) node(lock lockRef) int {
+	if idx := indexOfLock(g.nodes, lock); idx != -1 {
+		return idx
+	}
+	g.nodes = append(g.nodes, lock)
+	return len(g.nodes) - 1
+}
+
+// addOrder adds the edges of an acquisition order observed at site.
+func (g *lockOrderGraph) addOrder(order []lockRef, siteFn *ssa.Function, site ssa.Instruction) {
+	for i := 0; i < len(order); i++ {
+		for j := i + 1; j < len(order); j++ {
+			if sameLock(order[i], order[j]) {
+				continue
+			}
+			g.addEdge(order[i], order[j], siteFn, site)
+		}
+	}
+}
+
+// addEdge adds one observation of from -> to, made at site: to is acquired,
+// or waited for, at to.Instr while from is held.
+func (g *lockOrderGraph) addEdge(from lockRef, to lockRef, siteFn *ssa.Function, site ssa.Instruction) {
+	fromIdx := g.node(from)
+	toIdx := g.node(to)
+	if g.edges[fromIdx] == nil {
+		g.edges[fromIdx] = make(map[int][]lockOrderEdge)
+	}
+	g.edges[fromIdx][toIdx] = append(g.edges[fromIdx][toIdx], lockOrderEdge{
+		From:   from,
+		To:     to,
+		Fn:     to.Fn,
+		Instr:  to.Instr,
+		SiteFn: siteFn,
+		Site:   site,
+	})
+}
+
+func (g *lockOrderGraph) successors(from int) []int {
+	succs := make([]int, 0, len(g.edges[from]))
+	for to := range g.edges[from] {
+		succs = append(succs, to)
+	}
+	sort.Ints(succs)
+	return succs
+}
+
+// stronglyConnectedComponents returns the components with more than one node.
+func (g *lockOrderGraph) stronglyConnectedComponents() [][]int {
+	index := 0
+	stack := make([]int, 0, len(g.nodes))
+	onStack := make(map[int]bool, len(g.nodes))
+	indices := make(map[int]int, len(g.nodes))
+	lowlink := make(map[int]int, len(g.nodes))
+	components := make([][]int, 0)
+
+	var strongConnect func(v int)
+	strongConnect = func(v int) {
+		indices[v] = index
+		lowlink[v] = index
+		index++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range g.successors(v) {
+			if _, seen := indices[w]; !seen {
+				strongConnect(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+				continue
+			}
+
+			if onStack[w] && indices[w] < lowlink[v] {
+				lowlink[v] = indices[w]
+			}
+		}
+
+		if lowlink[v] != indices[v] {
+			return
+		}
+
+		component := make([]int, 0)
+		for {
+			last := len(stack) - 1
+			w := stack[last]
+			stack = stack[:last]
+			onStack[w] = false
+			component = append(component, w)
+
+			if w == v {
+				break
+			}
+		}
+
+		if len(component) > 1 {
+			sort.Ints(component)
+			components = append(components, component)
+		}
+	}
+
+	for v := range g.nodes {
+		if _, seen := indices[v]; !seen {
+			strongConnect(v)
+		}
+	}
+
+	return components
+}
+
+// shortestCycle returns the nodes of a shortest cycle through start that
+// stays within component, found breadth-first.
+func (g *lockOrderGraph) shortestCycle(start int, component []int) []int {
+	inComponent := make(map[int]bool, len(component))
+	for _, v := range component {
+		inComponent[v] = true
+	}
+
+	parent := map[int]int{start: -1}
+	queue := []int{start}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		for _, next := range g.successors(curr) {
+			if !inComponent[next] {
+				continue
+			}
+			if next == start {
+				cycle := []int{}
+				for v := curr; v != -1; v = parent[v] {
+					cycle = append([]int{v}, cycle...)
+				}
+				return cycle
+			}
+			if _, seen := parent[next]; seen {
+				continue
+			}
+			parent[next] = curr
+			queue = append(queue, next)
+		}
+	}
+
+	return nil
+}
+
+// representativeEdge picks the observation of from -> to reported for the
+// cycle: the earliest in the source, preferring one whose site differs from
+// avoid so the cycle spans several sites where it can.
+func (g *lockOrderGraph) representativeEdge(from int, to int, avoid ssa.Instruction) lockOrderEdge {
+	observations := g.edges[from][to]
+	best := observations[0]
+	for _, edge := range observations[1:] {
+		if (best.Site == avoid) != (edge.Site == avoid) {
+			if best.Site == avoid {
+				best = edge
+			}
+			continue
+		}
+		if edgePos(edge) < edgePos(best) {
+			best = edge
+		}
+	}
+	return best
+}
+
+func edgePos(edge lockOrderEdge) token.Pos {
+	if edge.Instr != nil && edge.Instr.Pos() != token.NoPos {
+		return edge.Instr.Pos()
+	}
+	if edge.Site != nil {
+		return edge.Site.Pos()
+	}
+	return token.NoPos
+}
+
+// A cycle only deadlocks if its edges come from more than one site, and if at
+// every lock the thread holding it and the thread waiting for it exclude
+// each other (not both read locks).
+func cycleCanDeadlock(cycle []lockOrderEdge) bool {
+	sites := make(map[ssa.Instruction]bool, len(cycle))
+	for i, edge := range cycle {
+		sites[edge.Site] = true
+		next := cycle[(i+1)%len(cycle)]
+		if !acquisitionsConflict(edge.To, next.From) {
+			return false
+		}
+	}
+	return len(sites) > 1
+}
+
+// Report the deadlock cycles of three or more locks in g.
+func (g *lockOrderGraph) reportCycles(reporter *report.Reporter, fset *token.FileSet) {
+	for _, cycle := range g.deadlockCycles() {
+		reportLockOrderCycle(cycle, reporter, fset)
+	}
+}
+
+// deadlockCycles returns, for each component of g, the first cycle of three
+// or more locks that can deadlock, trying the shortest cycle through each
+// node in turn. Components tied together by two-lock inversions alone are
+// skipped: those are reported pairwise.
+func (g *lockOrderGraph) deadlockCycles() [][]lockOrderEdge {
+	cycles := make([][]lockOrderEdge, 0)
+	for _, component := range g.stronglyConnectedComponents() {
+		if len(component) < 3 {
+			continue
+		}
+
+		for _, start := range component {
+			nodes := g.shortestCycle(start, component)
+			if len(nodes) < 3 {
+				continue
+			}
+
+			cycle := make([]lockOrderEdge, 0, len(nodes))
+			var previous ssa.Instruction
+			for i, from := range nodes {
+				edge := g.representativeEdge(from, nodes[(i+1)%len(nodes)], previous)
+				cycle = append(cycle, edge)
+				previous = edge.Site
+			}
+
+			if cycleCanDeadlock(cycle) {
+				cycles = append(cycles, cycle)
+				break
+			}
+		}
+	}
+	return cycles
+}
+
+// Report the cycles of g, a combined lock/channel wait-for graph, through a
+// channel operation. Two-node cycles, a lock held across a channel
+// operation whose other end needs it, are reported where the operation is
+// checked (see checkBlockingOperation), and cycles of locks alone by the
+// lock-order graph.
+func (g *lockOrderGraph) reportChannelWaitCycles(reporter *report.Reporter, fset *token.FileSet) {
+	for _, component := range g.stronglyConnectedComponents() {
+		if len(component) < 3 {
+			continue
+		}
+
+		for _, start := range component {
+			if !g.nodes[start].isChannel() {
+				continue
+			}
+
+			nodes := g.shortestCycle(start, component)
+			if len(nodes) < 3 {
+				continue
+			}
+
+			// Start from the edge into the channel operation: the lock
+			// held while blocking on it.
+			cycle := make([]lockOrderEdge, 0, len(nodes))
+			var previous ssa.Instruction
+			for i := range nodes {
+				from := nodes[(i+len(nodes)-1)%len(nodes)]
+				edge := g.representativeEdge(from, nodes[i], previous)
+				cycle = append(cycle, edge)
+				previous = edge.Site
+			}
+
+			if waitCycleCanDeadlock(cycle) {
+				reportLockChannelCycle(cycle, reporter, fset)
+				break
+			}
+		}
+	}
+}
+
+// At every lock of the cycle, the goroutine waiting for it and the one
+// holding it must exclude each other.
+func waitCycleCanDeadlock(cycle []lockOrderEdge) bool {
+	for i, edge := range cycle {
+		next := cycle[(i+1)%len(cycle)]
+		if !edge.To.isChannel() && !acquisitionsConflict(edge.To, next.From) {
+			return false
+		}
+	}
+	return true
+}
+
+func addGoSitesToLockOrderGraph(graph *lockOrderGraph, fn *ssa.Function, registry *ir.ContractRegistry, scope *analysisScope) {
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if goInstr, ok := instr.(*ssa.Go); ok {
+				graph.addOrder(acquireOrderForGoSite(fn, goInstr, registry, scope), fn, goInstr)
+			}
+		}
+	}
+}
+
+func addCallSitesToLockOrderGraph(graph *lockOrderGraph, fn *ssa.Function, registry *ir.ContractRegistry, scope *analysisScope) {
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			if callInstr, ok := instr.(*ssa.Call); ok && callInstr.Call.StaticCallee() != nil {
+				graph.addOrder(acquireOrderForCallSite(fn, callInstr, registry, scope), fn, callInstr)
+			}
+		}
+	}
+}
+
+// Detect lock-order cycles of any length. Lenient mode builds one graph per
+// function from the goroutines it launches, mirroring
+// detectGoroutineLockOrderInversions; strict mode builds a single graph for
+// the package from every go statement and call site.
+func detectLockOrderCycles(
+	pkg *ssa.Package,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	strictMode bool,
+) {
+	if pkg == nil || registry == nil {
+		return
+	}
+
+	functions := make([]*ssa.Function, 0)
+	for fn := range collectPackageFunctions(pkg, scope) {
+		if fn != nil && len(fn.Blocks) > 0 {
+			functions = append(functions, fn)
+		}
+	}
+	// Node and edge order follow function order; keep reports stable.
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Pos() != functions[j].Pos() {
+			return functions[i].Pos() < functions[j].Pos()
+		}
+		return functions[i].String() < functions[j].String()
+	})
+
+	if !strictMode {
+		for _, fn := range functions {
+			graph := newLockOrderGraph()
+			addGoSitesToLockOrderGraph(graph, fn, registry, scope)
+			graph.reportCycles(reporter, fset)
+		}
+		return
+	}
+
+	graph := newLockOrderGraph()
+	for _, fn := range functions {
+		addGoSitesToLockOrderGraph(graph, fn, registry, scope)
+		addCallSitesToLockOrderGraph(graph, fn, registry, scope)
+	}
+	graph.reportCycles(reporter, fset)
+}
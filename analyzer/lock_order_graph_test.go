@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+func TestLockOrderGraphFindsThreeLockCycle(t *testing.T) {
+	a := lockRef{Obj: types.NewVar(token.NoPos, nil, "a", types.Typ[types.Int])}
+	b := lockRef{Obj: types.NewVar(token.NoPos, nil, "b", types.Typ[types.Int])}
+	c := lockRef{Obj: types.NewVar(token.NoPos, nil, "c", types.Typ[types.Int])}
+
+	siteAB, siteBC, siteCA := &ssa.Go{}, &ssa.Go{}, &ssa.Go{}
+	g := newLockOrderGraph()
+	g.addOrder([]lockRef{a, b}, nil, siteAB)
+	g.addOrder([]lockRef{b, c}, nil, siteBC)
+	g.addOrder([]lockRef{c, a}, nil, siteCA)
+
+	components := g.stronglyConnectedComponents()
+	if len(components) != 1 || len(components[0]) != 3 {
+		t.Fatalf("expected one component of three locks, got %v", components)
+	}
+
+	cycle := g.shortestCycle(components[0][0], components[0])
+	if len(cycle) != 3 {
+		t.Fatalf("expected a three-lock cycle, got %v", cycle)
+	}
+
+	edges := make([]lockOrderEdge, 0, len(cycle))
+	for i, from := range cycle {
+		edges = append(edges, g.representativeEdge(from, cycle[(i+1)%len(cycle)], nil))
+	}
+	if !cycleCanDeadlock(edges) {
+		t.Fatal("expected cycle across three sites to deadlock")
+	}
+}
+
+func TestLockOrderGraphFindsCycleBehindTwoLockInversion(t *testing.T) {
+	a := lockRef{Obj: types.NewVar(token.NoPos, nil, "a", types.Typ[types.Int])}
+	b := lockRef{Obj: types.NewVar(token.NoPos, nil, "b", types.Typ[types.Int])}
+	c := lockRef{Obj: types.NewVar(token.NoPos, nil, "c", types.Typ[types.Int])}
+	d := lockRef{Obj: types.NewVar(token.NoPos, nil, "d", types.Typ[types.Int])}
+
+	g := newLockOrderGraph()
+	// a is both in the inversion a <-> d and in the cycle a -> b -> c -> a;
+	// the shortest cycle through a is the inversion.
+	g.addOrder([]lockRef{a, d}, nil, &ssa.Go{})
+	g.addOrder([]lockRef{d, a}, nil, &ssa.Go{})
+	g.addOrder([]lockRef{a, b}, nil, &ssa.Go{})
+	g.addOrder([]lockRef{b, c}, nil, &ssa.Go{})
+	g.addOrder([]lockRef{c, a}, nil, &ssa.Go{})
+
+	components := g.stronglyConnectedComponents()
+	if len(components) != 1 || components[0][0] != g.node(a) {
+		t.Fatalf("expected one component starting at a, got %v", components)
+	}
+	if cycle := g.shortestCycle(g.node(a), components[0]); len(cycle) != 2 {
+		t.Fatalf("expected the shortest cycle through a to be the inversion, got %v", cycle)
+	}
+
+	cycles := g.deadlockCycles()
+	if len(cycles) != 1 || len(cycles[0]) != 3 {
+		t.Fatalf("expected the three-lock cycle, got %v", cycles)
+	}
+	for _, edge := range cycles[0] {
+		if sameLock(edge.From, d) || sameLock(edge.To, d) {
+			t.Fatalf("expected a cycle through a, b and c, got %v", cycles[0])
+		}
+	}
+}
+
+func TestLockOrderGraphIgnoresSingleSiteCycle(t *testing.T) {
+	a := lockRef{Obj: types.NewVar(token.NoPos, nil, "a", types.Typ[types.Int])}
+	b := lockRef{Obj: types.NewVar(token.NoPos, nil, "b", types.Typ[types.Int])}
+
+	site := &ssa.Go{}
+	g := newLockOrderGraph()
+	g.addOrder([]lockRef{a, b, a}, nil, site)
+
+	edges := []lockOrderEdge{
+		g.representativeEdge(0, 1, nil),
+		g.representativeEdge(1, 0, nil),
+	}
+	if cycleCanDeadlock(edges) {
+		t.Fatal("a cycle observed at a single site is sequential, not a deadlock")
+	}
+}
+
+func TestLockOrderGraphReadLocksDoNotCloseCycle(t *testing.T) {
+	a := lockRef{Obj: types.NewVar(token.NoPos, nil, "a", types.Typ[types.Int]), Mode: LockShared}
+	b := lockRef{Obj: types.NewVar(token.NoPos, nil, "b", types.Typ[types.Int])}
+
+	edges := []lockOrderEdge{
+		{From: a, To: b, Site: &ssa.Go{}},
+		{From: b, To: a, Site: &ssa.Go{}},
+	}
+	if cycleCanDeadlock(edges) {
+		t.Fatal("two read acquisitions of a do not block each other")
+	}
+}
+
+func TestLockOrderGraphFindsLockChannelCycle(t *testing.T) {
+	a := lockRef{Obj: types.NewVar(token.NoPos, nil, "a", types.Typ[types.Int])}
+	b := lockRef{Obj: types.NewVar(token.NoPos, nil, "b", types.Typ[types.Int])}
+	ch := &ssa.MakeChan{}
+	send := lockRef{Chan: ch, Dir: channelSend, Instr: &ssa.Send{}}
+	otherSend := lockRef{Chan: ch, Dir: channelSend, Instr: &ssa.Send{}}
+	if sameLock(send, otherSend) || sameLock(send, a) {
+		t.Fatal("each channel operation is a node of its own")
+	}
+
+	g := newLockOrderGraph()
+	g.addEdge(a, send, nil, &ssa.Go{})
+	g.addEdge(send, b, nil, &ssa.Go{})
+	g.addEdge(b, a, nil, &ssa.Go{})
+
+	components := g.stronglyConnectedComponents()
+	if len(components) != 1 || len(components[0]) != 3 {
+		t.Fatalf("expected one component of a lock, a channel operation and a lock, got %v", components)
+	}
+
+	cycle := g.shortestCycle(g.node(send), components[0])
+	edges := make([]lockOrderEdge, 0, len(cycle))
+	for i, from := range cycle {
+		edges = append(edges, g.representativeEdge(from, cycle[(i+1)%len(cycle)], nil))
+	}
+	if len(edges) != 3 || !waitCycleCanDeadlock(edges) {
+		t.Fatalf("expected a three-node wait-for cycle, got %v", cycle)
+	}
+
+	edges[1].To.Mode = LockShared
+	edges[2].From.Mode = LockShared
+	if waitCycleCanDeadlock(edges) {
+		t.Fatal("a read lock waited for while read-locked does not close the cycle")
+	}
+}
@@ -0,0 +1,91 @@
+package analyzer
+
+import (
+	"go/types"
+	"gotsan/ir"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// User-defined lock types: types annotated @lock_type, whose Lock, RLock,
+// Unlock, RUnlock, TryLock and TryRLock methods act on their receiver as
+// those of sync.RWMutex do, and methods annotated @lock_method or @unlock_method.
+// Lock calls are recognized against the registry of the run (see
+// analysisScope).
+
+func declaresLockMethods(registry *ir.ContractRegistry) bool {
+	if registry == nil {
+		return false
+	}
+	for _, contracts := range []map[string]*ir.FunctionContract{registry.QualifiedFunctions, registry.Functions} {
+		for _, contract := range contracts {
+			if contract != nil && (len(contract.Expectations[ir.LockMethod]) > 0 || len(contract.Expectations[ir.UnlockMethod]) > 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The lock operation a method declared by the user performs on its
+// receiver: the one its @lock_method or @unlock_method annotation names or,
+// on a @lock_type, the one of the sync.RWMutex method of the same name.
+func declaredLockOperation(fn *ssa.Function, scope *analysisScope) (lockOperation, LockMode) {
+	if fn == nil || fn.Signature == nil || fn.Signature.Recv() == nil {
+		return noLockOperation, LockExclusive
+	}
+	if scope == nil || scope.registry == nil {
+		return noLockOperation, LockExclusive
+	}
+
+	if scope.declaresLockMethods {
+		if contract := contractForFunction(fn, scope.registry); contract != nil {
+			if exps := contract.Expectations[ir.LockMethod]; len(exps) > 0 {
+				return acquireLockOperation, declaredLockMode(exps[0])
+			}
+			if exps := contract.Expectations[ir.UnlockMethod]; len(exps) > 0 {
+				return releaseLockOperation, declaredLockMode(exps[0])
+			}
+		}
+	}
+
+	if !isDeclaredLockType(scope.registry, fn.Signature.Recv().Type()) {
+		return noLockOperation, LockExclusive
+	}
+
+	switch fn.Name() {
+	case "Lock":
+		return acquireLockOperation, LockExclusive
+	case "RLock":
+		return acquireLockOperation, LockShared
+	case "Unlock":
+		return releaseLockOperation, LockExclusive
+	case "RUnlock":
+		return releaseLockOperation, LockShared
+	case "TryLock":
+		return tryAcquireLockOperation, LockExclusive
+	case "TryRLock":
+		return tryAcquireLockOperation, LockShared
+	}
+	return noLockOperation, LockExclusive
+}
+
+func declaredLockMode(exp ir.Requirement) LockMode {
+	if exp.Target == ir.SharedLockMode {
+		return LockShared
+	}
+	return LockExclusive
+}
+
+// Whether t, or the type t points to, is annotated @lock_type.
+func isDeclaredLockType(registry *ir.ContractRegistry, t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+	return registry.IsLockType(named.Obj().Pkg().Path(), named.Obj().Name())
+}
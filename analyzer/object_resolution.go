@@ -10,22 +10,73 @@ import (
 // Methods to resolve mutex references to an types.Object
 // form, found in the SSA form
 
-func findInParams(fn *ssa.Function, name string) types.Object {
+func findInParams(fn *ssa.Function, name string) lockKey {
 	for _, p := range fn.Params {
 		if p.Name() == name {
-			return p.Object()
+			return lockKey{Root: p, Obj: p.Object()}
 		}
 	}
-	return nil
+	return lockKey{}
 }
 
-func findInPackageGlobals(fn *ssa.Function, name string) types.Object {
+func findInPackageGlobals(fn *ssa.Function, name string) lockKey {
 	if fn.Pkg != nil {
 		if member, ok := fn.Pkg.Members[name]; ok {
-			return member.Object()
+			if global, ok := member.(*ssa.Global); ok {
+				return lockKey{Root: global, Obj: global.Object()}
+			}
+			if obj := member.Object(); obj != nil {
+				return lockKey{Obj: obj}
+			}
+		}
+	}
+	return lockKey{}
+}
+
+// Look up a package-level variable of a package imported by fn's package,
+// named by the imported package's name (e.g., "store" and "Mu" for store.Mu).
+func findInImportedGlobals(fn *ssa.Function, pkgName string, name string) lockKey {
+	if fn == nil || fn.Pkg == nil || fn.Pkg.Pkg == nil {
+		return lockKey{}
+	}
+
+	for _, imp := range fn.Pkg.Pkg.Imports() {
+		if imp.Name() != pkgName {
+			continue
 		}
+
+		importedPkg := fn.Prog.Package(imp)
+		if importedPkg == nil {
+			continue
+		}
+		if global, ok := importedPkg.Members[name].(*ssa.Global); ok {
+			return lockKey{Root: global, Obj: global.Object()}
+		}
+	}
+
+	return lockKey{}
+}
+
+// Resolve a dotted target rooted at a package-level variable: "cfg.mu" for a
+// global of fn's own package, or "store.Mu" / "store.Cfg.mu" for a global of
+// an imported package.
+func resolveGlobalTarget(fn *ssa.Function, parts []string) lockKey {
+	if len(parts) == 0 {
+		return lockKey{}
+	}
+
+	if global, ok := findInPackageGlobals(fn, parts[0]).Root.(*ssa.Global); ok {
+		return lockKeyForField(global, parts[1:])
+	}
+
+	if len(parts) < 2 {
+		return lockKey{}
+	}
+	if global, ok := findInImportedGlobals(fn, parts[0], parts[1]).Root.(*ssa.Global); ok {
+		return lockKeyForField(global, parts[2:])
 	}
-	return nil
+
+	return lockKey{}
 }
 
 // Helper to handle the pointer/struct traversal logic
@@ -112,25 +163,25 @@ func resolveValueToObject(val ssa.Value) types.Object {
 // resolveIdentifier handles simple identifiers (e.g., "mu") that are not accessed through
 // any structs. Receiver fields are intentionally not resolved here — annotations on methods
 // must use the explicit receiver prefix (e.g., "a.mu" rather than bare "mu").
-func resolveIdentifier(fn *ssa.Function, name string) types.Object {
+func resolveIdentifier(fn *ssa.Function, name string) lockKey {
 	// 1. Check Parameters (includes the receiver variable itself)
-	if obj := findInParams(fn, name); obj != nil {
-		return obj
+	if key := findInParams(fn, name); !key.IsZero() {
+		return key
 	}
 
 	// 2. Check Package Globals
 	return findInPackageGlobals(fn, name)
 }
 
-// Returns the object of variables accessed through a parent struct.
+// Returns the lock of variables accessed through a parent struct.
 // Or, more simply, are contained and accessed with a period (e.g., "a.mu" or "mu.lock")
-func resolveMultiAccess(fn *ssa.Function, parts []string) types.Object {
+func resolveMultiAccess(fn *ssa.Function, parts []string) lockKey {
 	first := parts[0]
 
 	// 1. Check if the first part is a parameter (includes receiver)
 	for _, p := range fn.Params {
 		if p.Name() == first {
-			return resolveNestedField(p.Type(), parts[1:])
+			return lockKeyForField(p, parts[1:])
 		}
 	}
 
@@ -138,10 +189,10 @@ func resolveMultiAccess(fn *ssa.Function, parts []string) types.Object {
 	if len(fn.Params) > 0 {
 		recv := fn.Params[0]
 		// Case: "field.subfield" where "field" is on the receiver
-		return resolveNestedField(recv.Type(), parts)
+		return lockKeyForField(recv, parts)
 	}
 
-	return nil
+	return lockKey{}
 }
 
 func splitTarget(targetName string) []string {
@@ -158,64 +209,92 @@ func resolveValueField(val ssa.Value, fieldPath []string) types.Object {
 	return resolveNestedField(val.Type(), fieldPath)
 }
 
-func resolveNamedTypeField(fn *ssa.Function, typeName string, fieldPath []string) types.Object {
+// Type-qualified targets (e.g., "Account.mu") name a field but no instance,
+// so they resolve to the field-only identity.
+func resolveNamedTypeField(fn *ssa.Function, typeName string, fieldPath []string) lockKey {
 	if fn == nil || fn.Pkg == nil || typeName == "" || len(fieldPath) == 0 {
-		return nil
+		return lockKey{}
 	}
 
 	member, ok := fn.Pkg.Members[typeName]
 	if !ok {
-		return nil
+		return lockKey{}
 	}
 
 	typeMember, ok := member.(*ssa.Type)
 	if !ok || typeMember == nil {
-		return nil
+		return lockKey{}
 	}
 
-	return resolveNestedField(typeMember.Type(), fieldPath)
+	return lockKey{Obj: resolveNestedField(typeMember.Type(), fieldPath)}
 }
 
-// Resolve a mutex variable name in an annotation to the corresponding assignment
+// Resolve a mutex variable name in an annotation to the corresponding lock
 // in the SSA blocks
-func resolveObjectInScope(fn *ssa.Function, targetName string) types.Object {
+func resolveLockKeyInScope(fn *ssa.Function, targetName string) lockKey {
 	parts := splitTarget(targetName)
 	if len(parts) == 0 {
-		return nil
+		return lockKey{}
 	}
 
 	if len(parts) == 1 {
 		return resolveIdentifier(fn, targetName)
 	}
 
-	obj := resolveMultiAccess(fn, parts)
-	if obj != nil {
-		return obj
+	key := resolveMultiAccess(fn, parts)
+	if !key.IsZero() {
+		return key
 	}
 
-	if obj := resolveNamedTypeField(fn, parts[0], parts[1:]); obj != nil {
-		return obj
+	if key := resolveGlobalTarget(fn, parts); !key.IsZero() {
+		return key
+	}
+
+	if key := resolveNamedTypeField(fn, parts[0], parts[1:]); !key.IsZero() {
+		return key
 	}
 
 	return resolveObservedFieldAccess(fn, parts[1:])
 }
 
-func resolveParamField(callee *ssa.Function, callArgs []ssa.Value, parts []string) types.Object {
+func resolveParamField(callee *ssa.Function, callArgs []ssa.Value, parts []string) lockKey {
 	first := parts[0]
-	for i, p := range callee.Params {
-		if p.Name() == first && i < len(callArgs) {
-			return resolveValueField(callArgs[i], parts[1:])
+	for i, name := range paramNames(callee) {
+		if name == first && i < len(callArgs) {
+			return lockKeyForField(callArgs[i], parts[1:])
 		}
 	}
-	return nil
+	return lockKey{}
+}
+
+// Parameter names of fn, receiver first. Functions loaded from export data
+// (other packages analyzed separately) have no SSA parameters; their names
+// come from the signature.
+func paramNames(fn *ssa.Function) []string {
+	names := make([]string, 0, len(fn.Params))
+	if len(fn.Params) > 0 || len(fn.Blocks) > 0 || fn.Signature == nil {
+		for _, p := range fn.Params {
+			names = append(names, p.Name())
+		}
+		return names
+	}
+
+	if recv := fn.Signature.Recv(); recv != nil {
+		names = append(names, recv.Name())
+	}
+	for i := 0; i < fn.Signature.Params().Len(); i++ {
+		names = append(names, fn.Signature.Params().At(i).Name())
+	}
+	return names
 }
 
 // When annotation roots refer to callee-local aliases (e.g., info.lock), there is
 // no direct caller argument mapping. In that case, infer the target by scanning
-// SSA values in the callee for a unique field-path match.
-func resolveObservedFieldAccess(fn *ssa.Function, fieldPath []string) types.Object {
+// SSA values in the callee for a unique field-path match. The alias itself
+// can't be named, so the match keeps the field-only identity.
+func resolveObservedFieldAccess(fn *ssa.Function, fieldPath []string) lockKey {
 	if fn == nil || len(fieldPath) == 0 {
-		return nil
+		return lockKey{}
 	}
 
 	var candidate types.Object
@@ -233,7 +312,7 @@ func resolveObservedFieldAccess(fn *ssa.Function, fieldPath []string) types.Obje
 		}
 
 		if candidate != obj {
-			return nil
+			return lockKey{}
 		}
 	}
 
@@ -255,50 +334,63 @@ func resolveObservedFieldAccess(fn *ssa.Function, fieldPath []string) types.Obje
 			}
 
 			if candidate != obj {
-				return nil
+				return lockKey{}
 			}
 		}
 	}
 
-	return candidate
+	if candidate == nil {
+		return lockKey{}
+	}
+	return lockKey{Obj: candidate}
 }
 
-func resolveObjectAtInvocation(callee *ssa.Function, callArgs []ssa.Value, targetName string) types.Object {
+// Resolve an annotation target of callee to the lock it denotes in the
+// caller, mapping callee parameters to the values passed at the invocation.
+func resolveLockKeyAtInvocation(callee *ssa.Function, callArgs []ssa.Value, targetName string) lockKey {
 	if callee == nil || targetName == "" {
-		return nil
+		return lockKey{}
 	}
 
 	parts := splitTarget(targetName)
 	if len(parts) == 0 {
-		return nil
+		return lockKey{}
 	}
 
 	// Try mapping to explicit parameters.
-	obj := resolveParamField(callee, callArgs, parts)
-	if obj != nil {
-		return obj
+	key := resolveParamField(callee, callArgs, parts)
+	if !key.IsZero() {
+		return key
 	}
 
-	if obj := resolveNamedTypeField(callee, parts[0], parts[1:]); obj != nil {
-		return obj
+	// Globals, including those of imported packages, are the same lock in
+	// every frame.
+	if len(parts) > 1 {
+		if key := resolveGlobalTarget(callee, parts); !key.IsZero() {
+			return key
+		}
+	}
+
+	if key := resolveNamedTypeField(callee, parts[0], parts[1:]); !key.IsZero() {
+		return key
 	}
 
 	// Fallback for package-level identifiers (e.g., @requires(mu) where mu is a global).
 	if len(parts) == 1 {
-		if obj := findInPackageGlobals(callee, targetName); obj != nil {
-			return obj
+		if key := findInPackageGlobals(callee, targetName); !key.IsZero() {
+			return key
 		}
 	}
 
 	// Fallback for callee-local aliases that eventually access a field
 	// (e.g., local 'info' in '@acquires(info.lock)').
 	if len(parts) > 1 {
-		if obj := resolveObservedFieldAccess(callee, parts[1:]); obj != nil {
-			return obj
+		if key := resolveObservedFieldAccess(callee, parts[1:]); !key.IsZero() {
+			return key
 		}
 	}
 
-	return nil
+	return lockKey{}
 }
 
 // annotationRootIsCallsiteLocal reports whether a contract target root cannot be
@@ -321,21 +413,47 @@ func annotationRootIsCallsiteLocal(callee *ssa.Function, targetName string) bool
 		}
 	}
 
-	if findInPackageGlobals(callee, root) != nil {
+	if !findInPackageGlobals(callee, root).IsZero() || !resolveGlobalTarget(callee, parts).IsZero() {
 		return false
 	}
 
 	return true
 }
 
-// Resolve object at the location of the call of a function
+// Resolve lock at the location of the call of a function
 // This is used to resolve the mutex names in the annotations
-// (of the callee function) to the SSA object and check the lockset
-func resolveObjectAtCallSite(call *ssa.Call, targetName string) types.Object {
+// (of the callee function) to the caller's lock and check the lockset
+func resolveLockKeyAtCallSite(call *ssa.Call, targetName string) lockKey {
 	callee := call.Call.StaticCallee()
 	if callee == nil {
-		return nil
+		return lockKey{}
 	}
 
-	return resolveObjectAtInvocation(callee, call.Call.Args, targetName)
+	return resolveLockKeyAtInvocation(callee, call.Call.Args, targetName)
+}
+
+// Resolve an annotation target of callee to the lock it denotes in the
+// caller at call, where callee is the static callee or one of the dynamic
+// targets of call (a callback or an interface method). When callee's
+// parameters can't be mapped to the values passed, e.g. the receiver bound
+// in a method value, the target falls back to its field-only identity.
+func resolveLockKeyAtCall(callee *ssa.Function, call *ssa.Call, targetName string) lockKey {
+	if callee == nil || call == nil {
+		return lockKey{}
+	}
+	if method := boundMethodTarget(callee); method != callee {
+		return resolveLockKeyInScope(method, targetName).fieldOnly()
+	}
+	if call.Call.StaticCallee() == callee {
+		return resolveLockKeyAtCallSite(call, targetName)
+	}
+
+	args := call.Call.Args
+	if call.Call.IsInvoke() {
+		args = append([]ssa.Value{call.Call.Value}, args...)
+	}
+	if key := resolveLockKeyAtInvocation(callee, args, targetName); !key.IsZero() {
+		return key
+	}
+	return resolveLockKeyInScope(callee, targetName).fieldOnly()
 }
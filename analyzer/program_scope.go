@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"gotsan/ir"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// analysisScope is what a run of the analyzer sees, built when the run
+// starts (see Run and RunProgram) and passed to the helpers that need it.
+//
+// Whole-program runs analyze every loaded SSA package of one program
+// together. In such a run, package-scoped lookups (collectPackageFunctions
+// and the call graph, binding and dispatch resolution built on it) widen
+// from a single package to all packages of the run, so that locks defined in
+// one package and taken in another are seen by the same call graph and
+// lock-order graph.
+//
+// The scope also carries the run's registry, so that lock calls on the lock
+// types and lock methods it declares are recognized wherever lock calls are
+// (see declaredLockOperation).
+type analysisScope struct {
+	// The packages of a whole-program run; nil when packages are analyzed
+	// one at a time.
+	program  []*ssa.Package
+	registry *ir.ContractRegistry
+	// Whether any contract declares a lock method, so that calls need not
+	// look up contracts otherwise.
+	declaresLockMethods bool
+	// The channel waits of the goroutines launched in the run's packages,
+	// collected once when the run starts (see collectGoroutineChannelWaits).
+	goroutineWaits []goroutineChannelWait
+	// Memoized channelOrigins.
+	channelOrigins map[ssa.Value]map[any]bool
+}
+
+// newPackageScope returns the scope of a run that analyzes one package
+// against registry.
+func newPackageScope(registry *ir.ContractRegistry) *analysisScope {
+	return &analysisScope{
+		registry:            registry,
+		declaresLockMethods: declaresLockMethods(registry),
+		channelOrigins:      make(map[ssa.Value]map[any]bool),
+	}
+}
+
+// newProgramScope returns the scope of a whole-program run over pkgs, all
+// built from one SSA program, against registry.
+func newProgramScope(pkgs []*ssa.Package, registry *ir.ContractRegistry) *analysisScope {
+	scope := newPackageScope(registry)
+	scope.program = pkgs
+	return scope
+}
+
+// packages returns the packages whose functions are visible from pkg: pkg
+// alone, or every package of a whole-program run.
+func (s *analysisScope) packages(pkg *ssa.Package) []*ssa.Package {
+	if pkg == nil {
+		return nil
+	}
+	if s != nil && len(s.program) > 0 && s.program[0].Prog == pkg.Prog {
+		return s.program
+	}
+	return []*ssa.Package{pkg}
+}
@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotsan/ir"
+	"gotsan/parse"
+	"gotsan/utils/report"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Load every package under the cross_package fixture into one SSA program,
+// with contracts registered from all of them.
+func buildCrossPackageFixture(t *testing.T) ([]*ssa.Package, *ir.ContractRegistry, *token.FileSet) {
+	t.Helper()
+	return buildFixturePackages(t, "cross_package", 2)
+}
+
+// Load the want packages under tests/testdata/<dir> into one SSA program,
+// registering each package's contracts with its import path.
+func buildFixturePackages(t *testing.T, dir string, want int) ([]*ssa.Package, *ir.ContractRegistry, *token.FileSet) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	cfg := &packages.Config{Mode: packages.LoadSyntax, Fset: fset, Dir: mustRepoRoot(t)}
+	pattern := "./" + filepath.ToSlash(filepath.Join("tests", "testdata", dir)) + "/..."
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		t.Fatalf("packages.Load failed: %v", err)
+	}
+	if packages.PrintErrors(pkgs) > 0 || len(pkgs) != want {
+		t.Fatalf("failed to load the %s fixture (%d packages)", dir, len(pkgs))
+	}
+
+	registry := ir.NewContractRegistry()
+	for _, pkg := range pkgs {
+		visitor := &parse.Visitor{Fset: fset, Registry: registry, PkgPath: pkg.PkgPath}
+		for _, file := range pkg.Syntax {
+			ast.Walk(visitor, file)
+		}
+	}
+
+	prog, ssaPkgs := ssautil.Packages(pkgs, ssa.BuilderMode(0))
+	prog.Build()
+
+	return ssaPkgs, registry, fset
+}
+
+func countFindingsContaining(reporter *report.Reporter, substr string) int {
+	count := 0
+	for _, d := range reporter.Findings {
+		if strings.Contains(d.Message, substr) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRunProgram_FindsCrossPackageLockOrderInversion(t *testing.T) {
+	ssaPkgs, registry, fset := buildCrossPackageFixture(t)
+
+	perPackage := report.NewReporter()
+	for _, pkg := range ssaPkgs {
+		Run(pkg, registry, perPackage, fset, true)
+	}
+	if got := countFindingsContaining(perPackage, "Potential deadlock between goroutines"); got != 0 {
+		t.Fatalf("per-package runs cannot relate the goroutines, got %d deadlock findings", got)
+	}
+
+	wholeProgram := report.NewReporter()
+	RunProgram(ssaPkgs, registry, wholeProgram, fset, true)
+	if got := countFindingsContaining(wholeProgram, "Potential deadlock between goroutines"); got != 1 {
+		t.Fatalf("expected the cross-package inversion to be reported once, got %d: %v", got, wholeProgram.Findings)
+	}
+
+	// Both goroutine sites are related locations, one in each package.
+	for _, d := range wholeProgram.Findings {
+		if d.Rule != report.RuleLockOrderInversion {
+			continue
+		}
+		if len(d.Related) != 2 || filepath.Base(d.Related[0].File) == filepath.Base(d.Related[1].File) {
+			t.Fatalf("expected the two goroutine sites as related locations, got %+v", d.Related)
+		}
+	}
+}
+
+func TestProgramScopeWidensPackageFunctions(t *testing.T) {
+	ssaPkgs, _, _ := buildCrossPackageFixture(t)
+
+	var api *ssa.Package
+	for _, pkg := range ssaPkgs {
+		if pkg.Pkg.Name() == "api" {
+			api = pkg
+		}
+	}
+	if api == nil {
+		t.Fatal("expected the api package")
+	}
+
+	visible := func(scope *analysisScope) bool {
+		for fn := range collectPackageFunctions(api, scope) {
+			if fn.Name() == "Reindex" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if visible(newPackageScope(nil)) {
+		t.Fatal("store.Reindex must not be visible from api outside a whole-program run")
+	}
+	if !visible(newProgramScope(ssaPkgs, nil)) {
+		t.Fatal("expected store.Reindex to be visible from api in a whole-program run")
+	}
+}
+
+func TestResolveGlobalTargetInImportedPackage(t *testing.T) {
+	ssaPkgs, _, _ := buildCrossPackageFixture(t)
+
+	var lookup *ssa.Function
+	for _, pkg := range ssaPkgs {
+		if fn, ok := pkg.Members["Lookup"].(*ssa.Function); ok {
+			lookup = fn
+		}
+	}
+	if lookup == nil {
+		t.Fatal("expected api.Lookup")
+	}
+
+	key := resolveLockKeyInScope(lookup, "store.IndexMu")
+	if _, ok := key.Root.(*ssa.Global); !ok || key.Name() != "IndexMu" {
+		t.Fatalf("expected store.IndexMu to resolve to the imported global, got %+v", key)
+	}
+}
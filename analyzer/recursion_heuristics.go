@@ -15,7 +15,7 @@ type recursionGraph struct {
 	selfRecursive map[*ssa.Function]bool
 }
 
-func buildRecursionGraph(pkg *ssa.Package) *recursionGraph {
+func buildRecursionGraph(pkg *ssa.Package, scope *analysisScope) *recursionGraph {
 	graph := &recursionGraph{
 		componentByFn: make(map[*ssa.Function]int),
 		componentSize: make(map[int]int),
@@ -26,7 +26,7 @@ func buildRecursionGraph(pkg *ssa.Package) *recursionGraph {
 		return graph
 	}
 
-	functions := collectPackageFunctions(pkg)
+	functions := collectPackageFunctions(pkg, scope)
 	if len(functions) == 0 {
 		return graph
 	}
@@ -52,7 +52,7 @@ func buildRecursionGraph(pkg *ssa.Package) *recursionGraph {
 				if callee := callInstr.Call.StaticCallee(); callee != nil {
 					targets = append(targets, callee)
 				} else {
-					targets = append(targets, resolveDynamicCallTargets(fn, callInstr)...)
+					targets = append(targets, resolveDynamicCallTargets(fn, callInstr, scope)...)
 				}
 
 				for _, target := range targets {
@@ -131,7 +131,10 @@ func buildRecursionGraph(pkg *ssa.Package) *recursionGraph {
 	return graph
 }
 
-func collectPackageFunctions(pkg *ssa.Package) map[*ssa.Function]struct{} {
+// Functions of pkg, including anonymous functions and methods. In a
+// whole-program run this covers every package of the run (see
+// analysisScope).
+func collectPackageFunctions(pkg *ssa.Package, scope *analysisScope) map[*ssa.Function]struct{} {
 	functions := make(map[*ssa.Function]struct{})
 
 	var addFunction func(*ssa.Function)
@@ -150,12 +153,18 @@ func collectPackageFunctions(pkg *ssa.Package) map[*ssa.Function]struct{} {
 		}
 	}
 
-	for _, member := range pkg.Members {
-		switch n := member.(type) {
-		case *ssa.Function:
-			addFunction(n)
-		case *ssa.Type:
-			addMethodsForType(pkg, n.Type(), addFunction)
+	for _, scoped := range scope.packages(pkg) {
+		if scoped == nil {
+			continue
+		}
+
+		for _, member := range scoped.Members {
+			switch n := member.(type) {
+			case *ssa.Function:
+				addFunction(n)
+			case *ssa.Type:
+				addMethodsForType(scoped, n.Type(), addFunction)
+			}
 		}
 	}
 
@@ -218,6 +227,7 @@ func checkRecursiveCallLockReacquireHeuristic(
 	state *AnalysisState,
 	registry *ir.ContractRegistry,
 	recursion *recursionGraph,
+	scope *analysisScope,
 	reporter *report.Reporter,
 	fset *token.FileSet,
 ) {
@@ -239,7 +249,7 @@ func checkRecursiveCallLockReacquireHeuristic(
 		return
 	}
 
-	evidenceByLock := collectTransitiveLockUsageEvidence(calleeFn, map[*ssa.Function]bool{})
+	evidenceByLock := collectTransitiveLockUsageEvidence(calleeFn, map[*ssa.Function]bool{}, scope)
 	if len(evidenceByLock) == 0 {
 		return
 	}
@@ -255,6 +265,7 @@ func checkRecursiveCallLockReacquireHeuristic(
 func collectTransitiveLockUsageEvidence(
 	fn *ssa.Function,
 	active map[*ssa.Function]bool,
+	scope *analysisScope,
 ) map[types.Object]lockUsageEvidence {
 	if fn == nil {
 		return nil
@@ -268,7 +279,7 @@ func collectTransitiveLockUsageEvidence(
 	active[fn] = true
 	defer delete(active, fn)
 
-	evidenceByLock := collectLockUsageEvidence(fn)
+	evidenceByLock := collectLockUsageEvidence(fn, scope)
 	if evidenceByLock == nil {
 		evidenceByLock = make(map[types.Object]lockUsageEvidence)
 	}
@@ -284,11 +295,11 @@ func collectTransitiveLockUsageEvidence(
 			if nestedCallee := callInstr.Call.StaticCallee(); nestedCallee != nil {
 				targets = append(targets, nestedCallee)
 			} else {
-				targets = append(targets, resolveDynamicCallTargets(fn, callInstr)...)
+				targets = append(targets, resolveDynamicCallTargets(fn, callInstr, scope)...)
 			}
 
 			for _, target := range targets {
-				nestedEvidence := collectTransitiveLockUsageEvidence(target, active)
+				nestedEvidence := collectTransitiveLockUsageEvidence(target, active, scope)
 				mergeLockUsageEvidence(evidenceByLock, nestedEvidence)
 			}
 		}
@@ -325,25 +336,25 @@ func matchHeldLockFromEvidence(state *AnalysisState, evidenceByLock map[types.Ob
 		return "", false
 	}
 
-	for heldObj := range state.HeldLocks {
-		if heldObj == nil {
+	for held := range state.HeldLocks {
+		if held.IsZero() {
 			continue
 		}
 
-		ev, seen := evidenceByLock[heldObj]
+		ev, seen := evidenceByLock[held.Obj]
 		if !seen || ev.lockCalls == 0 {
 			continue
 		}
 
-		return heldObj.Name(), true
+		return held.Name(), true
 	}
 
 	heldByName := make(map[string]bool, len(state.HeldLocks))
-	for heldObj := range state.HeldLocks {
-		if heldObj == nil || heldObj.Name() == "" {
+	for held := range state.HeldLocks {
+		if held.IsZero() || held.Name() == "" {
 			continue
 		}
-		heldByName[heldObj.Name()] = true
+		heldByName[held.Name()] = true
 	}
 
 	for lockObj, ev := range evidenceByLock {
@@ -42,7 +42,7 @@ func TestRecursionGraphIsRecursiveEdge(t *testing.T) {
 func TestMatchHeldLockFromEvidenceMatchesByObject(t *testing.T) {
 	lockObj := types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])
 	state := &AnalysisState{
-		HeldLocks:       LockSet{lockObj: true},
+		HeldLocks:       LockSet{{Obj: lockObj}: LockExclusive},
 		MayHeldLocks:    LockSet{},
 		DeferredLocks:   LockSet{},
 		DeferredUnlocks: LockSet{},
@@ -66,7 +66,7 @@ func TestMatchHeldLockFromEvidenceMatchesByNameFallback(t *testing.T) {
 	heldObj := types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])
 	inferredObj := types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])
 	state := &AnalysisState{
-		HeldLocks:       LockSet{heldObj: true},
+		HeldLocks:       LockSet{{Obj: heldObj}: LockExclusive},
 		MayHeldLocks:    LockSet{},
 		DeferredLocks:   LockSet{},
 		DeferredUnlocks: LockSet{},
@@ -93,7 +93,7 @@ func TestCheckRecursiveCallLockReacquireHeuristicSkipsWhenAcquiresContractExists
 
 	lockObj := types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])
 	state := &AnalysisState{
-		HeldLocks:       LockSet{lockObj: true},
+		HeldLocks:       LockSet{{Obj: lockObj}: LockExclusive},
 		MayHeldLocks:    LockSet{},
 		DeferredLocks:   LockSet{},
 		DeferredUnlocks: LockSet{},
@@ -110,7 +110,7 @@ func TestCheckRecursiveCallLockReacquireHeuristicSkipsWhenAcquiresContractExists
 	registry := ir.NewContractRegistry()
 	registry.Functions[callee.Name()] = contract
 
-	checkRecursiveCallLockReacquireHeuristic(caller, callee, callSite, state, registry, recursion, nil, nil)
+	checkRecursiveCallLockReacquireHeuristic(caller, callee, callSite, state, registry, recursion, newPackageScope(registry), nil, nil)
 }
 
 func TestMergeLockUsageEvidence(t *testing.T) {
@@ -135,7 +135,7 @@ func TestCollectTransitiveLockUsageEvidenceHandlesCycles(t *testing.T) {
 	fn := &ssa.Function{}
 	active := map[*ssa.Function]bool{fn: true}
 
-	evidence := collectTransitiveLockUsageEvidence(fn, active)
+	evidence := collectTransitiveLockUsageEvidence(fn, active, newPackageScope(nil))
 	if len(evidence) != 0 {
 		t.Fatalf("expected no evidence when function is already active, got %d", len(evidence))
 	}
@@ -0,0 +1,315 @@
+package analyzer
+
+import (
+	"go/token"
+	"gotsan/ir"
+	"gotsan/utils/report"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Reader-writer-reader (RWR) deadlocks: a goroutine read-locks an RWMutex
+// and, while still holding it, read-locks it again. If another goroutine
+// calls Lock in between, the writer waits for the first read hold and the
+// second RLock waits behind the writer, so neither makes progress.
+
+// recursiveRead is a read acquisition of Lock made while Lock is already
+// read-held on the same path. Pos is where the second acquisition happens,
+// or token.NoPos when it is only known from @acquires contracts.
+type recursiveRead struct {
+	Lock lockKey
+	Pos  token.Pos
+}
+
+type goroutineRWRSite struct {
+	GoInstr *ssa.Go
+	Callee  *ssa.Function
+	Reads   []recursiveReadRef
+	Writes  []lockRef
+	// The go statement sits in a loop, so several instances of the
+	// goroutine may run concurrently with each other.
+	Repeats bool
+}
+
+// recursiveReadRef is a recursiveRead translated into the frame of a go site.
+type recursiveReadRef struct {
+	Lock lockRef
+	Pos  token.Pos
+}
+
+// Call targets whose lock effects are attributed to msg.
+func rwrCallTargets(fn *ssa.Function, msg *ssa.Call, scope *analysisScope) []*ssa.Function {
+	if callee := msg.Call.StaticCallee(); callee != nil {
+		return []*ssa.Function{callee}
+	}
+	return resolveDynamicCallTargets(fn, msg, scope)
+}
+
+func appendRecursiveRead(reads []recursiveRead, read recursiveRead) []recursiveRead {
+	for _, existing := range reads {
+		if existing.Pos == read.Pos && equivalentLockKeys(existing.Lock, read.Lock) {
+			return reads
+		}
+	}
+	return append(reads, read)
+}
+
+// Collect the recursive read acquisitions of fn and its callees, expressed in
+// fn's frame. Read holds are tracked must-hold across the CFG, so a second
+// RLock is only reported when the first is held on every path to it.
+func collectRecursiveReads(fn *ssa.Function, active map[*ssa.Function]bool, scope *analysisScope) []recursiveRead {
+	if fn == nil || len(fn.Blocks) == 0 || active[fn] {
+		return nil
+	}
+	active[fn] = true
+	defer delete(active, fn)
+
+	reads := make([]recursiveRead, 0)
+	entry := fn.Blocks[0]
+	entryStates := map[int]LockSet{entry.Index: make(LockSet)}
+	worklist := newBlockWorklist(entry)
+
+	for !worklist.Empty() {
+		curr := worklist.Pop()
+		readHeld := entryStates[curr.Index].Copy()
+
+		for _, instr := range curr.Instrs {
+			callInstr, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+
+			if isLockCall(callInstr, scope) {
+				key := getLockKey(callInstr)
+				if key.IsZero() || lockModeForCallCommon(&callInstr.Call, scope) != LockShared {
+					continue
+				}
+				if readHeld.ModeOf(key) == LockShared {
+					reads = appendRecursiveRead(reads, recursiveRead{Lock: key, Pos: callInstr.Pos()})
+				}
+				readHeld.Add(key, LockShared)
+				continue
+			}
+
+			if isUnlockCall(callInstr, scope) {
+				if key := getLockKey(callInstr); !key.IsZero() {
+					readHeld.Remove(key)
+				}
+				continue
+			}
+
+			for _, target := range rwrCallTargets(fn, callInstr, scope) {
+				args := invocationArgs(&callInstr.Call)
+				bindings := closureBindings(&callInstr.Call)
+
+				if len(readHeld) > 0 {
+					acquired, _ := collectFunctionLockEffects(target, make(map[*ssa.Function]bool), scope)
+					for key, mode := range translateLockSet(acquired, target, &callInstr.Call) {
+						if mode == LockShared && readHeld.ModeOf(key) == LockShared {
+							reads = appendRecursiveRead(reads, recursiveRead{Lock: key, Pos: callInstr.Pos()})
+						}
+					}
+				}
+
+				for _, nested := range collectRecursiveReads(target, active, scope) {
+					nested.Lock = translateLockKey(nested.Lock, target, args, bindings)
+					reads = appendRecursiveRead(reads, nested)
+				}
+			}
+		}
+
+		for _, succ := range curr.Succs {
+			existing, seen := entryStates[succ.Index]
+			if !seen {
+				entryStates[succ.Index] = readHeld.Copy()
+				worklist.Push(succ)
+				continue
+			}
+
+			merged := existing.Intersect(readHeld)
+			if !existing.Equals(merged) {
+				entryStates[succ.Index] = merged
+				worklist.Push(succ)
+			}
+		}
+	}
+
+	return reads
+}
+
+// Whether block can reach itself, i.e. is part of a loop.
+func blockInLoop(block *ssa.BasicBlock) bool {
+	if block == nil {
+		return false
+	}
+
+	visited := make(map[int]bool)
+	stack := append([]*ssa.BasicBlock(nil), block.Succs...)
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if curr == block {
+			return true
+		}
+		if visited[curr.Index] {
+			continue
+		}
+		visited[curr.Index] = true
+		stack = append(stack, curr.Succs...)
+	}
+
+	return false
+}
+
+func rwrSiteForGo(fn *ssa.Function, goInstr *ssa.Go, registry *ir.ContractRegistry, scope *analysisScope) (goroutineRWRSite, bool) {
+	site := goroutineRWRSite{
+		GoInstr: goInstr,
+		Callee:  goInstr.Call.StaticCallee(),
+		Repeats: blockInLoop(goInstr.Block()),
+	}
+	if site.Callee == nil {
+		site.Callee = resolveFunctionFromValue(goInstr.Call.Value)
+	}
+
+	// Lock calls in the goroutine body and its callees.
+	args := invocationArgs(&goInstr.Call)
+	bindings := closureBindings(&goInstr.Call)
+	for _, target := range resolveGoCallTargets(fn, goInstr, scope) {
+		for _, read := range collectRecursiveReads(target, make(map[*ssa.Function]bool), scope) {
+			key := translateLockKey(read.Lock, target, args, bindings)
+			site.Reads = append(site.Reads, recursiveReadRef{
+				Lock: lockRefForKey(key, key.Name(), LockShared),
+				Pos:  read.Pos,
+			})
+		}
+
+		acquired, _ := collectFunctionLockEffects(target, make(map[*ssa.Function]bool), scope)
+		for key, mode := range translateLockSet(acquired, target, &goInstr.Call) {
+			if mode == LockExclusive && !key.IsZero() {
+				site.Writes = append(site.Writes, lockRefForKey(key, key.Name(), LockExclusive))
+			}
+		}
+	}
+
+	// Contract-level acquisition order: a lock read-acquired twice.
+	order := acquireOrderForGoSite(fn, goInstr, registry, scope)
+	for i := 0; i < len(order); i++ {
+		if !order[i].shared() {
+			site.Writes = append(site.Writes, order[i])
+			continue
+		}
+		for j := i + 1; j < len(order); j++ {
+			if order[j].shared() && sameLock(order[i], order[j]) {
+				site.Reads = append(site.Reads, recursiveReadRef{Lock: order[i]})
+				break
+			}
+		}
+	}
+
+	return site, len(site.Reads) > 0 || len(site.Writes) > 0
+}
+
+func collectGoroutineRWRSites(fn *ssa.Function, registry *ir.ContractRegistry, scope *analysisScope) []goroutineRWRSite {
+	sites := make([]goroutineRWRSite, 0)
+	if fn == nil || registry == nil {
+		return sites
+	}
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			goInstr, ok := instr.(*ssa.Go)
+			if !ok {
+				continue
+			}
+			if site, ok := rwrSiteForGo(fn, goInstr, registry, scope); ok {
+				sites = append(sites, site)
+			}
+		}
+	}
+
+	return sites
+}
+
+// The recursive read in reader that writer's write locks can block. Reads
+// with a known position are preferred, earliest first, so reports are stable.
+func firstBlockedRecursiveRead(reader goroutineRWRSite, writer goroutineRWRSite) (recursiveReadRef, bool) {
+	best := recursiveReadRef{}
+	found := false
+	for _, read := range reader.Reads {
+		if !containsConflictingLock(writer.Writes, read.Lock) {
+			continue
+		}
+		if !found || (read.Pos != token.NoPos && (best.Pos == token.NoPos || read.Pos < best.Pos)) {
+			best = read
+			found = true
+		}
+	}
+	return best, found
+}
+
+func reportRWRDeadlocks(sites []goroutineRWRSite, reporter *report.Reporter, fset *token.FileSet) {
+	for i := range sites {
+		for j := range sites {
+			if i == j && !sites[i].Repeats {
+				continue
+			}
+
+			read, found := firstBlockedRecursiveRead(sites[i], sites[j])
+			if !found {
+				continue
+			}
+
+			reportGoroutineRWRDeadlock(
+				sites[i].GoInstr,
+				sites[j].GoInstr,
+				sites[i].Callee,
+				sites[j].Callee,
+				read.Pos,
+				lockDisplayName(read.Lock),
+				reporter,
+				fset,
+			)
+		}
+	}
+}
+
+// Detect recursive read locking in goroutines launched from fn while another
+// goroutine launched from fn (or another instance of the same go statement)
+// write-locks the same RWMutex.
+func detectGoroutineRWRDeadlocks(
+	fn *ssa.Function,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if fn == nil || len(fn.Blocks) == 0 || registry == nil {
+		return
+	}
+
+	reportRWRDeadlocks(collectGoroutineRWRSites(fn, registry, scope), reporter, fset)
+}
+
+// Package-wide variant of detectGoroutineRWRDeadlocks, pairing go statements
+// in different functions.
+func detectPackageWideGoroutineRWRDeadlocks(
+	pkg *ssa.Package,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if pkg == nil || registry == nil {
+		return
+	}
+
+	sites := make([]goroutineRWRSite, 0)
+	for fn := range collectPackageFunctions(pkg, scope) {
+		if fn == nil || len(fn.Blocks) == 0 {
+			continue
+		}
+		sites = append(sites, collectGoroutineRWRSites(fn, registry, scope)...)
+	}
+
+	reportRWRDeadlocks(sites, reporter, fset)
+}
@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+
+	"gotsan/utils/report"
+)
+
+func TestFirstBlockedRecursiveRead(t *testing.T) {
+	readMu := lockRef{Name: "mu", Mode: LockShared}
+	writeMu := lockRef{Name: "mu", Mode: LockExclusive}
+	writeOther := lockRef{Name: "other", Mode: LockExclusive}
+
+	reader := goroutineRWRSite{Reads: []recursiveReadRef{
+		{Lock: readMu},
+		{Lock: readMu, Pos: token.Pos(20)},
+		{Lock: readMu, Pos: token.Pos(10)},
+	}}
+
+	if _, ok := firstBlockedRecursiveRead(reader, goroutineRWRSite{Writes: []lockRef{writeOther}}); ok {
+		t.Fatal("did not expect a writer on a different lock to block the read")
+	}
+	if _, ok := firstBlockedRecursiveRead(reader, goroutineRWRSite{Writes: []lockRef{readMu}}); ok {
+		t.Fatal("did not expect a reader to block the read")
+	}
+
+	read, ok := firstBlockedRecursiveRead(reader, goroutineRWRSite{Writes: []lockRef{writeMu}})
+	if !ok {
+		t.Fatal("expected the writer to block the recursive read")
+	}
+	if read.Pos != token.Pos(10) {
+		t.Fatalf("expected earliest positioned read, got pos %d", read.Pos)
+	}
+}
+
+// The RWR deadlock findings, by the function whose go statements they pair.
+func rwrFindings(reporter *report.Reporter) map[string][]string {
+	findings := make(map[string][]string)
+	for _, d := range reporter.Findings {
+		if strings.HasPrefix(d.Message, "Potential RWR deadlock") {
+			findings[d.Function] = append(findings[d.Function], d.Message)
+		}
+	}
+	return findings
+}
+
+func TestRun_ReportsRWRDeadlock(t *testing.T) {
+	ssaPkgs, registry, fset := buildFixturePackages(t, "rwr", 1)
+
+	reporter := report.NewReporter()
+	Run(ssaPkgs[0], registry, reporter, fset, true)
+
+	got := rwrFindings(reporter)
+	want := "go Get read-locks mu again while already holding it shared, and go Put write-locks mu in between"
+	if len(got["ReadWhileWriting"]) != 1 || !strings.Contains(got["ReadWhileWriting"][0], want) {
+		t.Fatalf("expected the recursive read in Get to be reported against Put, got %v", got["ReadWhileWriting"])
+	}
+	if msgs := got["ReadOnly"]; len(msgs) != 0 {
+		t.Fatalf("nested read locks without a writer cannot deadlock, got %v", msgs)
+	}
+}
@@ -1,8 +1,33 @@
 package analyzer
 
-import "go/types"
+import (
+	"slices"
 
-type LockSet map[types.Object]bool
+	"golang.org/x/tools/go/ssa"
+)
+
+// LockMode records how a lock is held. Shared holds come from RLock on a
+// sync.RWMutex; every other acquisition is exclusive.
+type LockMode int
+
+const (
+	LockNotHeld LockMode = iota
+	LockShared
+	LockExclusive
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	default:
+		return "not held"
+	}
+}
+
+type LockSet map[lockKey]LockMode
 
 func (ls LockSet) Copy() LockSet {
 	newSet := make(LockSet)
@@ -16,37 +41,142 @@ func (ls LockSet) Equals(other LockSet) bool {
 	if len(ls) != len(other) {
 		return false
 	}
-	for k := range ls {
-		if !other[k] {
+	for k, mode := range ls {
+		if other[k] != mode {
 			return false
 		}
 	}
 	return true
 }
 
+// Intersect keeps the locks held in both sets, in the weaker of the two
+// modes: a lock held exclusively on one path and shared on the other is
+// only known to be held shared.
 func (ls LockSet) Intersect(other LockSet) LockSet {
 	result := make(LockSet)
-	for k := range ls {
-		if other[k] {
-			result[k] = true
+	for k, mode := range ls {
+		if otherMode := other[k]; otherMode != LockNotHeld {
+			result[k] = min(mode, otherMode)
 		}
 	}
 	return result
 }
 
+// Union keeps the locks held in either set, in the stronger of the two modes.
 func (ls LockSet) Union(other LockSet) LockSet {
 	result := ls.Copy()
-	for k := range other {
-		result[k] = true
+	for k, mode := range other {
+		result[k] = max(result[k], mode)
+	}
+	return result
+}
+
+// Add records key as held in mode, keeping an existing stronger hold.
+func (ls LockSet) Add(key lockKey, mode LockMode) {
+	ls[key] = max(ls[key], mode)
+}
+
+// Contains reports whether the set holds a lock equivalent to key (see
+// equivalentLockKeys).
+func (ls LockSet) Contains(key lockKey) bool {
+	return ls.ModeOf(key) != LockNotHeld
+}
+
+// ModeOf returns the strongest mode in which a lock equivalent to key is held.
+func (ls LockSet) ModeOf(key lockKey) LockMode {
+	mode := ls[key]
+	for held, heldMode := range ls {
+		if heldMode > mode && equivalentLockKeys(held, key) {
+			mode = heldMode
+		}
+	}
+	return mode
+}
+
+// Remove deletes key and every held lock equivalent to it.
+func (ls LockSet) Remove(key lockKey) {
+	delete(ls, key)
+	for held := range ls {
+		if equivalentLockKeys(held, key) {
+			delete(ls, held)
+		}
+	}
+}
+
+// lockSource is a block at whose exit a lock was known to be held, with the
+// trace that reached it in explain mode.
+type lockSource struct {
+	Block *ssa.BasicBlock
+	Trace []traceStep
+}
+
+// lockSources maps a lock to the blocks at whose exit it was last known to be
+// held on some path. It lets a may-held lock be traced back to the branch
+// that failed to release it.
+type lockSources map[lockKey][]lockSource
+
+func (src lockSources) Copy() lockSources {
+	newSources := make(lockSources, len(src))
+	for k, sources := range src {
+		newSources[k] = slices.Clone(sources)
+	}
+	return newSources
+}
+
+// Equals compares the source blocks; traces are not part of the fact.
+func (src lockSources) Equals(other lockSources) bool {
+	if len(src) != len(other) {
+		return false
+	}
+	for k, sources := range src {
+		if !slices.EqualFunc(sources, other[k], func(a, b lockSource) bool { return a.Block == b.Block }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Union merges the sources of both sets, ordered by block index.
+func (src lockSources) Union(other lockSources) lockSources {
+	result := src.Copy()
+	for k, sources := range other {
+		for _, source := range sources {
+			if !slices.ContainsFunc(result[k], func(existing lockSource) bool { return existing.Block == source.Block }) {
+				result[k] = append(result[k], source)
+			}
+		}
+		slices.SortFunc(result[k], func(a, b lockSource) int { return a.Block.Index - b.Block.Index })
 	}
 	return result
 }
 
+// Record updates the sources at the exit of block: locks still held there
+// now originate from block, and locks no longer possibly held are dropped.
+func (src lockSources) Record(block *ssa.BasicBlock, held LockSet, mayHeld LockSet, trace []traceStep) {
+	for k := range src {
+		if _, ok := mayHeld[k]; !ok {
+			delete(src, k)
+		}
+	}
+	for k := range held {
+		src[k] = []lockSource{{Block: block, Trace: trace}}
+	}
+}
+
 type AnalysisState struct {
 	HeldLocks       LockSet
 	MayHeldLocks    LockSet
 	DeferredLocks   LockSet
 	DeferredUnlocks LockSet
+	// Locks acquired again while already held: recursive read locks, and
+	// reacquisitions already reported as deadlocks. The next unlock releases
+	// the nested hold and leaves the outer one in place.
+	NestedLocks LockSet
+	// Where each may-held lock was last held; see lockSources.
+	MayHeldSources lockSources
+	// Steps taken to reach this state, recorded in explain mode only. Not
+	// part of the dataflow fact: Equals ignores it.
+	Trace []traceStep
 }
 
 func newAnalysisState(initial LockSet) AnalysisState {
@@ -55,6 +185,8 @@ func newAnalysisState(initial LockSet) AnalysisState {
 		MayHeldLocks:    initial.Copy(),
 		DeferredLocks:   make(LockSet),
 		DeferredUnlocks: make(LockSet),
+		NestedLocks:     make(LockSet),
+		MayHeldSources:  make(lockSources),
 	}
 }
 
@@ -64,6 +196,9 @@ func (s AnalysisState) Copy() AnalysisState {
 		MayHeldLocks:    s.MayHeldLocks.Copy(),
 		DeferredLocks:   s.DeferredLocks.Copy(),
 		DeferredUnlocks: s.DeferredUnlocks.Copy(),
+		NestedLocks:     s.NestedLocks.Copy(),
+		MayHeldSources:  s.MayHeldSources.Copy(),
+		Trace:           slices.Clone(s.Trace),
 	}
 }
 
@@ -71,7 +206,9 @@ func (s AnalysisState) Equals(other AnalysisState) bool {
 	return s.HeldLocks.Equals(other.HeldLocks) &&
 		s.MayHeldLocks.Equals(other.MayHeldLocks) &&
 		s.DeferredLocks.Equals(other.DeferredLocks) &&
-		s.DeferredUnlocks.Equals(other.DeferredUnlocks)
+		s.DeferredUnlocks.Equals(other.DeferredUnlocks) &&
+		s.NestedLocks.Equals(other.NestedLocks) &&
+		s.MayHeldSources.Equals(other.MayHeldSources)
 }
 
 func (s AnalysisState) Intersect(other AnalysisState) AnalysisState {
@@ -80,17 +217,23 @@ func (s AnalysisState) Intersect(other AnalysisState) AnalysisState {
 		MayHeldLocks:    s.MayHeldLocks.Intersect(other.MayHeldLocks),
 		DeferredLocks:   s.DeferredLocks.Intersect(other.DeferredLocks),
 		DeferredUnlocks: s.DeferredUnlocks.Intersect(other.DeferredUnlocks),
+		NestedLocks:     s.NestedLocks.Intersect(other.NestedLocks),
+		MayHeldSources:  s.MayHeldSources.Union(other.MayHeldSources),
+		Trace:           mergeTraces(s, other),
 	}
 }
 
 // MergeForSuccessor combines incoming path states at CFG joins.
 // HeldLocks remains must-hold (intersection), while MayHeldLocks tracks may-hold
-// facts across any predecessor (union).
+// facts across any predecessor (union), together with the blocks they came from.
 func (s AnalysisState) MergeForSuccessor(other AnalysisState) AnalysisState {
 	return AnalysisState{
 		HeldLocks:       s.HeldLocks.Intersect(other.HeldLocks),
 		MayHeldLocks:    s.MayHeldLocks.Union(other.MayHeldLocks),
 		DeferredLocks:   s.DeferredLocks.Intersect(other.DeferredLocks),
 		DeferredUnlocks: s.DeferredUnlocks.Intersect(other.DeferredUnlocks),
+		NestedLocks:     s.NestedLocks.Intersect(other.NestedLocks),
+		MayHeldSources:  s.MayHeldSources.Union(other.MayHeldSources),
+		Trace:           mergeTraces(s, other),
 	}
 }
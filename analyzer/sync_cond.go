@@ -0,0 +1,302 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"gotsan/ir"
+	"gotsan/utils/report"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// sync.Cond: Wait unlocks the Cond's Locker while it waits and locks it
+// again before returning, so the caller must hold the lock, in the mode the
+// Locker takes it in, and still holds it after the call. Any other lock the
+// caller holds stays held while it is parked.
+
+type condOperation int
+
+const (
+	noCondOperation condOperation = iota
+	condWaitOperation
+	// Signal and Broadcast.
+	condSignalOperation
+)
+
+func callCondOperation(common *ssa.CallCommon) condOperation {
+	fn := common.StaticCallee()
+	if fn == nil {
+		return noCondOperation
+	}
+
+	switch fn.String() {
+	case "(*sync.Cond).Wait":
+		return condWaitOperation
+	case "(*sync.Cond).Signal", "(*sync.Cond).Broadcast":
+		return condSignalOperation
+	}
+	return noCondOperation
+}
+
+// Check a call of Wait, Signal or Broadcast on a sync.Cond whose lock can
+// be resolved. The lock state is left as it was: Wait gives the lock back
+// before it returns.
+func checkCondCall(
+	fn *ssa.Function,
+	msg *ssa.Call,
+	op condOperation,
+	state *AnalysisState,
+	registry *ir.ContractRegistry,
+	scope *analysisScope,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+) {
+	if len(msg.Call.Args) == 0 {
+		return
+	}
+	cond := msg.Call.Args[0]
+	lock, mode := condLocker(cond, scope)
+	if lock.IsZero() {
+		return
+	}
+	condName := condDisplayName(cond)
+	held := state.HeldLocks.ModeOf(lock)
+
+	if op == condSignalOperation {
+		// Signalling after the lock was released is fine; never taking it
+		// at all means the state the waiter checks changed without it.
+		if held == LockNotHeld && collectLockUsageEvidence(fn, scope)[lock.Obj] == (lockUsageEvidence{}) {
+			reportCondSignalUnlocked(msg, fn, condName, lock.QualifiedName(), reporter, fset)
+		}
+		return
+	}
+
+	if held != mode {
+		reportCondWaitUnlocked(msg, fn, condName, lock.QualifiedName(), held, mode, reporter, fset)
+	}
+
+	others := make(LockSet)
+	for key, heldMode := range state.HeldLocks {
+		if !key.IsZero() && !equivalentLockKeys(key, lock) {
+			others.Add(key, heldMode)
+		}
+	}
+	for _, name := range lockSetDisplayNames(others) {
+		reportCondWaitHoldingLock(msg, fn, condName, name, reporter, fset)
+	}
+	// Wait locks the lock again while the others are held.
+	checkDeclaredLockOrder(fn, msg.Pos(), nil, others, lock, registry, reporter, fset)
+
+	if !blockInLoop(msg.Block()) {
+		reportCondWaitOutsideLoop(msg, fn, condName, reporter, fset)
+	}
+}
+
+// Check a call made while holding locks: a callee that waits on a sync.Cond
+// keeps the caller's locks held while it waits, except the Cond's own lock,
+// which Wait releases.
+func checkCalleeCondWaits(
+	fn *ssa.Function,
+	msg *ssa.Call,
+	callee *ssa.Function,
+	state *AnalysisState,
+	reporter *report.Reporter,
+	fset *token.FileSet,
+	scope *analysisScope,
+) {
+	if len(state.HeldLocks) == 0 {
+		return
+	}
+
+	waited := collectCondWaitLocks(callee, make(map[*ssa.Function]bool), scope)
+	if len(waited) == 0 {
+		return
+	}
+	waited = translateLockSet(waited, callee, &msg.Call)
+
+	others := make(LockSet)
+	for key, mode := range state.HeldLocks {
+		if !key.IsZero() && !waited.Contains(key) {
+			others.Add(key, mode)
+		}
+	}
+	for _, name := range lockSetDisplayNames(others) {
+		reportCalleeCondWaitHoldingLock(msg, fn, callee, name, reporter, fset)
+	}
+}
+
+// The locks of the sync.Conds fn and its transitive callees wait on,
+// expressed in fn's frame.
+func collectCondWaitLocks(fn *ssa.Function, seen map[*ssa.Function]bool, scope *analysisScope) LockSet {
+	locks := make(LockSet)
+	if fn == nil || seen[fn] {
+		return locks
+	}
+	seen[fn] = true
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			call, ok := instr.(*ssa.Call)
+			if !ok {
+				continue
+			}
+
+			switch callCondOperation(&call.Call) {
+			case condWaitOperation:
+				if lock, mode := condLocker(call.Call.Args[0], scope); !lock.IsZero() {
+					locks.Add(lock, mode)
+				}
+				continue
+			case condSignalOperation:
+				continue
+			}
+
+			if callee := call.Call.StaticCallee(); callee != nil && callee.Pkg != nil && callee.Pkg.Pkg.Path() != "sync" {
+				mergeLockSet(locks, translateLockSet(collectCondWaitLocks(callee, seen, scope), callee, &call.Call))
+			}
+		}
+	}
+	return locks
+}
+
+// The lock the Locker of a *sync.Cond locks, in cond's frame, and the mode
+// it locks it in. The Cond is one made where it is used, or one stored in a
+// package variable or struct field; the zero key when it can't be found.
+func condLocker(cond ssa.Value, scope *analysisScope) (lockKey, LockMode) {
+	if locker := condLockerValue(cond); locker != nil {
+		return lockerLock(locker)
+	}
+
+	load, ok := cond.(*ssa.UnOp)
+	if !ok || load.Op != token.MUL || load.Parent() == nil || load.Parent().Pkg == nil {
+		return lockKey{}, LockExclusive
+	}
+
+	for fn := range collectPackageFunctions(load.Parent().Pkg, scope) {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				store, ok := instr.(*ssa.Store)
+				if !ok || !sameStoreAddress(store.Addr, load.X) {
+					continue
+				}
+				locker := condLockerValue(store.Val)
+				if locker == nil {
+					continue
+				}
+
+				lock, mode := lockerLock(locker)
+				if storeField, ok := store.Addr.(*ssa.FieldAddr); ok {
+					lock = rebaseLockKey(lock, storeField.X, load.X.(*ssa.FieldAddr).X)
+				}
+				if !lock.IsZero() {
+					return lock, mode
+				}
+			}
+		}
+	}
+	return lockKey{}, LockExclusive
+}
+
+// Whether a store to addr stores to the variable or struct field at target.
+func sameStoreAddress(addr ssa.Value, target ssa.Value) bool {
+	switch target := target.(type) {
+	case *ssa.Global:
+		return addr == target
+	case *ssa.FieldAddr:
+		field, ok := addr.(*ssa.FieldAddr)
+		return ok && field.Field == target.Field && types.Identical(field.X.Type(), target.X.Type())
+	}
+	return false
+}
+
+// The Locker a *sync.Cond was made with: the argument of sync.NewCond, or
+// the L of a &sync.Cond{L: ...} literal.
+func condLockerValue(v ssa.Value) ssa.Value {
+	switch v := v.(type) {
+	case *ssa.Call:
+		if callee := v.Call.StaticCallee(); callee != nil && callee.String() == "sync.NewCond" && len(v.Call.Args) == 1 {
+			return v.Call.Args[0]
+		}
+	case *ssa.Alloc:
+		for _, ref := range *v.Referrers() {
+			field, ok := ref.(*ssa.FieldAddr)
+			if !ok || field.X != v || selectedFieldName(field) != "L" {
+				continue
+			}
+			for _, fieldRef := range *field.Referrers() {
+				if store, ok := fieldRef.(*ssa.Store); ok && store.Addr == field {
+					return store.Val
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func selectedFieldName(field *ssa.FieldAddr) string {
+	strct, ok := getUnderlyingStruct(field.X.Type())
+	if !ok || strct == nil || field.Field >= strct.NumFields() {
+		return ""
+	}
+	return strct.Field(field.Field).Name()
+}
+
+// The lock a Locker value locks, and the mode: RLocker() of a
+// sync.RWMutex read-locks it.
+func lockerLock(locker ssa.Value) (lockKey, LockMode) {
+	locker = stripInterfaceConversions(locker)
+	if call, ok := locker.(*ssa.Call); ok {
+		if callee := call.Call.StaticCallee(); callee != nil && callee.String() == "(*sync.RWMutex).RLocker" && len(call.Call.Args) == 1 {
+			return lockKeyForValue(call.Call.Args[0]), LockShared
+		}
+	}
+	return lockKeyForValue(locker), LockExclusive
+}
+
+// Express lock, reached from the struct a Cond was stored in (from), as the
+// same field of the struct the Cond is loaded from (to). Locks that aren't
+// fields of that struct keep their identity if global, and degrade to their
+// field-only identity otherwise.
+func rebaseLockKey(lock lockKey, from ssa.Value, to ssa.Value) lockKey {
+	if lock.IsZero() || lock.Root == nil {
+		return lock
+	}
+	if _, ok := lock.Root.(*ssa.Global); ok {
+		return lock
+	}
+
+	root, path := accessPathForValue(from)
+	if root == nil || root != lock.Root {
+		return lock.fieldOnly()
+	}
+
+	var fields []string
+	switch {
+	case lock.Path == path:
+		// The struct is the lock.
+	case path == "":
+		fields = strings.Split(lock.Path, ".")
+	case strings.HasPrefix(lock.Path, path+"."):
+		fields = strings.Split(strings.TrimPrefix(lock.Path, path+"."), ".")
+	default:
+		return lock.fieldOnly()
+	}
+	if rebased := lockKeyForField(to, fields); !rebased.IsZero() {
+		return rebased
+	}
+	return lock.fieldOnly()
+}
+
+// A source-level name for the Cond a method is called on.
+func condDisplayName(cond ssa.Value) string {
+	if root, path := accessPathForValue(cond); root != nil {
+		if name := rootDisplayName(root); name != "" {
+			return joinLockPath(name, path)
+		}
+	}
+	if obj := resolveValueToObject(cond); obj != nil {
+		return obj.Name()
+	}
+	return "a sync.Cond"
+}
@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"gotsan/utils/report"
+)
+
+// The advisories of rule, by the function they were reported in.
+func condAdvisories(reporter *report.Reporter, rule string) map[string]string {
+	advisories := make(map[string]string)
+	for _, d := range reporter.Warnings {
+		if d.Rule == rule {
+			advisories[d.Functions[0]] = d.Message
+		}
+	}
+	return advisories
+}
+
+func runSyncCondFixture(t *testing.T) *report.Reporter {
+	t.Helper()
+	ssaPkgs, registry, fset := buildFixturePackages(t, "sync_cond", 1)
+
+	reporter := report.NewReporter()
+	Run(ssaPkgs[0], registry, reporter, fset, true)
+	return reporter
+}
+
+func TestRun_ReportsCondWaitOutsideLoop(t *testing.T) {
+	reporter := runSyncCondFixture(t)
+
+	got := condAdvisories(reporter, report.RuleCondWaitOutsideLoop)
+	if !strings.Contains(got["PopOnce"], "function PopOnce waits on q.cond outside a loop") {
+		t.Errorf("expected the Wait in PopOnce to be reported, got %q", got["PopOnce"])
+	}
+	if len(got) != 1 {
+		t.Errorf("only PopOnce waits outside a loop, got %v", got)
+	}
+}
+
+func TestRun_ReportsCondSignalUnlocked(t *testing.T) {
+	reporter := runSyncCondFixture(t)
+
+	got := condAdvisories(reporter, report.RuleCondSignalUnlocked)
+	want := map[string]string{
+		"Notify": "function Notify calls q.cond.Signal without ever taking its lock q.mu",
+		"Start":  "function Start calls ready.Broadcast without ever taking its lock readyMu",
+	}
+	for fn, message := range want {
+		if !strings.Contains(got[fn], message) {
+			t.Errorf("expected %q, got %q", message, got[fn])
+		}
+	}
+	// Push signals after releasing q.mu and PushLocked while holding it.
+	if len(got) != len(want) {
+		t.Errorf("expected %d advisories, got %v", len(want), got)
+	}
+
+	for _, d := range reporter.Findings {
+		if strings.HasPrefix(d.Rule, "cond-") {
+			t.Errorf("the fixture waits correctly, got %s", d.Message)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"go/token"
+	"gotsan/ir"
+	"gotsan/utils/report"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Witness traces (explain mode). When the reporter asks for explanations,
+// each path state carries the lock-relevant steps taken to reach it: branch
+// decisions, lock and unlock calls, and calls to annotated functions.
+// Findings raised while analyzing an instruction get the trace of the state
+// that violated them as related positions.
+
+type traceStep struct {
+	Pos     token.Pos
+	Message string
+}
+
+func explainEnabled(reporter *report.Reporter) bool {
+	return reporter != nil && reporter.Explain
+}
+
+func (s *AnalysisState) addStep(pos token.Pos, message string) {
+	if pos == token.NoPos {
+		return
+	}
+	s.Trace = append(slices.Clip(s.Trace), traceStep{Pos: pos, Message: message})
+}
+
+// Pick the trace to keep when two path states meet. The join is must-hold, so
+// if other lost a lock s still holds, other's path is the one that explains
+// why the lock is not held past the join.
+func mergeTraces(s AnalysisState, other AnalysisState) []traceStep {
+	for key := range s.HeldLocks {
+		if !other.HeldLocks.Contains(key) {
+			return other.Trace
+		}
+	}
+	return s.Trace
+}
+
+// Record the initial lockset as the first step of the trace.
+func recordEntryStep(fn *ssa.Function, state *AnalysisState) {
+	if len(state.HeldLocks) == 0 {
+		return
+	}
+	state.addStep(fn.Pos(), "enters "+fn.Name()+" holding "+strings.Join(lockSetDisplayNames(state.HeldLocks), ", ")+" (@requires)")
+}
+
+// Record the branch taken from block to its succIndex-th successor.
+func recordBranchStep(block *ssa.BasicBlock, succIndex int, state *AnalysisState) {
+	if len(block.Succs) < 2 || len(block.Instrs) == 0 {
+		return
+	}
+
+	if _, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If); !ok {
+		return
+	}
+
+	// The condition, or failing that the code the branch leads into.
+	pos := blockDiagnosticPos(block)
+	if pos == token.NoPos {
+		for _, instr := range block.Succs[succIndex].Instrs {
+			if pos = instr.Pos(); pos != token.NoPos {
+				break
+			}
+		}
+	}
+
+	if succIndex == 0 {
+		state.addStep(pos, "takes the true branch")
+	} else {
+		state.addStep(pos, "takes the false branch")
+	}
+}
+
+// Record instr as a step if it changes or depends on the lock state.
+func recordInstructionStep(instr ssa.Instruction, state *AnalysisState, registry *ir.ContractRegistry, scope *analysisScope) {
+	switch msg := instr.(type) {
+	case *ssa.Call:
+		switch {
+		case isLockCall(msg, scope):
+			if key := getLockKey(msg); !key.IsZero() {
+				if lockModeForCallCommon(&msg.Call, scope) == LockShared {
+					state.addStep(msg.Pos(), "read-acquires "+key.QualifiedName())
+				} else {
+					state.addStep(msg.Pos(), "acquires "+key.QualifiedName())
+				}
+			}
+		case isUnlockCall(msg, scope):
+			if key := getLockKey(msg); !key.IsZero() {
+				state.addStep(msg.Pos(), "releases "+key.QualifiedName())
+			}
+		default:
+			if callee := msg.Call.StaticCallee(); callee != nil && contractForFunction(callee, registry) != nil {
+				state.addStep(msg.Pos(), "calls "+callee.Name())
+			}
+		}
+	case *ssa.Defer:
+		if _, unlocks := collectDeferredCallLockEffects(&msg.Call, scope); len(unlocks) > 0 {
+			state.addStep(msg.Pos(), "defers release of "+strings.Join(lockSetDisplayNames(unlocks), ", "))
+		}
+	}
+}
+
+// Attach trace to the findings reported since the reporter had `before`
+// findings, unless they already carry one.
+func attachTrace(trace []traceStep, before int, reporter *report.Reporter, fset *token.FileSet) {
+	if fset == nil || len(trace) == 0 {
+		return
+	}
+
+	for i := before; i < len(reporter.Findings); i++ {
+		if len(reporter.Findings[i].Related) > 0 {
+			continue
+		}
+
+		related := make([]report.RelatedPosition, 0, len(trace))
+		for _, step := range trace {
+			rel := relatedPosition(fset, step.Pos, step.Message)
+			rel.Trace = true
+			related = append(related, rel)
+		}
+		reporter.Findings[i].Related = related
+	}
+}
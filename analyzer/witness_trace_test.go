@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestMergeTracesPrefersPathThatDroppedLock(t *testing.T) {
+	mu := lockKey{Obj: types.NewVar(token.NoPos, nil, "mu", types.Typ[types.Int])}
+
+	held := newAnalysisState(LockSet{mu: LockExclusive})
+	held.addStep(token.Pos(10), "acquires mu")
+
+	released := newAnalysisState(LockSet{})
+	released.addStep(token.Pos(10), "acquires mu")
+	released.addStep(token.Pos(20), "releases mu")
+
+	merged := held.MergeForSuccessor(released)
+	if len(merged.Trace) != 2 || merged.Trace[1].Message != "releases mu" {
+		t.Fatalf("expected the releasing path's trace, got %v", merged.Trace)
+	}
+
+	merged = released.MergeForSuccessor(held)
+	if len(merged.Trace) != 2 || merged.Trace[1].Message != "releases mu" {
+		t.Fatalf("expected existing trace to be kept, got %v", merged.Trace)
+	}
+}
+
+func TestAnalysisStateEqualsIgnoresTrace(t *testing.T) {
+	a := newAnalysisState(LockSet{})
+	b := a.Copy()
+	b.addStep(token.Pos(5), "takes the true branch")
+
+	if !a.Equals(b) {
+		t.Fatal("trace must not affect state equality, or the worklist would not converge")
+	}
+}
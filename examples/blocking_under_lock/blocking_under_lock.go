@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type Pipeline struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	processed int
+
+	results chan int
+	done    chan struct{}
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{
+		results: make(chan int),
+		done:    make(chan struct{}),
+	}
+}
+
+// Reported: the consumer locks p.mu before it receives from p.results, so
+// it never gets to the receive this send waits for.
+func (p *Pipeline) Produce(v int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.processed++
+	p.results <- v
+}
+
+// Not reported: p.mu is released before the send.
+func (p *Pipeline) ProduceUnlocked(v int) {
+	p.mu.Lock()
+	p.processed++
+	p.mu.Unlock()
+	p.results <- v
+}
+
+func (p *Pipeline) consume() {
+	for {
+		p.mu.Lock()
+		p.processed--
+		p.mu.Unlock()
+		select {
+		case v := <-p.results:
+			_ = v
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Pipeline) Start() {
+	go p.consume()
+}
+
+// Advisory: every goroutine that needs p.mu waits out the sleep.
+func (p *Pipeline) Throttle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	p.processed = 0
+}
+
+// Advisory: p.done has no sender that needs p.mu, but the lock is held for
+// as long as the receive waits.
+func (p *Pipeline) AwaitDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	<-p.done
+}
+
+var (
+	statsMu sync.Mutex
+	// @guarded_by(statsMu)
+	total int
+)
+
+// Reported: the goroutine needs statsMu before it can send the count this
+// receive waits for.
+func collect() int {
+	counts := make(chan int)
+	go func() {
+		statsMu.Lock()
+		n := total
+		statsMu.Unlock()
+		counts <- n
+	}()
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	return <-counts
+}
+
+// Advisory: the workers don't need statsMu, but Wait keeps it held until
+// they finish.
+func collectAll(workers int) {
+	var wg sync.WaitGroup
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+		}()
+	}
+	wg.Wait()
+	total += workers
+}
+
+func main() {
+	p := NewPipeline()
+	p.Start()
+	p.Produce(1)
+	p.ProduceUnlocked(2)
+	p.Throttle()
+	close(p.done)
+	p.AwaitDone()
+
+	_ = collect()
+	collectAll(4)
+}
@@ -0,0 +1,86 @@
+package main
+
+import "sync"
+
+type Registry struct {
+	// @acquired_before(Shard.mu)
+	mu sync.Mutex
+	// @guarded_by(mu)
+	size int
+}
+
+type Shard struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	count int
+}
+
+// @acquired_after(Shard.mu)
+var statsMu sync.Mutex
+
+// @guarded_by(statsMu)
+var total int
+
+// Contradicts the order of configMu declared below.
+//
+// @acquired_before(configMu)
+var logMu sync.Mutex
+
+// @acquired_before(logMu)
+var configMu sync.Mutex
+
+// Not reported: the registry lock is taken before the shard lock.
+//
+// @acquires(r.mu, s.mu)
+func (r *Registry) Add(s *Shard) {
+	r.mu.Lock()
+	s.mu.Lock()
+	s.count++
+	r.size++
+	s.mu.Unlock()
+	r.mu.Unlock()
+}
+
+// Reported: Shard.mu is declared to be acquired before statsMu.
+//
+// @acquires(statsMu, s.mu)
+func (s *Shard) Flush() {
+	statsMu.Lock()
+	s.mu.Lock()
+	total += s.count
+	s.count = 0
+	s.mu.Unlock()
+	statsMu.Unlock()
+}
+
+// @acquires(r.mu)
+func (r *Registry) Size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Reported: Size acquires Registry.mu while the shard lock is held.
+//
+// @acquires(s.mu)
+func (r *Registry) Remove(s *Shard) {
+	s.mu.Lock()
+	if r.Size() > 0 {
+		s.count = 0
+	}
+	s.mu.Unlock()
+}
+
+// @acquires(logMu, configMu)
+func main() {
+	r := &Registry{}
+	s := &Shard{}
+	r.Add(s)
+	s.Flush()
+	r.Remove(s)
+	// Reported: configMu is declared to be acquired before logMu.
+	logMu.Lock()
+	configMu.Lock()
+	configMu.Unlock()
+	logMu.Unlock()
+}
@@ -0,0 +1,85 @@
+package main
+
+import "sync"
+
+type Store struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	pending int
+}
+
+// Takes s.mu itself, so callers must not hold it.
+//
+// @excludes(s.mu)
+func (s *Store) Flush() {
+	s.mu.Lock()
+	s.pending = 0
+	s.mu.Unlock()
+}
+
+// Calls fn with s.mu held.
+//
+// @acquires(s.mu)
+func (s *Store) WithLock(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// Reported: s.mu is held.
+//
+// @acquires(s.mu)
+func (s *Store) AddAndFlush() {
+	s.mu.Lock()
+	s.pending++
+	s.Flush()
+	s.mu.Unlock()
+}
+
+// Not reported: s.mu is released first.
+//
+// @acquires(s.mu)
+func (s *Store) AddThenFlush() {
+	s.mu.Lock()
+	s.pending++
+	s.mu.Unlock()
+	s.Flush()
+}
+
+// Reported: @excludes(s.mu) says s.mu is not held on entry.
+//
+// @requires(s.mu)
+// @excludes(s.mu)
+func (s *Store) Contradiction() {
+	s.pending = 0
+}
+
+var registryMu sync.Mutex
+
+// @guarded_by(registryMu)
+var registered int
+
+// @excludes(registryMu)
+func register() {
+	registryMu.Lock()
+	registered++
+	registryMu.Unlock()
+}
+
+// @acquires(registryMu)
+func underRegistry(cb func()) {
+	registryMu.Lock()
+	cb()
+	registryMu.Unlock()
+}
+
+func main() {
+	s := &Store{}
+	s.AddAndFlush()
+	s.AddThenFlush()
+
+	// Reported at the callback invocations: both run with the excluded
+	// lock held.
+	s.WithLock(s.Flush)
+	underRegistry(register)
+}
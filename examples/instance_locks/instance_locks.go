@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+type Account struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	balance int
+}
+
+// Locking both accounts is not a reacquire: from.mu and to.mu are
+// different instances of the same field.
+//
+// @acquires(from.mu)
+// @acquires(to.mu)
+func transfer(from *Account, to *Account, amount int) {
+	from.mu.Lock()
+	to.mu.Lock()
+	from.balance -= amount
+	to.balance += amount
+	to.mu.Unlock()
+	from.mu.Unlock()
+}
+
+// Holding from.mu does not protect to.balance.
+//
+// @acquires(from.mu)
+func depositUnsafe(from *Account, to *Account, amount int) {
+	from.mu.Lock()
+	from.balance -= amount
+	to.balance += amount
+	from.mu.Unlock()
+}
+
+func main() {
+	a := &Account{}
+	b := &Account{}
+	c := &Account{}
+	d := &Account{}
+
+	// Opposite argument order on the same pair of accounts can deadlock.
+	go transfer(a, b, 10)
+	go transfer(b, a, 10)
+
+	// Disjoint accounts never contend.
+	go transfer(c, d, 10)
+
+	depositUnsafe(c, d, 5)
+
+	select {}
+}
@@ -0,0 +1,104 @@
+package main
+
+import "sync"
+
+type Server struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	published int
+
+	statsMu sync.Mutex
+	// @guarded_by(statsMu)
+	logged int
+
+	events chan string
+}
+
+func NewServer() *Server {
+	return &Server{events: make(chan string)}
+}
+
+// Reported: Publish holds s.mu while it waits for logEvents to receive,
+// logEvents takes s.statsMu before it receives, and Record holds s.statsMu
+// while it waits for s.mu.
+func (s *Server) Publish(e string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published++
+	s.events <- e
+}
+
+func (s *Server) logEvents() {
+	for {
+		s.statsMu.Lock()
+		s.logged++
+		s.statsMu.Unlock()
+		<-s.events
+	}
+}
+
+func (s *Server) Record() {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.mu.Lock()
+	s.logged = s.published
+	s.mu.Unlock()
+}
+
+type Cache struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	entries map[string]string
+
+	indexMu sync.Mutex
+	// @guarded_by(indexMu)
+	keys []string
+
+	updates chan string
+}
+
+func NewCache() *Cache {
+	return &Cache{updates: make(chan string)}
+}
+
+// Not reported: Reindex releases c.indexMu before it takes c.mu, so
+// nothing waits for c.mu while holding the lock indexUpdates needs.
+func (c *Cache) Put(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]string)
+	}
+	c.entries[key] = value
+	c.updates <- key
+}
+
+func (c *Cache) indexUpdates() {
+	for key := range c.updates {
+		c.indexMu.Lock()
+		c.keys = append(c.keys, key)
+		c.indexMu.Unlock()
+	}
+}
+
+func (c *Cache) Reindex() {
+	c.indexMu.Lock()
+	n := len(c.keys)
+	c.indexMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = n + len(c.entries)
+}
+
+func main() {
+	s := NewServer()
+	go s.logEvents()
+	go s.Record()
+	s.Publish("started")
+
+	c := NewCache()
+	go c.indexUpdates()
+	go c.Reindex()
+	c.Put("a", "1")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+type Queue struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	size int
+}
+
+// The unlock is skipped when the queue is empty.
+//
+// @acquires(q.mu)
+func (q *Queue) Drop() {
+	q.mu.Lock()
+	if q.size > 0 {
+		q.size--
+		q.mu.Unlock()
+	}
+}
+
+// The error branch jumps past the unlock.
+//
+// @acquires(q.mu)
+func (q *Queue) Push(v int) (err error) {
+	q.mu.Lock()
+	if v < 0 {
+		err = errors.New("negative item")
+		goto done
+	}
+	q.size++
+	q.mu.Unlock()
+done:
+	return err
+}
+
+// Every path releases the lock.
+//
+// @acquires(q.mu)
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	n := q.size
+	if n == 0 {
+		q.mu.Unlock()
+		return 0
+	}
+	q.mu.Unlock()
+	return n
+}
+
+func main() {
+	q := new(Queue)
+	q.Drop()
+	q.Push(1)
+	q.Len()
+}
@@ -0,0 +1,41 @@
+package main
+
+import "sync"
+
+var (
+	muA sync.Mutex
+	muB sync.Mutex
+	muC sync.Mutex
+)
+
+// @acquires(muA, muB)
+func lockAB() {
+	muA.Lock()
+	muB.Lock()
+	muB.Unlock()
+	muA.Unlock()
+}
+
+// @acquires(muB, muC)
+func lockBC() {
+	muB.Lock()
+	muC.Lock()
+	muC.Unlock()
+	muB.Unlock()
+}
+
+// @acquires(muC, muA)
+func lockCA() {
+	muC.Lock()
+	muA.Lock()
+	muA.Unlock()
+	muC.Unlock()
+}
+
+// No pair of goroutines inverts an order, but the three together can each
+// hold one lock while waiting for the next.
+func main() {
+	go lockAB()
+	go lockBC()
+	go lockCA()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A mutex that records how long callers wait for it.
+//
+// @lock_type
+type InstrumentedMutex struct {
+	mu    sync.Mutex
+	waits time.Duration
+}
+
+func (m *InstrumentedMutex) Lock() {
+	start := time.Now()
+	m.mu.Lock()
+	m.waits += time.Since(start)
+}
+
+func (m *InstrumentedMutex) Unlock() {
+	m.mu.Unlock()
+}
+
+// Serializes work per key; the whole table counts as one lock.
+type KeyedMutex struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+// @lock_method
+func (k *KeyedMutex) Acquire(key string) {
+	k.mu.Lock()
+	k.locked[key] = true
+	k.mu.Unlock()
+}
+
+// @unlock_method
+func (k *KeyedMutex) Release(key string) {
+	k.mu.Lock()
+	delete(k.locked, key)
+	k.mu.Unlock()
+}
+
+type Store struct {
+	mu InstrumentedMutex
+	// @guarded_by(mu)
+	items map[string]int
+
+	keys KeyedMutex
+	// @guarded_by(keys)
+	pending int
+}
+
+// Not reported: the instrumented mutex is held.
+func (s *Store) Put(key string, value int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = value
+}
+
+// Reported: items is read without s.mu.
+func (s *Store) Len() int {
+	return len(s.items)
+}
+
+// Reported: s.mu is acquired twice.
+func (s *Store) PutTwice(key string, value int) {
+	s.mu.Lock()
+	s.items[key] = value
+	s.mu.Lock()
+	s.mu.Unlock()
+	s.mu.Unlock()
+}
+
+// Not reported: the keyed mutex guards pending.
+func (s *Store) Enqueue(key string) {
+	s.keys.Acquire(key)
+	s.pending++
+	s.keys.Release(key)
+}
+
+// Reported: pending is written without the keyed mutex held.
+func (s *Store) Dequeue(key string) {
+	s.pending--
+	s.keys.Release(key)
+}
+
+// Reported: the lock taken through l leaks when ok is false.
+func update(l sync.Locker, ok bool) {
+	l.Lock()
+	if ok {
+		l.Unlock()
+	}
+}
+
+// Reported: unlocking through the interface releases s.mu, which is then
+// not held when items is written.
+func (s *Store) Reset() {
+	var l sync.Locker = &s.mu
+	l.Lock()
+	l.Unlock()
+	s.items = nil
+}
+
+func main() {
+	s := &Store{}
+	s.Put("a", 1)
+	s.PutTwice("b", 2)
+	s.Enqueue("a")
+	s.Dequeue("a")
+	update(&s.mu, true)
+	s.Reset()
+	_ = s.Len()
+}
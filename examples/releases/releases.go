@@ -0,0 +1,86 @@
+package main
+
+import "sync"
+
+type Conn struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	state int
+}
+
+func notify() {}
+
+// Hands c.mu back to whoever waits for it.
+//
+// @releases(c.mu)
+func (c *Conn) unlockAndNotify() {
+	c.mu.Unlock()
+	notify()
+}
+
+// Releases c.mu through a helper.
+//
+// @releases(c.mu)
+func (c *Conn) finish() {
+	c.state++
+	c.unlockAndNotify()
+}
+
+// Reported: c.mu is still held when ok is false.
+//
+// @releases(c.mu)
+func (c *Conn) finishIf(ok bool) {
+	if ok {
+		c.mu.Unlock()
+	}
+}
+
+// Releases c.mu without saying so: a required lock it unlocks is taken
+// to be released.
+//
+// @requires(c.mu)
+func (c *Conn) finishLegacy() {
+	c.state++
+	c.mu.Unlock()
+}
+
+// Not reported: finishLegacy releases c.mu.
+//
+// @acquires(c.mu)
+func (c *Conn) UpdateLegacy() {
+	c.mu.Lock()
+	c.finishLegacy()
+}
+
+// Not reported: finish releases c.mu, so nothing leaks.
+//
+// @acquires(c.mu)
+func (c *Conn) Update() {
+	c.mu.Lock()
+	c.state++
+	c.finish()
+}
+
+// Reported: c.mu is not held when finish is called.
+func (c *Conn) UpdateUnlocked() {
+	c.finish()
+}
+
+// Reported: c.mu is no longer held after finish.
+//
+// @acquires(c.mu)
+func (c *Conn) UpdateTwice() {
+	c.mu.Lock()
+	c.finish()
+	c.state++
+}
+
+func main() {
+	c := &Conn{}
+	c.Update()
+	c.UpdateUnlocked()
+	c.UpdateTwice()
+	c.UpdateLegacy()
+	c.mu.Lock()
+	c.finishIf(true)
+}
@@ -0,0 +1,88 @@
+package main
+
+import "sync"
+
+type Cache struct {
+	mu sync.RWMutex
+	// @guarded_by(mu)
+	hits int
+	// @guarded_by(mu)
+	entries map[string]string
+}
+
+// Reads are fine under a shared hold.
+//
+// @acquires(c.mu)
+func (c *Cache) Get(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.entries[key]
+}
+
+// Writing a guarded field needs the write lock.
+//
+// @acquires(c.mu)
+func (c *Cache) RecordHitUnsafe() {
+	c.mu.RLock()
+	c.hits++
+	c.mu.RUnlock()
+}
+
+// Recursive read locking is not a reacquire.
+//
+// @acquires(c.mu)
+func (c *Cache) Snapshot(key string) (string, int) {
+	c.mu.RLock()
+	value := c.entries[key]
+	c.mu.RLock()
+	hits := c.hits
+	c.mu.RUnlock()
+	c.mu.RUnlock()
+	return value, hits
+}
+
+// Upgrading a read lock to a write lock blocks forever.
+//
+// @acquires(c.mu)
+func (c *Cache) PutIfMissing(key string, value string) {
+	c.mu.RLock()
+	if _, ok := c.entries[key]; !ok {
+		c.mu.Lock()
+		c.entries[key] = value
+		c.mu.Unlock()
+	}
+	c.mu.RUnlock()
+}
+
+// @requires_shared(c.mu)
+func (c *Cache) size() int {
+	return c.hits
+}
+
+// @requires_shared(c.mu)
+func (c *Cache) resetHits() {
+	c.hits = 0
+}
+
+// @requires(c.mu)
+func (c *Cache) clear() {
+	c.entries = make(map[string]string)
+}
+
+// @acquires(c.mu)
+func (c *Cache) Stats() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n := c.size()
+	c.clear()
+	return n
+}
+
+func main() {
+	c := new(Cache)
+	c.Get("a")
+	c.RecordHitUnsafe()
+	c.Snapshot("a")
+	c.PutIfMissing("a", "b")
+	c.Stats()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Registry struct {
+	mu sync.RWMutex
+	// @guarded_by(mu)
+	names map[string]int
+}
+
+// @acquires(r.mu)
+func (r *Registry) Lookup(name string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id, ok := r.names[name]; ok {
+		return id
+	}
+	return r.Count()
+}
+
+// @acquires(r.mu)
+func (r *Registry) Count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.names)
+}
+
+// @acquires(r.mu)
+func (r *Registry) Register(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[name] = len(r.names)
+}
+
+// Count read-locks r.mu again.
+//
+// @acquires(r.mu)
+func (r *Registry) Describe() {
+	r.mu.RLock()
+	fmt.Printf("registry: %d names\n", r.Count())
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	r.names["described"] = len(r.names)
+	r.mu.Unlock()
+}
+
+func main() {
+	r := &Registry{}
+
+	// Lookup read-locks r.mu twice; Register can queue in between.
+	go r.Lookup("a")
+	go r.Register("b")
+
+	// Each instance both reads recursively and writes.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Describe()
+		}()
+	}
+	wg.Wait()
+}
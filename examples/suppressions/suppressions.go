@@ -0,0 +1,60 @@
+package main
+
+import "sync"
+
+type Stats struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	hits int
+	// @guarded_by(mu)
+	misses int
+}
+
+// Reported: nothing suppresses this access.
+func (s *Stats) Hit() {
+	s.hits++
+}
+
+// A trailing directive covers its own line.
+func (s *Stats) Miss() {
+	s.misses++ //gotsan:ignore guard-violation approximate counter, races are tolerated
+}
+
+// A directive on a line of its own covers the line below.
+func (s *Stats) Reset() {
+	//gotsan:ignore guard-violation only called before the stats are shared
+	s.hits = 0
+	s.misses++ // Reported: the directive does not reach this line.
+}
+
+// A directive in the doc comment covers the whole function.
+//
+//gotsan:ignore all snapshot tolerates torn reads
+func (s *Stats) Snapshot() (int, int) {
+	return s.hits, s.misses
+}
+
+// The body of a function annotated @no_analysis is not checked.
+//
+// @no_analysis
+func (s *Stats) Unchecked() {
+	s.mu.Lock()
+	s.hits++
+}
+
+// Unused: the rule does not match the finding on the next line, which is
+// still reported.
+func (s *Stats) Total() int {
+	//gotsan:ignore lock-leak wrong rule
+	return s.hits + s.misses
+}
+
+func main() {
+	s := &Stats{}
+	s.Hit()
+	s.Miss()
+	s.Reset()
+	s.Snapshot()
+	s.Unchecked()
+	s.Total()
+}
@@ -0,0 +1,150 @@
+package main
+
+import "sync"
+
+type Queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// @guarded_by(mu)
+	items  []int
+	closed bool
+
+	statsMu sync.Mutex
+	// @guarded_by(statsMu)
+	popped int
+}
+
+func NewQueue() *Queue {
+	q := &Queue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Not reported: Wait is called in a loop with q.mu held, and q.mu is held
+// again when it returns.
+func (q *Queue) Pop() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item
+}
+
+// Not reported: signalling once the lock is released is fine.
+func (q *Queue) Push(item int) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// Reported: Wait is called without q.mu held.
+func (q *Queue) AwaitClosed() {
+	for !q.closed {
+		q.cond.Wait()
+	}
+}
+
+// Reported: q.statsMu stays held while waiting for an item.
+func (q *Queue) PopCounted() int {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	q.popped++
+	return q.Pop()
+}
+
+// Reported: q.statsMu stays held while waiting for an item.
+func (q *Queue) PopCountedInline() int {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	q.popped++
+	return len(q.items)
+}
+
+// Advisory: the queue may be empty again when Wait returns.
+func (q *Queue) PopOnce() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	return len(q.items)
+}
+
+type Config struct {
+	mu      sync.RWMutex
+	changed *sync.Cond
+	// @guarded_by(mu)
+	version int
+}
+
+func NewConfig() *Config {
+	c := &Config{}
+	c.changed = sync.NewCond(c.mu.RLocker())
+	return c
+}
+
+// Not reported: readers wait holding the read lock the Cond's Locker takes.
+func (c *Config) AwaitVersion(v int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for c.version < v {
+		c.changed.Wait()
+	}
+}
+
+// Reported: c.mu is held exclusively, but Wait releases a read lock.
+func (c *Config) AwaitVersionLocked(v int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.version < v {
+		c.changed.Wait()
+	}
+}
+
+var (
+	readyMu sync.Mutex
+	ready   = sync.NewCond(&readyMu)
+	started bool
+)
+
+// Advisory: started changes without readyMu, so a waiter that has just
+// checked it may miss the broadcast.
+func start() {
+	started = true
+	ready.Broadcast()
+}
+
+// Not reported.
+func awaitStart() {
+	readyMu.Lock()
+	for !started {
+		ready.Wait()
+	}
+	readyMu.Unlock()
+}
+
+func main() {
+	q := NewQueue()
+	go q.Push(1)
+	_ = q.Pop()
+	_ = q.PopCounted()
+	_ = q.PopCountedInline()
+	_ = q.PopOnce()
+	q.AwaitClosed()
+
+	c := NewConfig()
+	c.AwaitVersion(1)
+	c.AwaitVersionLocked(1)
+
+	go start()
+	awaitStart()
+}
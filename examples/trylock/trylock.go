@@ -0,0 +1,103 @@
+package main
+
+import "sync"
+
+type Cache struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	entries map[string]string
+
+	stats sync.RWMutex
+	// @guarded_by(stats)
+	hits int
+}
+
+// Not reported: entries is only written once TryLock has succeeded.
+func (c *Cache) TryPut(key, value string) bool {
+	if !c.mu.TryLock() {
+		return false
+	}
+	defer c.mu.Unlock()
+	c.entries[key] = value
+	return true
+}
+
+// Reported: entries is written whether or not TryLock succeeded.
+func (c *Cache) PutIfFree(key, value string) {
+	ok := c.mu.TryLock()
+	c.entries[key] = value
+	if ok {
+		c.mu.Unlock()
+	}
+}
+
+// Reported: entries is written on the branch where TryLock failed.
+func (c *Cache) Evict(key string) {
+	if c.mu.TryLock() == true {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.entries, key)
+}
+
+// Not reported: hits is read under the shared lock TryRLock took.
+func (c *Cache) Hits() int {
+	if c.stats.TryRLock() {
+		defer c.stats.RUnlock()
+		return c.hits
+	}
+	return -1
+}
+
+// @returns_if(true, c.mu)
+func (c *Cache) tryAcquire() bool {
+	return c.mu.TryLock()
+}
+
+// Not reported: tryAcquire holds c.mu when it returns true.
+func (c *Cache) Refresh() {
+	if !c.tryAcquire() {
+		return
+	}
+	c.entries = make(map[string]string)
+	c.mu.Unlock()
+}
+
+// Reported: returns false with c.mu still held when stale is true.
+//
+// @returns_if(true, c.mu)
+func (c *Cache) tryAcquireFresh(stale bool) bool {
+	if !c.mu.TryLock() {
+		return false
+	}
+	if stale {
+		return false
+	}
+	return true
+}
+
+// Reported: returns true without c.mu when skip is true.
+//
+// @returns_if(true, c.mu)
+func (c *Cache) acquireUnlessSkipped(skip bool) bool {
+	if skip {
+		return true
+	}
+	c.mu.Lock()
+	return true
+}
+
+func main() {
+	c := &Cache{}
+	c.TryPut("a", "1")
+	c.PutIfFree("b", "2")
+	c.Evict("a")
+	_ = c.Hits()
+	c.Refresh()
+	if c.tryAcquireFresh(false) {
+		c.mu.Unlock()
+	}
+	if c.acquireUnlessSkipped(false) {
+		c.mu.Unlock()
+	}
+}
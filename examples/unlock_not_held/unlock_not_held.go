@@ -0,0 +1,69 @@
+package main
+
+import "sync"
+
+type Counter struct {
+	mu sync.RWMutex
+	// @guarded_by(mu)
+	n int
+}
+
+// Unlocking twice is a fatal runtime error.
+//
+// @acquires(c.mu)
+func (c *Counter) DoubleUnlock() {
+	c.mu.Lock()
+	c.n++
+	c.mu.Unlock()
+	c.mu.Unlock()
+}
+
+// The lock is only taken on one branch.
+//
+// @acquires(c.mu)
+func (c *Counter) MaybeLocked(reset bool) {
+	if reset {
+		c.mu.Lock()
+		c.n = 0
+	}
+	c.mu.Unlock()
+}
+
+// The explicit unlock leaves nothing for the deferred one to release.
+//
+// @acquires(c.mu)
+func (c *Counter) DeferAndUnlock() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.n
+	c.mu.Unlock()
+	return n
+}
+
+// A read lock must be released with RUnlock.
+//
+// @acquires(c.mu)
+func (c *Counter) WrongMode() int {
+	c.mu.RLock()
+	n := c.n
+	c.mu.Unlock()
+	return n
+}
+
+// Balanced locking is fine.
+//
+// @acquires(c.mu)
+func (c *Counter) Get() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.n
+}
+
+func main() {
+	c := new(Counter)
+	c.DoubleUnlock()
+	c.MaybeLocked(true)
+	c.DeferAndUnlock()
+	c.WrongMode()
+	c.Get()
+}
@@ -10,13 +10,57 @@ const (
 	Acquires
 	Returns
 	GuardedBy
+	RequiresShared
+	NoAnalysis
+	Excludes
+	Releases
+	AcquiredBefore
+	AcquiredAfter
+	LockType
+	LockMethod
+	UnlockMethod
+	ReturnsIf
 )
 
 var AnnotationKindMap = map[string]AnnotationKind{
-	"requires":   Requires,
-	"acquires":   Acquires,
-	"returns":    Returns,
-	"guarded_by": GuardedBy,
+	"requires":        Requires,
+	"acquires":        Acquires,
+	"returns":         Returns,
+	"guarded_by":      GuardedBy,
+	"requires_shared": RequiresShared,
+	"no_analysis":     NoAnalysis,
+	"excludes":        Excludes,
+	"releases":        Releases,
+	"acquired_before": AcquiredBefore,
+	"acquired_after":  AcquiredAfter,
+	"lock_type":       LockType,
+	"lock_method":     LockMethod,
+	"unlock_method":   UnlockMethod,
+	"returns_if":      ReturnsIf,
+}
+
+// Whether annotations of kind k take parameters. Those that do not may be
+// written without parentheses, e.g. @no_analysis.
+func (k AnnotationKind) TakesParams() bool {
+	return k != NoAnalysis && k != LockType
+}
+
+// Whether annotations of kind k may be written without parameters. This
+// holds for those that take none, and for @lock_method and @unlock_method,
+// whose mode parameter defaults to exclusive.
+func (k AnnotationKind) ParamsOptional() bool {
+	return !k.TakesParams() || k == LockMethod || k == UnlockMethod
+}
+
+// Whether annotations of kind k belong on data (struct fields and
+// variables) rather than on functions.
+func (k AnnotationKind) OnData() bool {
+	return k == GuardedBy || k == AcquiredBefore || k == AcquiredAfter
+}
+
+// Whether annotations of kind k belong on type declarations.
+func (k AnnotationKind) OnType() bool {
+	return k == LockType
 }
 
 func (k AnnotationKind) String() string {
@@ -29,6 +73,26 @@ func (k AnnotationKind) String() string {
 		return "returns"
 	case GuardedBy:
 		return "guarded_by"
+	case RequiresShared:
+		return "requires_shared"
+	case NoAnalysis:
+		return "no_analysis"
+	case Excludes:
+		return "excludes"
+	case Releases:
+		return "releases"
+	case AcquiredBefore:
+		return "acquired_before"
+	case AcquiredAfter:
+		return "acquired_after"
+	case LockType:
+		return "lock_type"
+	case LockMethod:
+		return "lock_method"
+	case UnlockMethod:
+		return "unlock_method"
+	case ReturnsIf:
+		return "returns_if"
 	default:
 		return fmt.Sprintf("AnnotationKind(%d)", int(k))
 	}
@@ -3,7 +3,10 @@ package ir
 import (
 	"fmt"
 	"go/token"
+	"go/types"
 	"gotsan/utils"
+	"io"
+	"slices"
 	"sort"
 	"strings"
 	"unicode"
@@ -12,14 +15,19 @@ import (
 // Represents a specific lock invariant
 // with the "Kind" mapping to an annotation function
 // And the Target being the specific mutex
+// For @returns_if, HeldWhen is the result the function returns when it
+// returns with the lock held.
 type Requirement struct {
-	Target string
+	Target   string
+	HeldWhen bool
 }
 
 // Represents concurrency invariants for specific function
+// NoAnalysis is set by @no_analysis: the function's body is not checked.
 type FunctionContract struct {
 	Expectations map[AnnotationKind][]Requirement
 	Pos          token.Pos
+	NoAnalysis   bool
 }
 
 // Represents data field (within a struct) or a variable guarded by a mutex
@@ -28,21 +36,129 @@ type DataInvariant struct {
 	Pos       token.Pos
 }
 
+// Represents a declared acquisition order between two locks, from an
+// @acquired_before or @acquired_after annotation on a mutex field or
+// variable: whenever both are held, Before must have been acquired first.
+// Locks are named by data key ("Type.field" or "var"), qualified with the
+// declaring package's import path when it is known (see
+// MakeQualifiedDataKey). Pos is the position of the annotated declaration.
+// Imported orders were declared in another package and imported from a
+// go/analysis fact; they are checked, but reported where they are declared.
+type LockOrder struct {
+	Before   string
+	After    string
+	Pos      token.Pos
+	Imported bool
+}
+
+// Modes named by @lock_method and @unlock_method. A method written without
+// a mode acquires or releases its receiver exclusively.
+const (
+	ExclusiveLockMode = "exclusive"
+	SharedLockMode    = "shared"
+)
+
+// Represents a //gotsan:ignore directive: diagnostics of Rule ("all" for
+// every rule) reported in File between StartLine and EndLine are dropped.
+// Pos is the position of the directive itself.
+type Suppression struct {
+	Rule      string
+	Reason    string
+	Pos       token.Pos
+	File      string
+	StartLine int
+	EndLine   int
+}
+
 // Represents all concurrency contracts in a program
 // Populated by AST Visitor and then consumed by the
 // SSA/CFG Analyzer to verify lock patterns
+//
+// QualifiedFunctions and QualifiedData are keyed by package path, receiver
+// and name (see MakeQualifiedFunctionKey and MakeQualifiedDataKey) and are
+// authoritative for the packages listed in Packages. Functions and Data keep
+// the loose keys without a package path; they are only consulted for
+// functions and data of packages that were not registered with a path.
 type ContractRegistry struct {
-	Functions      map[string]*FunctionContract
-	FunctionsByPos map[token.Pos]*FunctionContract
-	Data           map[string]*DataInvariant
+	Functions          map[string]*FunctionContract
+	FunctionsByPos     map[token.Pos]*FunctionContract
+	Data               map[string]*DataInvariant
+	QualifiedFunctions map[string]*FunctionContract
+	QualifiedData      map[string]*DataInvariant
+	Packages           map[string]bool
+	// Loose keys already reported as used, so each is reported once.
+	LooseMatches map[string]bool
+	Suppressions []Suppression
+	// Declared lock orders, forming a partial order over locks.
+	LockOrders []LockOrder
+	// Types annotated @lock_type, by type name and by qualified type name
+	// (see MakeQualifiedDataKey), with the position of their declaration.
+	LockTypes map[string]token.Pos
+	// Functions that may block indefinitely, by SSA name (see
+	// DefaultBlockingFunctions); holding a lock across a call of one keeps
+	// every goroutine that needs the lock waiting too.
+	BlockingFunctions map[string]bool
+}
+
+// DefaultBlockingFunctions are the functions and methods known to block,
+// named as SSA names them: "pkgpath.Func", "(*pkgpath.Type).Method", or
+// "(pkgpath.Interface).Method" for calls through an interface.
+var DefaultBlockingFunctions = []string{
+	"time.Sleep",
+	"(*sync.WaitGroup).Wait",
+	"net.Dial",
+	"net.DialTimeout",
+	"(*net.Dialer).Dial",
+	"(*net.Dialer).DialContext",
+	"(net.Conn).Read",
+	"(net.Conn).Write",
+	"(net.Listener).Accept",
+	"net/http.Get",
+	"net/http.Head",
+	"net/http.Post",
+	"net/http.PostForm",
+	"(*net/http.Client).Do",
+	"(*net/http.Client).Get",
+	"(*net/http.Client).Head",
+	"(*net/http.Client).Post",
+	"(*net/http.Client).PostForm",
+	"(*os/exec.Cmd).Run",
+	"(*os/exec.Cmd).Wait",
+	"(*os/exec.Cmd).Output",
+	"(*os/exec.Cmd).CombinedOutput",
+	"(*golang.org/x/sync/errgroup.Group).Wait",
 }
 
 func NewContractRegistry() *ContractRegistry {
-	return &ContractRegistry{
-		Functions:      make(map[string]*FunctionContract),
-		FunctionsByPos: make(map[token.Pos]*FunctionContract),
-		Data:           make(map[string]*DataInvariant),
+	cr := &ContractRegistry{
+		Functions:          make(map[string]*FunctionContract),
+		FunctionsByPos:     make(map[token.Pos]*FunctionContract),
+		Data:               make(map[string]*DataInvariant),
+		QualifiedFunctions: make(map[string]*FunctionContract),
+		QualifiedData:      make(map[string]*DataInvariant),
+		Packages:           make(map[string]bool),
+		LooseMatches:       make(map[string]bool),
+		LockTypes:          make(map[string]token.Pos),
+		BlockingFunctions:  make(map[string]bool),
 	}
+	cr.AddBlockingFunctions(DefaultBlockingFunctions...)
+	return cr
+}
+
+// AddBlockingFunctions adds functions, named as in DefaultBlockingFunctions,
+// to those known to block. Blank names are ignored.
+func (cr *ContractRegistry) AddBlockingFunctions(names ...string) {
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			cr.BlockingFunctions[name] = true
+		}
+	}
+}
+
+// IsBlockingFunction reports whether the function or method with the SSA
+// name name is known to block.
+func (cr *ContractRegistry) IsBlockingFunction(name string) bool {
+	return cr != nil && cr.BlockingFunctions[name]
 }
 
 func MakeFunctionKey(name string, receiverType string) string {
@@ -52,6 +168,136 @@ func MakeFunctionKey(name string, receiverType string) string {
 	return receiverType + "." + name
 }
 
+// MakeQualifiedFunctionKey qualifies a function key with the import path of
+// the declaring package, e.g. "example.com/cache.*Cache.Get".
+func MakeQualifiedFunctionKey(pkgPath string, name string, receiverType string) string {
+	return pkgPath + "." + MakeFunctionKey(name, receiverType)
+}
+
+// QualifiedFunctionKeyForObject is the MakeQualifiedFunctionKey of a
+// type-checked function or method.
+func QualifiedFunctionKeyForObject(obj *types.Func) string {
+	if obj == nil || obj.Pkg() == nil {
+		return ""
+	}
+
+	recv := ""
+	if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+		recv = RelativeTypeName(sig.Recv().Type())
+	}
+	return MakeQualifiedFunctionKey(obj.Pkg().Path(), obj.Name(), recv)
+}
+
+// RelativeTypeName spells t the way registry keys do: type names without
+// their package path, e.g. "*Cache".
+func RelativeTypeName(t types.Type) string {
+	return NormalizeTypeName(types.TypeString(t, func(*types.Package) string { return "" }))
+}
+
+// MakeQualifiedDataKey qualifies a data key ("Type.field" or "var") with the
+// import path of the declaring package.
+func MakeQualifiedDataKey(pkgPath string, key string) string {
+	return pkgPath + "." + key
+}
+
+// Whether contracts of the package at pkgPath were registered with qualified
+// keys, making the qualified maps authoritative for it.
+func (cr *ContractRegistry) HasPackage(pkgPath string) bool {
+	return cr != nil && pkgPath != "" && cr.Packages[pkgPath]
+}
+
+// IsLockType reports whether the type named name, declared in the package
+// at pkgPath, is annotated @lock_type. Types of packages registered without
+// a path are matched by name.
+func (cr *ContractRegistry) IsLockType(pkgPath string, name string) bool {
+	if cr == nil || name == "" {
+		return false
+	}
+	if cr.HasPackage(pkgPath) {
+		_, ok := cr.LockTypes[MakeQualifiedDataKey(pkgPath, name)]
+		return ok
+	}
+	_, ok := cr.LockTypes[name]
+	return ok
+}
+
+// DeclaredLockOrder returns a chain of declared orders by which lock before
+// must be acquired before lock after, or nil if the declared order does not
+// relate them that way.
+func (cr *ContractRegistry) DeclaredLockOrder(before string, after string) []LockOrder {
+	if cr == nil || before == "" || after == "" || before == after {
+		return nil
+	}
+
+	// Breadth-first, so the shortest chain is returned.
+	via := map[string]LockOrder{}
+	visited := map[string]bool{before: true}
+	queue := []string{before}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		for _, order := range cr.LockOrders {
+			if order.Before != curr || visited[order.After] {
+				continue
+			}
+			visited[order.After] = true
+			via[order.After] = order
+			if order.After != after {
+				queue = append(queue, order.After)
+				continue
+			}
+
+			chain := []LockOrder{order}
+			for chain[0].Before != before {
+				chain = append([]LockOrder{via[chain[0].Before]}, chain...)
+			}
+			return chain
+		}
+	}
+	return nil
+}
+
+// LockOrderCycles returns the cycles in the declared lock orders, each as the
+// chain of orders that forms it, starting from its smallest lock name.
+func (cr *ContractRegistry) LockOrderCycles() [][]LockOrder {
+	if cr == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	cycles := make([][]LockOrder, 0)
+	for _, order := range cr.LockOrders {
+		chain := cr.DeclaredLockOrder(order.After, order.Before)
+		if order.Before == order.After {
+			chain = []LockOrder{}
+		} else if chain == nil {
+			continue
+		}
+		cycle := append([]LockOrder{order}, chain...)
+
+		// Rotate to the smallest lock, so each cycle is reported once.
+		start := 0
+		for i, o := range cycle {
+			if o.Before < cycle[start].Before {
+				start = i
+			}
+		}
+		cycle = slices.Concat(cycle[start:], cycle[:start])
+
+		names := make([]string, 0, len(cycle))
+		for _, o := range cycle {
+			names = append(names, o.Before)
+		}
+		key := strings.Join(names, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		cycles = append(cycles, cycle)
+	}
+	return cycles
+}
+
 func NormalizeTypeName(typeName string) string {
 	if typeName == "" {
 		return ""
@@ -85,19 +331,20 @@ func NormalizeTypeName(typeName string) string {
 	return out.String()
 }
 
-func (cr *ContractRegistry) PrintContractRegistry(fset *token.FileSet) {
+// PrintContractRegistry writes a listing of the registered contracts to w.
+func (cr *ContractRegistry) PrintContractRegistry(w io.Writer, fset *token.FileSet) {
 	if cr == nil {
-		fmt.Println("<nil ContractRegistry>")
+		fmt.Fprintln(w, "<nil ContractRegistry>")
 		return
 	}
 
-	fmt.Println("=== Contract Registry ===")
+	fmt.Fprintln(w, "=== Contract Registry ===")
 
 	// -------- Functions --------
-	fmt.Println("\n-- Functions --")
+	fmt.Fprintln(w, "\n-- Functions --")
 
 	if len(cr.Functions) == 0 {
-		fmt.Println("(none)")
+		fmt.Fprintln(w, "(none)")
 	} else {
 		fnNames := make([]string, 0, len(cr.Functions))
 		for name := range cr.Functions {
@@ -108,19 +355,19 @@ func (cr *ContractRegistry) PrintContractRegistry(fset *token.FileSet) {
 		for _, fn := range fnNames {
 			fc := cr.Functions[fn]
 			if fc == nil {
-				fmt.Printf("%s: <nil>\n", fn)
+				fmt.Fprintf(w, "%s: <nil>\n", fn)
 				continue
 			}
 
 			posStr := utils.FormatPos(fset, fc.Pos)
 			if posStr != "" {
-				fmt.Printf("%s @ %s\n", fn, posStr)
+				fmt.Fprintf(w, "%s @ %s\n", fn, posStr)
 			} else {
-				fmt.Printf("%s\n", fn)
+				fmt.Fprintf(w, "%s\n", fn)
 			}
 
 			if len(fc.Expectations) == 0 {
-				fmt.Println("  (no expectations)")
+				fmt.Fprintln(w, "  (no expectations)")
 				continue
 			}
 
@@ -137,16 +384,16 @@ func (cr *ContractRegistry) PrintContractRegistry(fset *token.FileSet) {
 				if len(reqs) == 0 {
 					continue
 				}
-				fmt.Printf("  - %s: %d\n", kind.String(), len(reqs))
+				fmt.Fprintf(w, "  - %s: %d\n", kind.String(), len(reqs))
 			}
 		}
 	}
 
 	// -------- Data Invariants --------
-	fmt.Println("\n-- Data Invariants/Guards --")
+	fmt.Fprintln(w, "\n-- Data Invariants/Guards --")
 
 	if len(cr.Data) == 0 {
-		fmt.Println("(none)")
+		fmt.Fprintln(w, "(none)")
 	} else {
 		fieldNames := make([]string, 0, len(cr.Data))
 		for name := range cr.Data {
@@ -157,18 +404,18 @@ func (cr *ContractRegistry) PrintContractRegistry(fset *token.FileSet) {
 		for _, field := range fieldNames {
 			g := cr.Data[field]
 			if g == nil {
-				fmt.Printf("%s: <nil>\n", field)
+				fmt.Fprintf(w, "%s: <nil>\n", field)
 				continue
 			}
 
 			posStr := utils.FormatPos(fset, g.Pos)
 			if posStr != "" {
-				fmt.Printf("%s guarded by %s @ %s\n", field, g.MutexName, posStr)
+				fmt.Fprintf(w, "%s guarded by %s @ %s\n", field, g.MutexName, posStr)
 			} else {
-				fmt.Printf("%s guarded by %s\n", field, g.MutexName)
+				fmt.Fprintf(w, "%s guarded by %s\n", field, g.MutexName)
 			}
 		}
 	}
 
-	fmt.Println(strings.Repeat("=", 26))
+	fmt.Fprintln(w, strings.Repeat("=", 26))
 }
@@ -0,0 +1,39 @@
+package ir
+
+import "testing"
+
+func TestNewContractRegistryKnowsDefaultBlockingFunctions(t *testing.T) {
+	registry := NewContractRegistry()
+	for _, name := range DefaultBlockingFunctions {
+		if !registry.IsBlockingFunction(name) {
+			t.Errorf("expected %s to be blocking by default", name)
+		}
+	}
+	if registry.IsBlockingFunction("example.com/db.Query") {
+		t.Error("functions are not blocking unless listed")
+	}
+}
+
+func TestAddBlockingFunctions(t *testing.T) {
+	registry := NewContractRegistry()
+	registry.AddBlockingFunctions(" (*example.com/db.Pool).Acquire", "", "example.com/rpc.Call ", "  ")
+
+	for _, name := range []string{"(*example.com/db.Pool).Acquire", "example.com/rpc.Call"} {
+		if !registry.IsBlockingFunction(name) {
+			t.Errorf("expected %s to be blocking once added", name)
+		}
+	}
+	if registry.IsBlockingFunction("") {
+		t.Error("blank names must be ignored")
+	}
+	if want := len(DefaultBlockingFunctions) + 2; len(registry.BlockingFunctions) != want {
+		t.Errorf("expected %d blocking functions, got %d", want, len(registry.BlockingFunctions))
+	}
+}
+
+func TestIsBlockingFunctionOnNilRegistry(t *testing.T) {
+	var registry *ContractRegistry
+	if registry.IsBlockingFunction("time.Sleep") {
+		t.Error("a nil registry knows no blocking functions")
+	}
+}
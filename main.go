@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/token"
@@ -10,6 +11,9 @@ import (
 	"gotsan/utils/report"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
@@ -25,17 +29,83 @@ func main() {
 	verbose := flag.Bool("v", false, "enable debug logs")
 	ignoreMissingAnnotations := flag.Bool("ignore-missing-annotations", false, "suppress heuristic missing annotation advisory warnings")
 	includeTestFiles := flag.Bool("include-tests", true, "include test files in analysis (default: true)")
-	flag.Parse()
+	wholeProgram := flag.Bool("whole-program", false, "analyze all loaded packages as one program, relating locks and calls across packages")
+	explain := flag.Bool("explain", false, "explain each finding with the path of lock operations that led to it")
+	format := flag.String("format", "text", "output format: text, json or sarif")
+	enableRules := flag.String("rules", "", "comma-separated rule IDs to report; all rules when empty")
+	disableRules := flag.String("disable", "", "comma-separated rule IDs not to report")
+	failOn := flag.String("fail-on", report.FailOnFindings, "what fails the run: findings, warnings (findings and advisory warnings) or none")
+	baselineFile := flag.String("baseline", "", "only report diagnostics not recorded in this baseline file")
+	writeBaselineFile := flag.String("write-baseline", "", "record the current diagnostics in this baseline file and exit")
+	diffFile := flag.String("diff", "", "only report diagnostics touching the hunks of this unified diff file")
+	sinceRev := flag.String("since", "", "only report diagnostics touching lines changed since this git revision")
+	thresholds := flag.String("threshold", "", "comma-separated rule=N entries: fail only above N diagnostics of the rule, or never with rule=none")
+	blocking := flag.String("blocking", "", "comma-separated functions that block, added to the built-in list, e.g. (*example.com/db.Pool).Acquire")
+
+	// Invalid flags exit with ExitError rather than the flag package's 2,
+	// which is ExitWarnings.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(report.ExitOK)
+		}
+		os.Exit(report.ExitError)
+	}
 
 	if *lenient && *strict {
 		fmt.Println("cannot specify both -l and -s flags")
-		os.Exit(1)
+		os.Exit(report.ExitError)
+	}
+
+	policy := report.FailurePolicy{}
+	var err error
+	if policy.FailOn, err = report.ParseFailOn(*failOn); err != nil {
+		fmt.Printf("invalid -fail-on: %v\n", err)
+		os.Exit(report.ExitError)
+	}
+	if policy.RuleThresholds, err = report.ParseRuleThresholds(*thresholds); err != nil {
+		fmt.Printf("invalid -threshold: %v\n", err)
+		os.Exit(report.ExitError)
+	}
+
+	if *diffFile != "" && *sinceRev != "" {
+		fmt.Println("cannot specify both -diff and -since flags")
+		os.Exit(report.ExitError)
+	}
+
+	// Baselines, diffs and SARIF paths are relative to the working directory.
+	root, _ := os.Getwd()
+
+	var changes report.ChangedLines
+	if *diffFile != "" || *sinceRev != "" {
+		if changes, err = readChangedLines(*diffFile, *sinceRev, root); err != nil {
+			fmt.Printf("failed to read changes: %v\n", err)
+			os.Exit(report.ExitError)
+		}
+	}
+
+	var baseline *report.Baseline
+	if *baselineFile != "" {
+		if baseline, err = readBaseline(*baselineFile); err != nil {
+			fmt.Printf("invalid -baseline: %v\n", err)
+			os.Exit(report.ExitError)
+		}
 	}
 
 	if *verbose {
 		logger.SetLevel(logger.Debug)
 	}
 
+	switch *format {
+	case "text":
+	case "json", "sarif":
+		// stdout carries the report; logs go to stderr.
+		logger.SetOutput(os.Stderr)
+	default:
+		fmt.Printf("unknown -format %q: expected text, json or sarif\n", *format)
+		os.Exit(report.ExitError)
+	}
+
 	if *filePath == "" && *pkgPattern == "" {
 		fmt.Println("Usage:")
 		fmt.Println("   gotsan -file <path-to-go-file>")
@@ -49,7 +119,33 @@ func main() {
 		fmt.Println("   -v                        verbose logging")
 		fmt.Println("   -include-tests            include test files in analysis (default: true)")
 		fmt.Println("   -ignore-missing-annotations suppress missing annotation advisory warnings")
-		os.Exit(1)
+		fmt.Println("   -explain                  explain findings with the path that led to them")
+		fmt.Println("   -whole-program            analyze all loaded packages together (cross-package lock orders)")
+		fmt.Println("   -format <text|json|sarif> output format (default: text)")
+		fmt.Println("   -rules <id,...>           only report the listed rules")
+		fmt.Println("   -disable <id,...>         do not report the listed rules")
+		fmt.Println("   -fail-on <findings|warnings|none> what sets a non-zero exit code (default: findings)")
+		fmt.Println("   -threshold <id=N,...>     tolerate up to N diagnostics of a rule (id=none: never fail on it)")
+		fmt.Println("   -baseline <file>          only report diagnostics not recorded in the baseline")
+		fmt.Println("   -write-baseline <file>    record the current diagnostics as the baseline and exit")
+		fmt.Println("   -diff <file>              only report diagnostics touching the hunks of a unified diff")
+		fmt.Println("   -since <rev>              only report diagnostics touching lines changed since a git revision")
+		fmt.Println("   -blocking <fn,...>        also treat the listed functions as blocking while a lock is held")
+		fmt.Println("")
+		fmt.Println("Exit codes:")
+		fmt.Println("   0  no diagnostics above the failure thresholds")
+		fmt.Println("   1  findings above the failure thresholds")
+		fmt.Println("   2  advisory warnings above the failure thresholds, no failing findings")
+		fmt.Println("   3  invalid flags, or packages that fail to load or parse")
+		os.Exit(report.ExitError)
+	}
+
+	run := report.RunInfo{StartedAt: time.Now()}
+	phaseStart := run.StartedAt
+	endPhase := func(name string) {
+		now := time.Now()
+		run.Phases = append(run.Phases, report.PhaseTiming{Name: name, Duration: now.Sub(phaseStart)})
+		phaseStart = now
 	}
 
 	fset := token.NewFileSet()
@@ -67,32 +163,51 @@ func main() {
 
 	pkgs, err := packages.Load(cfg, pattern)
 	if err != nil {
-		log.Fatalf("failed to load packages: %v", err)
+		log.Printf("failed to load packages: %v", err)
+		os.Exit(report.ExitError)
 	}
 
 	if packages.PrintErrors(pkgs) > 0 {
-		os.Exit(1)
+		os.Exit(report.ExitError)
 	}
+	endPhase("load")
 
 	// 1. Annotation Discovery Phase (AST)
 	// One registry is used for the entire run
 	registry := ir.NewContractRegistry()
+	registry.AddBlockingFunctions(strings.Split(*blocking, ",")...)
+
+	reporter := report.NewReporter()
 
 	// Walk every file in every loaded package
 	for _, pkg := range pkgs {
-		pipeline.PopulateRegistryFromFiles(registry, pkg.Syntax, fset)
+		for _, warning := range pipeline.PopulateRegistryFromFiles(registry, pkg.PkgPath, pkg.Syntax, fset) {
+			position := fset.Position(warning.Pos)
+			reporter.WarnParse(report.Diagnostic{
+				Pos:     warning.Pos,
+				File:    position.Filename,
+				Line:    position.Line,
+				Column:  position.Column,
+				Message: warning.Message,
+			})
+		}
 	}
+	pipeline.RegisterSuppressions(registry, reporter, fset)
+	endPhase("annotations")
 
 	if logger.IsVerbose() {
-		registry.PrintContractRegistry(fset)
+		registry.PrintContractRegistry(logger.Writer(), fset)
 	}
 
 	// 2. Analysis Phase
 	prog, ssaPkgs := ssautil.Packages(pkgs, ssa.BuilderMode(0))
 	prog.Build()
+	endPhase("ssa")
 
-	reporter := report.NewReporter()
 	reporter.IgnoreMissingAnnotations = *ignoreMissingAnnotations
+	reporter.Explain = *explain
+	reporter.EnabledRules = parseRuleList("-rules", *enableRules)
+	reporter.DisabledRules = parseRuleList("-disable", *disableRules)
 
 	strictMode := true
 	if *lenient {
@@ -101,13 +216,142 @@ func main() {
 		strictMode = true
 	}
 
-	for _, ssaPkg := range ssaPkgs {
-		if ssaPkg == nil {
-			continue
+	if *wholeProgram {
+		pipeline.AnalyzeSSAProgram(ssaPkgs, registry, reporter, fset, strictMode)
+	} else {
+		for _, ssaPkg := range ssaPkgs {
+			if ssaPkg == nil {
+				continue
+			}
+
+			pipeline.AnalyzeSSAPackage(ssaPkg, registry, reporter, fset, strictMode)
 		}
+	}
 
-		pipeline.AnalyzeSSAPackage(ssaPkg, registry, reporter, fset, strictMode)
+	endPhase("analysis")
+
+	if *writeBaselineFile != "" {
+		if err := writeBaseline(*writeBaselineFile, reporter.Baseline(root)); err != nil {
+			log.Printf("failed to write baseline: %v", err)
+			os.Exit(report.ExitError)
+		}
+		logger.Infof("Recorded %d finding(s) and %d warning(s) in baseline %s", len(reporter.Findings), len(reporter.Warnings), *writeBaselineFile)
+		os.Exit(report.ExitOK)
+	}
+	if baseline != nil {
+		if stale := reporter.ApplyBaseline(*baseline, root); stale > 0 {
+			logger.Infof("%d diagnostic(s) recorded in baseline %s no longer occur; refresh it with -write-baseline", stale, *baselineFile)
+		}
+	}
+	if changes != nil {
+		reporter.KeepChanged(changes, root)
 	}
 
-	reporter.Print()
+	switch *format {
+	case "json":
+		run.Mode = "strict"
+		if !strictMode {
+			run.Mode = "lenient"
+		}
+		run.WholeProgram = *wholeProgram
+		run.Patterns = []string{pattern}
+		run.Packages = loadedPackagePaths(pkgs)
+		run.Duration = time.Since(run.StartedAt)
+		if err := reporter.WriteJSON(os.Stdout, run); err != nil {
+			log.Printf("failed to write JSON: %v", err)
+			os.Exit(report.ExitError)
+		}
+	case "sarif":
+		if err := reporter.WriteSARIF(os.Stdout, root); err != nil {
+			log.Printf("failed to write SARIF: %v", err)
+			os.Exit(report.ExitError)
+		}
+	default:
+		reporter.Print()
+	}
+
+	os.Exit(reporter.ExitCode(policy))
+}
+
+// The changed lines of the diff in diffFile, or of the working tree since
+// the git revision since. Paths are relative to root.
+func readChangedLines(diffFile string, since string, root string) (report.ChangedLines, error) {
+	if diffFile != "" {
+		file, err := os.Open(diffFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return report.ParseUnifiedDiff(file, root)
+	}
+
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "--relative", since, "--")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git diff %s: %s", since, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return report.ParseUnifiedDiff(bytes.NewReader(out), root)
+}
+
+func readBaseline(path string) (*report.Baseline, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	baseline, err := report.ReadBaseline(file)
+	if err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+func writeBaseline(path string, baseline report.Baseline) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteBaseline(file, baseline); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Import paths of the loaded packages, without duplicates (test variants
+// share the path of their package).
+func loadedPackagePaths(pkgs []*packages.Package) []string {
+	paths := make([]string, 0, len(pkgs))
+	seen := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		if seen[pkg.PkgPath] {
+			continue
+		}
+		seen[pkg.PkgPath] = true
+		paths = append(paths, pkg.PkgPath)
+	}
+	return paths
+}
+
+// Parse a comma-separated list of rule IDs given to flag, exiting on unknown
+// IDs.
+func parseRuleList(flagName string, list string) map[string]bool {
+	rules := make(map[string]bool)
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, ok := report.RuleByID(id); !ok {
+			fmt.Printf("unknown rule %q in %s\n", id, flagName)
+			os.Exit(report.ExitError)
+		}
+		rules[id] = true
+	}
+	return rules
 }
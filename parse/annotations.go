@@ -41,6 +41,13 @@ func parseAnnotation(annotation string) (Annotation, error) {
 	open := strings.Index(annotation, "(")
 	close := strings.Index(annotation, ")")
 
+	// Annotations without parameters may omit the parentheses
+	if open == -1 && close == -1 {
+		if kind, ok := ir.AnnotationKindMap[annotation]; ok && kind.ParamsOptional() {
+			return Annotation{Kind: kind}, nil
+		}
+	}
+
 	if open == -1 || close == -1 || open > close {
 		return Annotation{}, fmt.Errorf("invalid annotation format: %q", annotation)
 	}
@@ -51,7 +58,15 @@ func parseAnnotation(annotation string) (Annotation, error) {
 		return Annotation{}, fmt.Errorf("unknown annotation name: %q", annotationName)
 	}
 
-	params := strings.Split(annotation[open+1:close], ",")
+	inner := strings.TrimSpace(annotation[open+1 : close])
+	if !kind.TakesParams() {
+		if inner != "" {
+			return Annotation{}, fmt.Errorf("annotation @%s takes no parameters: %q", annotationName, annotation)
+		}
+		return Annotation{Kind: kind}, nil
+	}
+
+	params := strings.Split(inner, ",")
 	for i := range params {
 		params[i] = strings.TrimSpace(params[i])
 	}
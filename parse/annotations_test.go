@@ -43,6 +43,36 @@ func TestParseAnnotation(t *testing.T) {
 			wantKind:   ir.Returns,
 			wantParams: []string{"mu"},
 		},
+		{
+			name:       "Requires Shared",
+			comment:    "//@requires_shared(mu)",
+			wantKind:   ir.RequiresShared,
+			wantParams: []string{"mu"},
+		},
+		{
+			name:       "Excludes",
+			comment:    "// @excludes(s.mu)",
+			wantKind:   ir.Excludes,
+			wantParams: []string{"s.mu"},
+		},
+		{
+			name:       "Releases",
+			comment:    "// @releases(c.mu)",
+			wantKind:   ir.Releases,
+			wantParams: []string{"c.mu"},
+		},
+		{
+			name:       "Shared Lock Method",
+			comment:    "// @lock_method(shared)",
+			wantKind:   ir.LockMethod,
+			wantParams: []string{"shared"},
+		},
+		{
+			name:       "Returns If",
+			comment:    "// @returns_if(true, c.mu)",
+			wantKind:   ir.ReturnsIf,
+			wantParams: []string{"true", "c.mu"},
+		},
 		{
 			name:       "Mixed Case Keyword",
 			comment:    "// @requires(mu)",
@@ -70,6 +100,36 @@ func TestParseAnnotation(t *testing.T) {
 	}
 }
 
+func TestParseAnnotationWithoutParams(t *testing.T) {
+	for _, comment := range []string{"// @no_analysis", "//@no_analysis()"} {
+		actual, err := ParseAnnotation(comment)
+		if err != nil {
+			t.Fatalf("ParseAnnotation(%q) error = %v", comment, err)
+		}
+		if actual.Kind != ir.NoAnalysis || len(actual.Params) != 0 {
+			t.Fatalf("ParseAnnotation(%q) = %+v, want @no_analysis without params", comment, actual)
+		}
+	}
+
+	for comment, kind := range map[string]ir.AnnotationKind{
+		"// @lock_type":     ir.LockType,
+		"// @lock_method":   ir.LockMethod,
+		"// @unlock_method": ir.UnlockMethod,
+	} {
+		actual, err := ParseAnnotation(comment)
+		if err != nil || actual.Kind != kind || len(actual.Params) != 0 {
+			t.Fatalf("ParseAnnotation(%q) = %+v, %v, want @%s without params", comment, actual, err, kind)
+		}
+	}
+
+	if _, err := ParseAnnotation("// @no_analysis(mu)"); err == nil {
+		t.Fatal("expected parse error for parameters on @no_analysis")
+	}
+	if _, err := ParseAnnotation("// @requires"); err == nil {
+		t.Fatal("expected parse error for @requires without parameters")
+	}
+}
+
 func TestParseAnnotationRejectsUnknownAnnotationName(t *testing.T) {
 	_, err := ParseAnnotation("//@acquire(mu)")
 	if err == nil {
@@ -1,18 +1,36 @@
 package parse
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
 	"gotsan/ir"
 	"gotsan/utils/logger"
+	"gotsan/utils/report"
+	"slices"
+	"strconv"
 	"strings"
 )
 
 // Implements the ast.Visitor interface
+// PkgPath is the import path of the package being visited. When set,
+// contracts are also registered under package-qualified keys.
+// Warnings collects the parse warnings emitted while visiting.
 type Visitor struct {
 	Fset     *token.FileSet
 	Registry *ir.ContractRegistry
+	PkgPath  string
+	Warnings []Warning
+	// Import paths of the current file's imports, by package name.
+	imports map[string]string
+}
+
+// Warning is a problem with an annotation found while parsing. The
+// annotation is ignored and the analysis goes on.
+type Warning struct {
+	Pos     token.Pos
+	Message string
 }
 
 var parseWarningsHeaderPrinted bool
@@ -28,6 +46,13 @@ func emitParseWarning(format string, args ...any) {
 	logger.Warnf(format, args...)
 }
 
+// Record a parse warning at pos and log it.
+func (v *Visitor) warn(pos token.Pos, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	v.Warnings = append(v.Warnings, Warning{Pos: pos, Message: message})
+	emitParseWarning("%s at %s", message, v.Fset.Position(pos))
+}
+
 // Given a CommentGroup AST type, loop through and return all discovered
 // annotations
 func (v *Visitor) parseAnnotations(groups ...*ast.CommentGroup) []Annotation {
@@ -39,7 +64,7 @@ func (v *Visitor) parseAnnotations(groups ...*ast.CommentGroup) []Annotation {
 		for _, c := range group.List {
 			ann, err := ParseAnnotation(c.Text)
 			if err != nil {
-				emitParseWarning("Ignoring annotation %q at %s: %v", c.Text, v.Fset.Position(c.Pos()), err)
+				v.warn(c.Pos(), "Ignoring annotation %q: %v", c.Text, err)
 				continue
 			}
 
@@ -51,11 +76,74 @@ func (v *Visitor) parseAnnotations(groups ...*ast.CommentGroup) []Annotation {
 	return discovered
 }
 
-// Register a list of annotations as data invariants
-func (v *Visitor) registerDataInvariants(annotations []Annotation, names []*ast.Ident, prefix string, pos token.Pos) {
+// Prefix of suppression directives: //gotsan:ignore <rule> <reason>
+const suppressionDirective = "//gotsan:ignore"
+
+// Register the //gotsan:ignore directives of file. A directive in the doc
+// comment of a function covers the whole function; any other covers its
+// own line and the next, so it may trail the offending line or precede it.
+func (v *Visitor) registerSuppressions(file *ast.File) {
+	functionDocs := make(map[*ast.Comment]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Doc != nil {
+			for _, c := range fn.Doc.List {
+				functionDocs[c] = fn
+			}
+		}
+	}
+
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			rest, ok := strings.CutPrefix(c.Text, suppressionDirective)
+			if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+				continue
+			}
+
+			fields := strings.Fields(rest)
+			if len(fields) < 2 {
+				v.warn(c.Pos(), "Ignoring %q: expected %s <rule> <reason>", c.Text, suppressionDirective)
+				continue
+			}
+			rule := fields[0]
+			if _, known := report.RuleByID(rule); !known && rule != report.SuppressAllRules {
+				v.warn(c.Pos(), "Ignoring %q: unknown rule %q", c.Text, rule)
+				continue
+			}
+
+			// The test variants of a package share its files, so the same
+			// directive is seen once per variant.
+			if slices.ContainsFunc(v.Registry.Suppressions, func(s ir.Suppression) bool { return s.Pos == c.Pos() }) {
+				continue
+			}
+
+			position := v.Fset.Position(c.Pos())
+			suppression := ir.Suppression{
+				Rule:      rule,
+				Reason:    strings.Join(fields[1:], " "),
+				Pos:       c.Pos(),
+				File:      position.Filename,
+				StartLine: position.Line,
+				EndLine:   position.Line + 1,
+			}
+			if fn, ok := functionDocs[c]; ok {
+				suppression.StartLine = v.Fset.Position(fn.Pos()).Line
+				suppression.EndLine = v.Fset.Position(fn.End()).Line
+			}
+			v.Registry.Suppressions = append(v.Registry.Suppressions, suppression)
+		}
+	}
+}
+
+// Register a list of annotations as data invariants. fields holds the
+// names of the other fields of the struct when names are struct fields.
+func (v *Visitor) registerDataInvariants(annotations []Annotation, names []*ast.Ident, prefix string, fields map[string]bool, pos token.Pos) {
 	for _, ann := range annotations {
+		if ann.Kind == ir.AcquiredBefore || ann.Kind == ir.AcquiredAfter {
+			v.registerLockOrders(ann, names, prefix, fields, pos)
+			continue
+		}
 		if ann.Kind != ir.GuardedBy {
-			emitParseWarning("Unexpected annotation @%s on a data field — only @guarded_by is valid here at %s", ann.Kind.String(), v.Fset.Position(pos))
+			v.warn(pos, "Unexpected annotation @%s on a data field — only @guarded_by, @acquired_before and @acquired_after are valid here", ann.Kind.String())
 			continue
 		}
 
@@ -66,15 +154,72 @@ func (v *Visitor) registerDataInvariants(annotations []Annotation, names []*ast.
 			}
 
 			for _, param := range ann.Params {
-				v.Registry.Data[key] = &ir.DataInvariant{
+				invariant := &ir.DataInvariant{
 					MutexName: param,
 					Pos:       pos,
 				}
+				v.Registry.Data[key] = invariant
+				if v.PkgPath != "" {
+					v.Registry.QualifiedData[ir.MakeQualifiedDataKey(v.PkgPath, key)] = invariant
+				}
 			}
 		}
 	}
 }
 
+// The key under which lock orders name a data key of this package.
+func (v *Visitor) lockOrderKey(key string) string {
+	if v.PkgPath == "" {
+		return key
+	}
+	return ir.MakeQualifiedDataKey(v.PkgPath, key)
+}
+
+// The key of a lock named in an ordering annotation: a sibling field of the
+// annotated struct field, a "Type.field" or variable of this package, or a
+// variable of an imported package ("pkg.Var").
+func (v *Visitor) lockOrderTarget(name string, prefix string, fields map[string]bool) string {
+	if fields[name] {
+		return v.lockOrderKey(prefix + "." + name)
+	}
+
+	if pkgName, rest, ok := strings.Cut(name, "."); ok {
+		if path, imported := v.imports[pkgName]; imported {
+			if v.PkgPath == "" {
+				return rest
+			}
+			return ir.MakeQualifiedDataKey(path, rest)
+		}
+	}
+	return v.lockOrderKey(name)
+}
+
+// Register @acquired_before and @acquired_after annotations as declared lock
+// orders between the annotated locks and the ones they name.
+func (v *Visitor) registerLockOrders(ann Annotation, names []*ast.Ident, prefix string, fields map[string]bool, pos token.Pos) {
+	for _, nameIdent := range names {
+		key := nameIdent.Name
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		self := v.lockOrderKey(key)
+
+		for _, param := range ann.Params {
+			other := v.lockOrderTarget(strings.TrimSpace(param), prefix, fields)
+			order := ir.LockOrder{Before: self, After: other, Pos: pos}
+			if ann.Kind == ir.AcquiredAfter {
+				order.Before, order.After = other, self
+			}
+			// The test variants of a package share its files, so the same
+			// annotation is seen once per variant.
+			if slices.Contains(v.Registry.LockOrders, order) {
+				continue
+			}
+			v.Registry.LockOrders = append(v.Registry.LockOrders, order)
+		}
+	}
+}
+
 func (v *Visitor) handleFuncDecl(n *ast.FuncDecl) *ir.FunctionContract {
 	contract := &ir.FunctionContract{
 		Expectations: make(map[ir.AnnotationKind][]ir.Requirement),
@@ -83,6 +228,26 @@ func (v *Visitor) handleFuncDecl(n *ast.FuncDecl) *ir.FunctionContract {
 
 	// Doc refers to function documentation comments
 	for _, annotation := range v.parseAnnotations(n.Doc) {
+		if annotation.Kind == ir.NoAnalysis {
+			contract.NoAnalysis = true
+			continue
+		}
+		if annotation.Kind.OnData() {
+			v.warn(n.Pos(), "Unexpected annotation @%s on a function — it is only valid on struct fields and variables", annotation.Kind.String())
+			continue
+		}
+		if annotation.Kind.OnType() {
+			v.warn(n.Pos(), "Unexpected annotation @%s on a function — it is only valid on type declarations", annotation.Kind.String())
+			continue
+		}
+		if annotation.Kind == ir.LockMethod || annotation.Kind == ir.UnlockMethod {
+			v.registerLockMethod(contract, annotation, n)
+			continue
+		}
+		if annotation.Kind == ir.ReturnsIf {
+			v.registerConditionalReturn(contract, annotation, n)
+			continue
+		}
 		for _, param := range annotation.Params {
 			req := ir.Requirement{
 				Target: strings.TrimSpace(param),
@@ -94,6 +259,53 @@ func (v *Visitor) handleFuncDecl(n *ast.FuncDecl) *ir.FunctionContract {
 	return contract
 }
 
+// Register a @lock_method or @unlock_method annotation: the method acquires
+// or releases its receiver, exclusively unless the annotation says shared.
+func (v *Visitor) registerLockMethod(contract *ir.FunctionContract, ann Annotation, n *ast.FuncDecl) {
+	if n.Recv == nil || len(n.Recv.List) == 0 {
+		v.warn(n.Pos(), "Ignoring @%s on function %s: only methods can be lock methods, their receiver is the lock", ann.Kind.String(), n.Name.Name)
+		return
+	}
+
+	mode := ir.ExclusiveLockMode
+	if len(ann.Params) > 1 {
+		v.warn(n.Pos(), "Ignoring @%s on %s: expected at most one mode, got %d", ann.Kind.String(), n.Name.Name, len(ann.Params))
+		return
+	}
+	if len(ann.Params) == 1 && ann.Params[0] != "" {
+		mode = strings.TrimSpace(ann.Params[0])
+	}
+	if mode != ir.ExclusiveLockMode && mode != ir.SharedLockMode {
+		v.warn(n.Pos(), "Ignoring @%s on %s: unknown mode %q, expected %s or %s", ann.Kind.String(), n.Name.Name, mode, ir.ExclusiveLockMode, ir.SharedLockMode)
+		return
+	}
+
+	contract.Expectations[ann.Kind] = []ir.Requirement{{Target: mode}}
+}
+
+// Register a @returns_if annotation: the function returns with the locks
+// after its first parameter held exactly when its result is that boolean.
+func (v *Visitor) registerConditionalReturn(contract *ir.FunctionContract, ann Annotation, n *ast.FuncDecl) {
+	if len(ann.Params) < 2 {
+		v.warn(n.Pos(), "Ignoring @%s on %s: expected a result and at least one lock, e.g. @%s(true, mu)", ann.Kind.String(), n.Name.Name, ann.Kind.String())
+		return
+	}
+
+	heldWhen, err := strconv.ParseBool(strings.TrimSpace(ann.Params[0]))
+	if err != nil {
+		v.warn(n.Pos(), "Ignoring @%s on %s: the result must be true or false, got %q", ann.Kind.String(), n.Name.Name, ann.Params[0])
+		return
+	}
+
+	for _, param := range ann.Params[1:] {
+		req := ir.Requirement{
+			Target:   strings.TrimSpace(param),
+			HeldWhen: heldWhen,
+		}
+		contract.Expectations[ann.Kind] = append(contract.Expectations[ann.Kind], req)
+	}
+}
+
 func receiverTypeName(recv *ast.FieldList) string {
 	if recv == nil || len(recv.List) == 0 {
 		return ""
@@ -112,18 +324,43 @@ func (v *Visitor) handleValueSpecs(node *ast.GenDecl, specs []ast.Spec) {
 		}
 
 		annotations := v.parseAnnotations(node.Doc, vSpec.Comment)
-		v.registerDataInvariants(annotations, vSpec.Names, "", node.Pos())
+		v.registerDataInvariants(annotations, vSpec.Names, "", nil, node.Pos())
 	}
 }
 
-// Field specification within a struct
-func (v *Visitor) handleTypeSpecs(specs []ast.Spec) {
+// Register the annotations of a type declaration. Only @lock_type is valid
+// there.
+func (v *Visitor) registerTypeAnnotations(annotations []Annotation, tSpec *ast.TypeSpec) {
+	for _, ann := range annotations {
+		if ann.Kind != ir.LockType {
+			v.warn(tSpec.Pos(), "Unexpected annotation @%s on a type — only @lock_type is valid here", ann.Kind.String())
+			continue
+		}
+
+		name := tSpec.Name.Name
+		v.Registry.LockTypes[name] = tSpec.Pos()
+		if v.PkgPath != "" {
+			v.Registry.LockTypes[ir.MakeQualifiedDataKey(v.PkgPath, name)] = tSpec.Pos()
+		}
+	}
+}
+
+// Type specifications, and the fields of struct types
+func (v *Visitor) handleTypeSpecs(node *ast.GenDecl, specs []ast.Spec) {
 	for _, spec := range specs {
 		tSpec, ok := spec.(*ast.TypeSpec)
 		if !ok {
 			continue
 		}
 
+		// The doc comment of an ungrouped declaration belongs to its
+		// only type.
+		docs := []*ast.CommentGroup{tSpec.Doc, tSpec.Comment}
+		if !node.Lparen.IsValid() {
+			docs = append(docs, node.Doc)
+		}
+		v.registerTypeAnnotations(v.parseAnnotations(docs...), tSpec)
+
 		structType, ok := tSpec.Type.(*ast.StructType)
 		if !ok || structType.Fields == nil {
 			// if error or struct does not contain any fields
@@ -131,20 +368,28 @@ func (v *Visitor) handleTypeSpecs(specs []ast.Spec) {
 			continue
 		}
 
+		fields := make(map[string]bool)
+		for _, field := range structType.Fields.List {
+			for _, name := range field.Names {
+				fields[name.Name] = true
+			}
+		}
+
 		for _, field := range structType.Fields.List {
 			annotations := v.parseAnnotations(field.Doc, field.Comment)
-			v.registerDataInvariants(annotations, field.Names, tSpec.Name.Name, field.Pos())
+			v.registerDataInvariants(annotations, field.Names, tSpec.Name.Name, fields, field.Pos())
 		}
 	}
 }
 
-// Handle variable declarations and struct fields with a "guarded_by" annotation
+// Handle variable declarations and struct fields with a "guarded_by"
+// annotation, and types annotated @lock_type
 func (v *Visitor) handleDataInvariantDecl(n *ast.GenDecl) {
 	switch n.Tok {
 	case token.VAR:
 		v.handleValueSpecs(n, n.Specs)
 	case token.TYPE:
-		v.handleTypeSpecs(n.Specs)
+		v.handleTypeSpecs(n, n.Specs)
 	}
 }
 
@@ -153,14 +398,46 @@ func (v *Visitor) Visit(node ast.Node) ast.Visitor {
 	case *ast.FuncDecl:
 		// Add the function to the registry
 		contract := v.handleFuncDecl(n)
-		key := ir.MakeFunctionKey(n.Name.Name, receiverTypeName(n.Recv))
+		recv := receiverTypeName(n.Recv)
+		key := ir.MakeFunctionKey(n.Name.Name, recv)
 		v.Registry.Functions[key] = contract
 		v.Registry.FunctionsByPos[n.Pos()] = contract
 		if _, exists := v.Registry.Functions[n.Name.Name]; !exists {
 			v.Registry.Functions[n.Name.Name] = contract
 		}
+		if v.PkgPath != "" {
+			v.Registry.QualifiedFunctions[ir.MakeQualifiedFunctionKey(v.PkgPath, n.Name.Name, recv)] = contract
+		}
+	case *ast.File:
+		if v.PkgPath != "" {
+			v.Registry.Packages[v.PkgPath] = true
+		}
+		v.imports = fileImports(n)
+		v.registerSuppressions(n)
 	case *ast.GenDecl:
 		v.handleDataInvariantDecl(n)
 	}
 	return v
 }
+
+// The import paths of file's imports by package name. Packages imported
+// without a name are assumed to be named after the last element of their
+// path.
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != "_" && name != "." {
+			imports[name] = path
+		}
+	}
+	return imports
+}
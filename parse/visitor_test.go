@@ -0,0 +1,383 @@
+package parse
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"gotsan/ir"
+)
+
+const qualifiedKeysSource = `package cache
+
+import "sync"
+
+type Cache struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	items map[string]int
+}
+
+// @requires(c.mu)
+func (c *Cache) Get(key string) int { return c.items[key] }
+
+// @acquires(c.mu)
+func Close(c *Cache) {}
+`
+
+func TestVisitorRegistersPackageQualifiedKeys(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", qualifiedKeysSource, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	ast.Walk(&Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}, file)
+
+	if !registry.HasPackage("example.com/cache") {
+		t.Fatal("expected the package to be recorded")
+	}
+	if c := registry.QualifiedFunctions["example.com/cache.*Cache.Get"]; c == nil || len(c.Expectations[ir.Requires]) != 1 {
+		t.Fatalf("expected the qualified method key, got %+v", registry.QualifiedFunctions)
+	}
+	if c := registry.QualifiedFunctions["example.com/cache.Close"]; c == nil || len(c.Expectations[ir.Acquires]) != 1 {
+		t.Fatalf("expected the qualified function key, got %+v", registry.QualifiedFunctions)
+	}
+	if d := registry.QualifiedData["example.com/cache.Cache.items"]; d == nil || d.MutexName != "mu" {
+		t.Fatalf("expected the qualified data key, got %+v", registry.QualifiedData)
+	}
+}
+
+func TestVisitorWithoutPkgPathOnlyRegistersLooseKeys(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", qualifiedKeysSource, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	ast.Walk(&Visitor{Fset: fset, Registry: registry}, file)
+
+	if len(registry.QualifiedFunctions) != 0 || len(registry.QualifiedData) != 0 || len(registry.Packages) != 0 {
+		t.Fatal("expected no qualified keys without a package path")
+	}
+	if registry.Functions["*Cache.Get"] == nil || registry.Data["Cache.items"] == nil {
+		t.Fatal("expected the loose keys to be registered")
+	}
+}
+
+func TestVisitorCollectsParseWarnings(t *testing.T) {
+	const source = `package cache
+
+// @requires(
+func Get() {}
+
+// @acquires(mu)
+var count int
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	visitor := &Visitor{Fset: fset, Registry: ir.NewContractRegistry()}
+	ast.Walk(visitor, file)
+
+	if len(visitor.Warnings) != 2 {
+		t.Fatalf("expected two parse warnings, got %+v", visitor.Warnings)
+	}
+	if line := fset.Position(visitor.Warnings[0].Pos).Line; line != 3 {
+		t.Fatalf("expected the malformed annotation on line 3, got line %d", line)
+	}
+	if line := fset.Position(visitor.Warnings[1].Pos).Line; line != 7 {
+		t.Fatalf("expected the misplaced annotation at the declaration on line 7, got line %d", line)
+	}
+}
+
+func TestVisitorRegistersSuppressions(t *testing.T) {
+	const source = `package cache
+
+func Get() {
+	work() //gotsan:ignore guard-violation benign race
+	//gotsan:ignore reacquire reentrant by design
+	work()
+}
+
+// Put is never called concurrently.
+//
+//gotsan:ignore all single-threaded
+// @no_analysis
+func Put() {
+	work()
+}
+
+//gotsan:ignore guard-violation
+//gotsan:ignore no-such-rule reason
+//gotsan:ignoreall not a directive
+func work() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	visitor := &Visitor{Fset: fset, Registry: registry}
+	ast.Walk(visitor, file)
+
+	want := []ir.Suppression{
+		{Rule: "guard-violation", Reason: "benign race", StartLine: 4, EndLine: 5},
+		{Rule: "reacquire", Reason: "reentrant by design", StartLine: 5, EndLine: 6},
+		{Rule: "all", Reason: "single-threaded", StartLine: 13, EndLine: 15},
+	}
+	if len(registry.Suppressions) != len(want) {
+		t.Fatalf("expected %d suppressions, got %+v", len(want), registry.Suppressions)
+	}
+	for i, w := range want {
+		got := registry.Suppressions[i]
+		if got.Rule != w.Rule || got.Reason != w.Reason || got.StartLine != w.StartLine || got.EndLine != w.EndLine || got.File != "cache.go" {
+			t.Fatalf("suppression %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	// The directive without a reason and the one with an unknown rule are
+	// reported.
+	if len(visitor.Warnings) != 2 {
+		t.Fatalf("expected two parse warnings, got %+v", visitor.Warnings)
+	}
+	if contract := registry.Functions["Put"]; contract == nil || !contract.NoAnalysis {
+		t.Fatalf("expected Put to be marked @no_analysis, got %+v", contract)
+	}
+}
+
+func TestVisitorRegistersSharedFileSuppressionsOnce(t *testing.T) {
+	const source = `package cache
+
+func Get() {
+	work() //gotsan:ignore guard-violation benign race
+}
+
+func work() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	// A package and its test variant walk the same file.
+	registry := ir.NewContractRegistry()
+	ast.Walk(&Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}, file)
+	ast.Walk(&Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}, file)
+
+	if len(registry.Suppressions) != 1 {
+		t.Fatalf("expected one suppression, got %+v", registry.Suppressions)
+	}
+}
+
+func TestVisitorRegistersLockOrders(t *testing.T) {
+	const source = `package cache
+
+import (
+	"sync"
+
+	store "example.com/storage"
+)
+
+type Cache struct {
+	// @acquired_before(shardMu, Entry.mu)
+	mu      sync.Mutex
+	shardMu sync.Mutex
+}
+
+// @acquired_after(store.Mu)
+var cacheMu sync.Mutex
+
+// @acquired_before(cacheMu)
+func Get() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	visitor := &Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}
+	ast.Walk(visitor, file)
+
+	want := []ir.LockOrder{
+		{Before: "example.com/cache.Cache.mu", After: "example.com/cache.Cache.shardMu"},
+		{Before: "example.com/cache.Cache.mu", After: "example.com/cache.Entry.mu"},
+		{Before: "example.com/storage.Mu", After: "example.com/cache.cacheMu"},
+	}
+	if len(registry.LockOrders) != len(want) {
+		t.Fatalf("expected %d lock orders, got %+v", len(want), registry.LockOrders)
+	}
+	for i, w := range want {
+		got := registry.LockOrders[i]
+		if got.Before != w.Before || got.After != w.After {
+			t.Fatalf("lock order %d: expected %s before %s, got %s before %s", i, w.Before, w.After, got.Before, got.After)
+		}
+	}
+
+	if len(visitor.Warnings) != 1 || fset.Position(visitor.Warnings[0].Pos).Line != 19 {
+		t.Fatalf("expected a warning for the ordering annotation on Get, got %+v", visitor.Warnings)
+	}
+}
+
+func TestVisitorRegistersSharedFileLockOrdersOnce(t *testing.T) {
+	const source = `package cache
+
+import "sync"
+
+// @acquired_before(shardMu)
+var cacheMu sync.Mutex
+var shardMu sync.Mutex
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	// A package and its test variant walk the same file.
+	registry := ir.NewContractRegistry()
+	ast.Walk(&Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}, file)
+	ast.Walk(&Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}, file)
+
+	if len(registry.LockOrders) != 1 {
+		t.Fatalf("expected one lock order, got %+v", registry.LockOrders)
+	}
+}
+
+func TestVisitorRegistersLockTypesAndMethods(t *testing.T) {
+	const source = `package metrics
+
+// @lock_type
+type Mutex struct{}
+
+type (
+	// @lock_type
+	RWMutex struct{}
+
+	// @guarded_by(mu)
+	Table struct{}
+)
+
+// @lock_method
+func (t *Table) Acquire(key string) {}
+
+// @unlock_method(shared)
+func (t *Table) ReleaseShared(key string) {}
+
+// @lock_method(always)
+func (t *Table) Bad() {}
+
+// @lock_method
+func acquire() {}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "metrics.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	visitor := &Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/metrics"}
+	ast.Walk(visitor, file)
+
+	for _, name := range []string{"Mutex", "RWMutex"} {
+		if !registry.IsLockType("example.com/metrics", name) {
+			t.Fatalf("expected %s to be registered as a lock type", name)
+		}
+	}
+	if registry.IsLockType("example.com/metrics", "Table") {
+		t.Fatal("expected Table not to be a lock type")
+	}
+
+	acquire := registry.QualifiedFunctions["example.com/metrics.*Table.Acquire"]
+	if acquire == nil || len(acquire.Expectations[ir.LockMethod]) != 1 || acquire.Expectations[ir.LockMethod][0].Target != ir.ExclusiveLockMode {
+		t.Fatalf("expected Acquire to be an exclusive lock method, got %+v", acquire)
+	}
+	release := registry.QualifiedFunctions["example.com/metrics.*Table.ReleaseShared"]
+	if release == nil || len(release.Expectations[ir.UnlockMethod]) != 1 || release.Expectations[ir.UnlockMethod][0].Target != ir.SharedLockMode {
+		t.Fatalf("expected ReleaseShared to be a shared unlock method, got %+v", release)
+	}
+
+	// @guarded_by on a type, the unknown mode and the lock method without a
+	// receiver are reported.
+	if len(visitor.Warnings) != 3 {
+		t.Fatalf("expected three parse warnings, got %+v", visitor.Warnings)
+	}
+}
+
+func TestDeclaredLockOrderFollowsChainsAndFindsCycles(t *testing.T) {
+	registry := ir.NewContractRegistry()
+	registry.LockOrders = []ir.LockOrder{
+		{Before: "a", After: "b"},
+		{Before: "b", After: "c"},
+		{Before: "x", After: "y"},
+		{Before: "y", After: "x"},
+	}
+
+	if chain := registry.DeclaredLockOrder("a", "c"); len(chain) != 2 {
+		t.Fatalf("expected a two-step chain from a to c, got %+v", chain)
+	}
+	if chain := registry.DeclaredLockOrder("c", "a"); chain != nil {
+		t.Fatalf("expected no declared order from c to a, got %+v", chain)
+	}
+
+	cycles := registry.LockOrderCycles()
+	if len(cycles) != 1 || len(cycles[0]) != 2 || cycles[0][0].Before != "x" {
+		t.Fatalf("expected the x-y cycle once, got %+v", cycles)
+	}
+}
+
+func TestVisitorRegistersConditionalReturns(t *testing.T) {
+	const source = `package cache
+
+// @returns_if(false, c.mu, c.stats)
+func (c *Cache) tryAcquire() bool { return false }
+
+// @returns_if(c.mu)
+func (c *Cache) missingResult() bool { return false }
+
+// @returns_if(maybe, c.mu)
+func (c *Cache) badResult() bool { return false }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "cache.go", source, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	registry := ir.NewContractRegistry()
+	visitor := &Visitor{Fset: fset, Registry: registry, PkgPath: "example.com/cache"}
+	ast.Walk(visitor, file)
+
+	contract := registry.QualifiedFunctions["example.com/cache.*Cache.tryAcquire"]
+	if contract == nil {
+		t.Fatal("expected tryAcquire to be registered")
+	}
+	want := []ir.Requirement{{Target: "c.mu", HeldWhen: false}, {Target: "c.stats", HeldWhen: false}}
+	if got := contract.Expectations[ir.ReturnsIf]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	// The annotation without a result and the one with an unknown result
+	// are reported and ignored.
+	if len(visitor.Warnings) != 2 {
+		t.Fatalf("expected two parse warnings, got %+v", visitor.Warnings)
+	}
+	for _, name := range []string{"missingResult", "badResult"} {
+		if c := registry.QualifiedFunctions["example.com/cache.*Cache."+name]; c == nil || len(c.Expectations[ir.ReturnsIf]) != 0 {
+			t.Fatalf("expected %s to have no @returns_if contract, got %+v", name, c)
+		}
+	}
+}
@@ -11,19 +11,45 @@ import (
 	"golang.org/x/tools/go/ssa"
 )
 
-func PopulateRegistryFromFiles(registry *ir.ContractRegistry, files []*ast.File, fset *token.FileSet) {
+// PopulateRegistryFromFiles registers the contracts declared in files, which
+// make up the package with import path pkgPath, and returns the parse
+// warnings for malformed annotations. Contracts of a package registered
+// without a path are only found by name.
+func PopulateRegistryFromFiles(registry *ir.ContractRegistry, pkgPath string, files []*ast.File, fset *token.FileSet) []parse.Warning {
 	if registry == nil || fset == nil {
-		return
+		return nil
 	}
 
 	visitor := &parse.Visitor{
 		Fset:     fset,
 		Registry: registry,
+		PkgPath:  pkgPath,
 	}
 
 	for _, file := range files {
 		ast.Walk(visitor, file)
 	}
+	return visitor.Warnings
+}
+
+// RegisterSuppressions hands the //gotsan:ignore directives found while
+// populating registry to reporter. Call it before analyzing.
+func RegisterSuppressions(registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet) {
+	if registry == nil || reporter == nil || fset == nil {
+		return
+	}
+
+	for _, s := range registry.Suppressions {
+		reporter.AddSuppression(report.Suppression{
+			Rule:      s.Rule,
+			Reason:    s.Reason,
+			Pos:       s.Pos,
+			File:      s.File,
+			Line:      fset.Position(s.Pos).Line,
+			StartLine: s.StartLine,
+			EndLine:   s.EndLine,
+		})
+	}
 }
 
 func AnalyzeSSAPackage(ssaPkg *ssa.Package, registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet, strictMode bool) {
@@ -33,3 +59,9 @@ func AnalyzeSSAPackage(ssaPkg *ssa.Package, registry *ir.ContractRegistry, repor
 
 	analyzer.Run(ssaPkg, registry, reporter, fset, strictMode)
 }
+
+// AnalyzeSSAProgram analyzes packages built from one SSA program together,
+// relating calls, goroutines and lock orders across package boundaries.
+func AnalyzeSSAProgram(ssaPkgs []*ssa.Package, registry *ir.ContractRegistry, reporter *report.Reporter, fset *token.FileSet, strictMode bool) {
+	analyzer.RunProgram(ssaPkgs, registry, reporter, fset, strictMode)
+}
@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"go/ast"
+	"go/types"
+	"gotsan/ir"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Under go vet and gopls every package is analyzed in its own pass, so the
+// contracts a package declares are exported as facts on the annotated
+// objects and imported into the registry of each dependent package's pass.
+
+// contractFact is the contract of an annotated function or method.
+type contractFact struct {
+	Expectations map[ir.AnnotationKind][]ir.Requirement
+}
+
+func (*contractFact) AFact() {}
+
+func (f *contractFact) String() string {
+	kinds := make([]ir.AnnotationKind, 0, len(f.Expectations))
+	for kind := range f.Expectations {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		if kind == ir.ReturnsIf {
+			for _, req := range f.Expectations[kind] {
+				parts = append(parts, "@"+kind.String()+"("+strconv.FormatBool(req.HeldWhen)+", "+req.Target+")")
+			}
+			continue
+		}
+		targets := make([]string, 0, len(f.Expectations[kind]))
+		for _, req := range f.Expectations[kind] {
+			targets = append(targets, req.Target)
+		}
+		parts = append(parts, "@"+kind.String()+"("+strings.Join(targets, ", ")+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// guardFact is the @guarded_by invariant of a struct field or package-level
+// variable. Key is its data key within the package ("Type.field" or "var").
+type guardFact struct {
+	Key       string
+	MutexName string
+}
+
+func (*guardFact) AFact() {}
+
+func (f *guardFact) String() string {
+	return "@guarded_by(" + f.MutexName + ")"
+}
+
+// lockOrderFact holds the declared orders (see ir.LockOrder) a package
+// declares between a lock and others, on the lock acquired first or, when
+// that one belongs to another package, on the one acquired after it. Locks
+// are named by qualified data key.
+type lockOrderFact struct {
+	Orders []lockOrderPair
+}
+
+type lockOrderPair struct {
+	Before string
+	After  string
+}
+
+func (*lockOrderFact) AFact() {}
+
+func (f *lockOrderFact) String() string {
+	parts := make([]string, 0, len(f.Orders))
+	for _, order := range f.Orders {
+		parts = append(parts, order.Before+" before "+order.After)
+	}
+	return "lock order(" + strings.Join(parts, ", ") + ")"
+}
+
+// lockTypeFact marks a type annotated @lock_type.
+type lockTypeFact struct{}
+
+func (*lockTypeFact) AFact() {}
+
+func (f *lockTypeFact) String() string {
+	return "@lock_type"
+}
+
+// registeredFact marks a package whose contracts were registered, so its
+// functions and data are looked up by qualified key only in dependents.
+type registeredFact struct {
+	Annotated int
+}
+
+func (*registeredFact) AFact() {}
+
+func (f *registeredFact) String() string {
+	return "gotsan contracts registered"
+}
+
+// Export the contracts, guards, lock orders and lock types registry holds for
+// the package of pass.
+func exportContractFacts(pass *analysis.Pass, registry *ir.ContractRegistry) {
+	pkgPath := pass.Pkg.Path()
+	annotated := 0
+
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			obj, ok := pass.TypesInfo.Defs[funcDecl.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+
+			contract := registry.QualifiedFunctions[ir.QualifiedFunctionKeyForObject(obj)]
+			if contract == nil || len(contract.Expectations) == 0 {
+				continue
+			}
+			pass.ExportObjectFact(obj, &contractFact{Expectations: contract.Expectations})
+			annotated++
+		}
+	}
+
+	// Fields and package-level variables, by qualified data key.
+	dataObjects := make(map[string]types.Object)
+	exportData := func(obj types.Object, key string) {
+		dataObjects[ir.MakeQualifiedDataKey(pkgPath, key)] = obj
+		invariant := registry.QualifiedData[ir.MakeQualifiedDataKey(pkgPath, key)]
+		if invariant == nil {
+			return
+		}
+		pass.ExportObjectFact(obj, &guardFact{Key: key, MutexName: invariant.MutexName})
+		annotated++
+	}
+
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Var:
+			exportData(obj, name)
+		case *types.TypeName:
+			if _, ok := registry.LockTypes[ir.MakeQualifiedDataKey(pkgPath, name)]; ok {
+				pass.ExportObjectFact(obj, &lockTypeFact{})
+				annotated++
+			}
+			structType, ok := obj.Type().Underlying().(*types.Struct)
+			if !ok || obj.IsAlias() {
+				continue
+			}
+			for i := 0; i < structType.NumFields(); i++ {
+				field := structType.Field(i)
+				exportData(field, name+"."+field.Name())
+			}
+		}
+	}
+
+	orders := make(map[types.Object]*lockOrderFact)
+	for _, order := range registry.LockOrders {
+		if order.Imported {
+			continue
+		}
+		obj := dataObjects[order.Before]
+		if obj == nil {
+			obj = dataObjects[order.After]
+		}
+		if obj == nil {
+			continue
+		}
+		if orders[obj] == nil {
+			orders[obj] = &lockOrderFact{}
+		}
+		orders[obj].Orders = append(orders[obj].Orders, lockOrderPair{Before: order.Before, After: order.After})
+	}
+	for obj, fact := range orders {
+		pass.ExportObjectFact(obj, fact)
+		annotated++
+	}
+
+	pass.ExportPackageFact(&registeredFact{Annotated: annotated})
+}
+
+// Register the contracts, guards, lock orders and lock types exported by the
+// dependencies of pass.
+func importContractFacts(pass *analysis.Pass, registry *ir.ContractRegistry) {
+	for _, fact := range pass.AllPackageFacts() {
+		if _, ok := fact.Fact.(*registeredFact); ok {
+			registry.Packages[fact.Package.Path()] = true
+		}
+	}
+
+	for _, fact := range pass.AllObjectFacts() {
+		obj := fact.Object
+		if obj.Pkg() == nil || obj.Pkg() == pass.Pkg {
+			continue
+		}
+
+		switch f := fact.Fact.(type) {
+		case *contractFact:
+			fn, ok := obj.(*types.Func)
+			if !ok {
+				continue
+			}
+			registry.QualifiedFunctions[ir.QualifiedFunctionKeyForObject(fn)] = &ir.FunctionContract{
+				Expectations: f.Expectations,
+				Pos:          fn.Pos(),
+			}
+		case *lockTypeFact:
+			registry.LockTypes[ir.MakeQualifiedDataKey(obj.Pkg().Path(), obj.Name())] = obj.Pos()
+		case *guardFact:
+			registry.QualifiedData[ir.MakeQualifiedDataKey(obj.Pkg().Path(), f.Key)] = &ir.DataInvariant{
+				MutexName: f.MutexName,
+				Pos:       obj.Pos(),
+			}
+		case *lockOrderFact:
+			for _, order := range f.Orders {
+				registry.LockOrders = append(registry.LockOrders, ir.LockOrder{
+					Before:   order.Before,
+					After:    order.After,
+					Pos:      obj.Pos(),
+					Imported: true,
+				})
+			}
+		}
+	}
+}
@@ -2,9 +2,13 @@ package pipeline
 
 import (
 	"flag"
+	"fmt"
+	"go/build"
 	"go/token"
 	"gotsan/ir"
 	"gotsan/utils/report"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/buildssa"
@@ -16,12 +20,16 @@ var GoAnalysisAnalyzer = &analysis.Analyzer{
 	Requires: []*analysis.Analyzer{buildssa.Analyzer},
 	Run:      runGoAnalysis,
 	Flags:    flag.FlagSet{},
+	// Contracts cross package boundaries as facts; see facts.go.
+	FactTypes: []analysis.Fact{new(contractFact), new(guardFact), new(lockTypeFact), new(registeredFact)},
 }
 
 func init() {
 	GoAnalysisAnalyzer.Flags.Init("gotsan", flag.ExitOnError)
 	GoAnalysisAnalyzer.Flags.Bool("l", false, "lenient mode: only detect deadlocks involving goroutines")
 	GoAnalysisAnalyzer.Flags.Bool("s", false, "strict mode: detect deadlocks in single-threaded code as well")
+	GoAnalysisAnalyzer.Flags.Bool("explain", false, "attach the path that led to each finding as related information")
+	GoAnalysisAnalyzer.Flags.String("blocking", "", "comma-separated functions that block, added to the built-in list")
 }
 
 func runGoAnalysis(pass *analysis.Pass) (any, error) {
@@ -56,7 +64,18 @@ func runGoAnalysis(pass *analysis.Pass) (any, error) {
 	}
 
 	registry := ir.NewContractRegistry()
-	PopulateRegistryFromFiles(registry, pass.Files, pass.Fset)
+	if blockingFlag := pass.Analyzer.Flags.Lookup("blocking"); blockingFlag != nil {
+		registry.AddBlockingFunctions(strings.Split(blockingFlag.Value.String(), ",")...)
+	}
+	PopulateRegistryFromFiles(registry, pass.Pkg.Path(), pass.Files, pass.Fset)
+	importContractFacts(pass, registry)
+	exportContractFacts(pass, registry)
+
+	// The standard library is a dependency of every package, analyzed only
+	// for its facts; its diagnostics are never shown.
+	if isStandardLibrary(pass) {
+		return nil, nil
+	}
 
 	ssaResult := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
 	if ssaResult == nil || ssaResult.Pkg == nil {
@@ -64,18 +83,47 @@ func runGoAnalysis(pass *analysis.Pass) (any, error) {
 	}
 
 	reporter := report.NewReporter()
+	if explainFlag := pass.Analyzer.Flags.Lookup("explain"); explainFlag != nil {
+		if bv, ok := explainFlag.Value.(flag.Getter); ok {
+			reporter.Explain, _ = bv.Get().(bool)
+		}
+	}
+	RegisterSuppressions(registry, reporter, pass.Fset)
 	AnalyzeSSAPackage(ssaResult.Pkg, registry, reporter, pass.Fset, strict)
 
 	for _, d := range reporter.Findings {
 		if d.Pos == 0 {
 			continue
 		}
+		related := make([]analysis.RelatedInformation, 0, len(d.Related))
+		for _, rel := range d.Related {
+			related = append(related, analysis.RelatedInformation{Pos: rel.Pos, Message: rel.Message})
+		}
 		pass.Report(analysis.Diagnostic{
 			Pos:      d.Pos,
 			Message:  d.Message,
-			Category: "analysis",
+			Category: d.Rule,
+			Related:  related,
+		})
+	}
+
+	for _, s := range reporter.UnusedSuppressions() {
+		pass.Report(analysis.Diagnostic{
+			Pos:      s.Pos,
+			Message:  fmt.Sprintf("//gotsan:ignore %s matches no diagnostic", s.Rule),
+			Category: "unused-suppression",
 		})
 	}
 
 	return nil, nil
 }
+
+func isStandardLibrary(pass *analysis.Pass) bool {
+	if len(pass.Files) == 0 || build.Default.GOROOT == "" {
+		return false
+	}
+
+	goroot := filepath.Clean(build.Default.GOROOT) + string(filepath.Separator)
+	file := pass.Fset.File(pass.Files[0].Pos())
+	return file != nil && strings.HasPrefix(filepath.Clean(file.Name()), goroot)
+}
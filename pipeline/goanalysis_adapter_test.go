@@ -0,0 +1,13 @@
+package pipeline
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// api is analyzed in its own pass, as under go vet; the contracts of store
+// only reach it as facts.
+func TestGoAnalysisAnalyzer_ImportsContractsAcrossPackages(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), GoAnalysisAnalyzer, "store", "api")
+}
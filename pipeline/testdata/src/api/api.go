@@ -0,0 +1,43 @@
+package api // want package:`gotsan contracts registered`
+
+import "store"
+
+func Save(s *store.Store) {
+	s.Mu.Lock()
+	s.Put(1)
+	s.Mu.Unlock()
+}
+
+func SaveUnlocked(s *store.Store) {
+	s.Put(1) // want `Call to Put requires lock s.Mu, but it's not held`
+}
+
+func Count(s *store.Store) int {
+	return s.Rows // want `Access to Store.Rows requires lock Mu, but it's not held`
+}
+
+func Reindex() {
+	store.IndexMu.Lock()
+	store.Index++
+	store.IndexMu.Unlock()
+}
+
+func ReindexUnlocked() {
+	store.Index++ // want `Access to Index requires lock IndexMu, but it's not held`
+}
+
+func ReindexLogged() {
+	store.LogMu.Lock()
+	store.IndexMu.Lock()
+	store.Index++
+	store.IndexMu.Unlock()
+	store.LogMu.Unlock()
+}
+
+func LogReindexed() {
+	store.IndexMu.Lock()
+	store.LogMu.Lock() // want `Function LogReindexed acquires lock LogMu while holding IndexMu, but LogMu is declared to be acquired before IndexMu`
+	store.Index++
+	store.LogMu.Unlock()
+	store.IndexMu.Unlock()
+}
@@ -0,0 +1,22 @@
+package store // want package:`gotsan contracts registered`
+
+import "sync"
+
+type Store struct {
+	Mu sync.Mutex
+	// @guarded_by(Mu)
+	Rows int // want Rows:`@guarded_by\(Mu\)`
+}
+
+// @requires(s.Mu)
+func (s *Store) Put(n int) { // want Put:`@requires\(s.Mu\)`
+	s.Rows = n
+} // want `Function Put returns lock\(s\) Mu`
+
+var IndexMu sync.Mutex
+
+// @guarded_by(IndexMu)
+var Index int // want Index:`@guarded_by\(IndexMu\)`
+
+// @acquired_before(IndexMu)
+var LogMu sync.Mutex // want LogMu:`lock order\(store.LogMu before store.IndexMu\)`
@@ -100,13 +100,14 @@ func analyzeFile(t *testing.T, absPath string, strict bool) []string {
 
 	registry := ir.NewContractRegistry()
 	for _, pkg := range pkgs {
-		pipeline.PopulateRegistryFromFiles(registry, pkg.Syntax, fset)
+		pipeline.PopulateRegistryFromFiles(registry, pkg.PkgPath, pkg.Syntax, fset)
 	}
 
 	prog, ssaPkgs := ssautil.Packages(pkgs, ssa.BuilderMode(0))
 	prog.Build()
 
 	reporter := report.NewReporter()
+	pipeline.RegisterSuppressions(registry, reporter, fset)
 	for _, ssaPkg := range ssaPkgs {
 		if ssaPkg == nil {
 			continue
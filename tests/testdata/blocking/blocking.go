@@ -0,0 +1,77 @@
+package blocking
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	mu sync.Mutex
+	// @guarded_by(mu)
+	count int
+
+	ready = make(chan struct{})
+	quit  = make(chan struct{})
+)
+
+func flush() {}
+
+func Sleeps() {
+	mu.Lock()
+	defer mu.Unlock()
+	time.Sleep(time.Millisecond)
+	count++
+}
+
+func SleepsUnlocked() {
+	time.Sleep(time.Millisecond)
+}
+
+func Waits(wg *sync.WaitGroup) {
+	mu.Lock()
+	defer mu.Unlock()
+	wg.Wait()
+	count++
+}
+
+func Dials(addr string) (net.Conn, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	count++
+	return net.Dial("tcp", addr)
+}
+
+func Reads(conn net.Conn, buf []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	n, _ := conn.Read(buf)
+	count += n
+}
+
+func Selects() {
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case <-ready:
+		count++
+	case <-quit:
+	}
+}
+
+func SelectsWithDefault() {
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case <-ready:
+		count++
+	default:
+	}
+}
+
+func Flushes() {
+	mu.Lock()
+	defer mu.Unlock()
+	count++
+	flush()
+}
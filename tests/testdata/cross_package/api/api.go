@@ -0,0 +1,26 @@
+package api
+
+import "gotsan/tests/testdata/cross_package/store"
+
+// Takes the index lock, then the data lock: the reverse of store.Reindex.
+//
+// @acquires(store.IndexMu, store.DataMu)
+func Lookup() int {
+	store.IndexMu.Lock()
+	store.DataMu.Lock()
+	n := store.Rows
+	store.DataMu.Unlock()
+	store.IndexMu.Unlock()
+	return n
+}
+
+// Reads the guarded counter without its lock.
+func Count() int {
+	return store.Rows
+}
+
+// Runs concurrently with the reindexer started by store.StartReindexer.
+func Serve() {
+	store.StartReindexer()
+	go Lookup()
+}
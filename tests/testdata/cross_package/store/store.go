@@ -0,0 +1,25 @@
+package store
+
+import "sync"
+
+var (
+	IndexMu sync.Mutex
+	DataMu  sync.Mutex
+)
+
+// @guarded_by(DataMu)
+var Rows int
+
+// Takes the data lock, then the index lock.
+//
+// @acquires(DataMu, IndexMu)
+func Reindex() {
+	DataMu.Lock()
+	IndexMu.Lock()
+	IndexMu.Unlock()
+	DataMu.Unlock()
+}
+
+func StartReindexer() {
+	go Reindex()
+}
@@ -0,0 +1,20 @@
+package alpha
+
+import "sync"
+
+type Cache struct {
+	mu sync.Mutex
+	// @guarded_by(mu)
+	items map[string]int
+}
+
+// @requires(c.mu)
+func (c *Cache) Get(key string) int {
+	return c.items[key]
+}
+
+func (c *Cache) Lookup(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Get(key)
+}
@@ -0,0 +1,14 @@
+package beta
+
+// A Cache owned by a single goroutine; it has no lock and needs none.
+type Cache struct {
+	items map[string]int
+}
+
+func (c *Cache) Get(key string) int {
+	return c.items[key]
+}
+
+func Lookup(c *Cache, key string) int {
+	return c.Get(key)
+}
@@ -0,0 +1,69 @@
+package rwr
+
+import "sync"
+
+type Table struct {
+	mu sync.RWMutex
+	// @guarded_by(mu)
+	rows map[string]int
+}
+
+// @acquires(t.mu)
+func (t *Table) Get(key string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if row, ok := t.rows[key]; ok {
+		return row
+	}
+	return t.Len()
+}
+
+// @acquires(t.mu)
+func (t *Table) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.rows)
+}
+
+// @acquires(t.mu)
+func (t *Table) Put(key string, row int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows[key] = row
+}
+
+// Get read-locks t.mu again while Put may be waiting for it.
+func ReadWhileWriting(t *Table) {
+	go t.Get("a")
+	go t.Put("b", 1)
+}
+
+// Index is only ever read-locked.
+type Index struct {
+	keysMu sync.RWMutex
+	// @guarded_by(keysMu)
+	keys []string
+}
+
+// @acquires(i.keysMu)
+func (i *Index) Keys() []string {
+	i.keysMu.RLock()
+	defer i.keysMu.RUnlock()
+	if i.Len() == 0 {
+		return nil
+	}
+	return i.keys
+}
+
+// @acquires(i.keysMu)
+func (i *Index) Len() int {
+	i.keysMu.RLock()
+	defer i.keysMu.RUnlock()
+	return len(i.keys)
+}
+
+// Nested read locks are fine without a writer.
+func ReadOnly(i *Index) {
+	go i.Keys()
+	go i.Keys()
+}
@@ -0,0 +1,73 @@
+package synccond
+
+import "sync"
+
+type Queue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// @guarded_by(mu)
+	items []int
+}
+
+func NewQueue() *Queue {
+	q := &Queue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *Queue) Pop() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item
+}
+
+func (q *Queue) PopOnce() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		q.cond.Wait()
+	}
+	return len(q.items)
+}
+
+func (q *Queue) Push(item int) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+func (q *Queue) PushLocked(item int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, item)
+	q.cond.Broadcast()
+}
+
+func (q *Queue) Notify() {
+	q.cond.Signal()
+}
+
+var (
+	readyMu sync.Mutex
+	ready   = sync.NewCond(&readyMu)
+	started bool
+)
+
+func Start() {
+	started = true
+	ready.Broadcast()
+}
+
+func AwaitStart() {
+	readyMu.Lock()
+	for !started {
+		ready.Wait()
+	}
+	readyMu.Unlock()
+}
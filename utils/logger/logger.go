@@ -1,6 +1,10 @@
 package logger
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
 
 type Level int
 
@@ -13,6 +17,19 @@ const (
 
 var currentLevel = Info
 
+var output io.Writer = os.Stdout
+
+// SetOutput redirects log output, e.g. to stderr when stdout carries a
+// machine-readable report.
+func SetOutput(w io.Writer) {
+	output = w
+}
+
+// Writer returns the writer log output goes to.
+func Writer() io.Writer {
+	return output
+}
+
 func SetLevel(l Level) {
 	currentLevel = l
 }
@@ -23,18 +40,18 @@ func IsVerbose() bool {
 
 func Debugf(format string, args ...any) {
 	if currentLevel <= Debug {
-		fmt.Printf("[DEBUG] "+format+"\n", args...)
+		fmt.Fprintf(output, "[DEBUG] "+format+"\n", args...)
 	}
 }
 
 func Infof(format string, args ...any) {
 	if currentLevel <= Info {
-		fmt.Printf(format+"\n", args...)
+		fmt.Fprintf(output, format+"\n", args...)
 	}
 }
 
 func Warnf(format string, args ...any) {
 	if currentLevel <= Warn {
-		fmt.Printf("[WARNING] "+format+"\n", args...)
+		fmt.Fprintf(output, "[WARNING] "+format+"\n", args...)
 	}
 }
@@ -0,0 +1,177 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Baselines record the diagnostics of a run so that later runs only report
+// new ones. Diagnostics are matched by fingerprint rather than by
+// diagnosticKey: the fingerprint leaves out line and column numbers, so
+// known diagnostics stay matched when code above them moves.
+
+const baselineVersion = 1
+
+// Baseline is the content of a baseline file.
+type Baseline struct {
+	Version int             `json:"version"`
+	Entries []BaselineEntry `json:"entries"`
+}
+
+// BaselineEntry stands for Count diagnostics with the same fingerprint. Rule,
+// File and Message are informational, for reviewing the file.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Rule        string `json:"rule"`
+	File        string `json:"file"`
+	Message     string `json:"message"`
+	Count       int    `json:"count"`
+}
+
+var (
+	// Positions and SSA registers in messages shift with unrelated edits.
+	positionPattern = regexp.MustCompile(`(line |:)\d+(:\d+)?`)
+	registerPattern = regexp.MustCompile(`\bt\d+\b`)
+)
+
+func normalizeMessage(message string) string {
+	message = positionPattern.ReplaceAllString(message, "${1}#")
+	message = registerPattern.ReplaceAllString(message, "t#")
+	return strings.Join(strings.Fields(message), " ")
+}
+
+// Path of file relative to root, when file is under root.
+func relativeToRoot(file string, root string) (string, bool) {
+	if root == "" || !filepath.IsAbs(file) {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// Path of file as recorded in baselines: relative to root where possible,
+// so a baseline applies to checkouts in other directories.
+func baselinePath(file string, root string) string {
+	if rel, ok := relativeToRoot(file, root); ok {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(file)
+}
+
+// Fingerprint identifies d across runs: its rule, file, enclosing function,
+// the functions and locks involved and its message with positions
+// normalized away.
+func Fingerprint(d Diagnostic, root string) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		d.Rule,
+		baselinePath(d.File, root),
+		d.Function,
+		strings.Join(d.Functions, ","),
+		strings.Join(d.Locks, ","),
+		normalizeMessage(d.Message),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// Baseline records the findings and advisory warnings of the run, with
+// paths relative to root.
+func (r *Reporter) Baseline(root string) Baseline {
+	sortDiagnostics(r.Findings)
+	sortDiagnostics(r.Warnings)
+
+	baseline := Baseline{Version: baselineVersion, Entries: make([]BaselineEntry, 0)}
+	index := make(map[string]int)
+	for _, diags := range [][]Diagnostic{r.Findings, r.Warnings} {
+		for _, d := range diags {
+			fingerprint := Fingerprint(d, root)
+			if i, ok := index[fingerprint]; ok {
+				baseline.Entries[i].Count++
+				continue
+			}
+			index[fingerprint] = len(baseline.Entries)
+			baseline.Entries = append(baseline.Entries, BaselineEntry{
+				Fingerprint: fingerprint,
+				Rule:        d.Rule,
+				File:        baselinePath(d.File, root),
+				Message:     d.Message,
+				Count:       1,
+			})
+		}
+	}
+
+	sort.SliceStable(baseline.Entries, func(i, j int) bool {
+		a, b := baseline.Entries[i], baseline.Entries[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	return baseline
+}
+
+// WriteBaseline writes b as JSON.
+func WriteBaseline(w io.Writer, b Baseline) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// ReadBaseline reads a baseline written by WriteBaseline.
+func ReadBaseline(rd io.Reader) (Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(rd).Decode(&b); err != nil {
+		return Baseline{}, fmt.Errorf("invalid baseline: %w", err)
+	}
+	if b.Version != baselineVersion {
+		return Baseline{}, fmt.Errorf("unsupported baseline version %d, expected %d", b.Version, baselineVersion)
+	}
+	return b, nil
+}
+
+// ApplyBaseline drops the findings and advisory warnings recorded in b,
+// moving them to Baselined. Each entry drops at most Count diagnostics, so
+// new occurrences of a known diagnostic are still reported. It returns the
+// number of recorded diagnostics that no longer occur.
+func (r *Reporter) ApplyBaseline(b Baseline, root string) int {
+	remaining := make(map[string]int, len(b.Entries))
+	for _, entry := range b.Entries {
+		remaining[entry.Fingerprint] += entry.Count
+	}
+
+	filter := func(diags []Diagnostic) []Diagnostic {
+		sortDiagnostics(diags)
+		kept := diags[:0]
+		for _, d := range diags {
+			fingerprint := Fingerprint(d, root)
+			if remaining[fingerprint] > 0 {
+				remaining[fingerprint]--
+				r.Baselined = append(r.Baselined, d)
+				continue
+			}
+			kept = append(kept, d)
+		}
+		return kept
+	}
+	r.Findings = filter(r.Findings)
+	r.Warnings = filter(r.Warnings)
+
+	stale := 0
+	for _, count := range remaining {
+		stale += count
+	}
+	return stale
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func guardViolationAt(line int, function string) Diagnostic {
+	return Diagnostic{
+		File:     "/src/app/f.go",
+		Line:     line,
+		Column:   2,
+		Rule:     RuleGuardViolation,
+		Function: function,
+		Locks:    []string{"mu"},
+		Message:  "Access to Stats.hits requires lock mu, but it's not held",
+	}
+}
+
+func TestFingerprintSurvivesLineShifts(t *testing.T) {
+	a := guardViolationAt(10, "(*Stats).Hit")
+	b := guardViolationAt(14, "(*Stats).Hit")
+	if Fingerprint(a, "/src/app") != Fingerprint(b, "/src/app") {
+		t.Fatal("expected the fingerprint to ignore the line")
+	}
+	if Fingerprint(a, "/src/app") != Fingerprint(Diagnostic{
+		File: "/checkout/f.go", Line: 3, Rule: a.Rule, Function: a.Function, Locks: a.Locks, Message: a.Message,
+	}, "/checkout") {
+		t.Fatal("expected the fingerprint to ignore the checkout directory")
+	}
+	if Fingerprint(a, "/src/app") == Fingerprint(guardViolationAt(10, "(*Stats).Reset"), "/src/app") {
+		t.Fatal("expected the enclosing function to be part of the fingerprint")
+	}
+
+	leak := Diagnostic{Rule: RuleLockLeak, Message: "the path from here reaches the return near line 12 without releasing it"}
+	shifted := leak
+	shifted.Message = strings.Replace(leak.Message, "line 12", "line 19", 1)
+	if Fingerprint(leak, "") != Fingerprint(shifted, "") {
+		t.Fatal("expected line numbers in the message to be normalized")
+	}
+}
+
+func TestApplyBaseline(t *testing.T) {
+	old := NewReporter()
+	old.Warn(guardViolationAt(10, "(*Stats).Hit"))
+	old.Warn(guardViolationAt(20, "(*Stats).Reset"))
+
+	var buf bytes.Buffer
+	if err := WriteBaseline(&buf, old.Baseline("/src/app")); err != nil {
+		t.Fatalf("WriteBaseline failed: %v", err)
+	}
+	baseline, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatalf("ReadBaseline failed: %v", err)
+	}
+	if len(baseline.Entries) != 2 || baseline.Entries[0].File != "f.go" {
+		t.Fatalf("unexpected baseline: %+v", baseline)
+	}
+
+	// The code moved down by three lines, Reset was fixed and Hit gained a
+	// second violation.
+	current := NewReporter()
+	current.Warn(guardViolationAt(13, "(*Stats).Hit"))
+	current.Warn(guardViolationAt(14, "(*Stats).Hit"))
+
+	stale := current.ApplyBaseline(baseline, "/src/app")
+	if stale != 1 {
+		t.Fatalf("expected the fixed Reset violation to be stale, got %d", stale)
+	}
+	if len(current.Baselined) != 1 || len(current.Findings) != 1 || current.Findings[0].Line != 14 {
+		t.Fatalf("expected only the new violation to be reported, got %+v", current.Findings)
+	}
+}
+
+func TestReadBaselineRejectsOtherVersions(t *testing.T) {
+	if _, err := ReadBaseline(strings.NewReader(`{"version": 99, "entries": []}`)); err == nil {
+		t.Fatal("expected an error for an unknown baseline version")
+	}
+}
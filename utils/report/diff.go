@@ -0,0 +1,162 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diff-aware reporting: the analysis runs over whole packages, so lock state
+// flowing in from unchanged code stays correct, and only the diagnostics
+// touching the hunks of a unified diff are kept.
+
+// LineRange is an inclusive range of lines.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ChangedLines maps cleaned absolute file paths to the line ranges of the
+// new side of their diff hunks.
+type ChangedLines map[string][]LineRange
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Count of a hunk header range; omitted counts are 1.
+func hunkCount(value string) int {
+	if value == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// Path of the new side of a file in a "+++" line, without git's "b/"
+// prefix or a trailing timestamp. Empty for deleted files.
+func diffTargetPath(header string) string {
+	path := strings.TrimPrefix(header, "+++ ")
+	if tab := strings.IndexByte(path, '\t'); tab != -1 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(path, "b/")
+}
+
+func diffFileKey(path string, root string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	return filepath.Clean(path)
+}
+
+// ParseUnifiedDiff reads the hunks of a unified diff. Relative paths in the
+// diff are resolved against root.
+func ParseUnifiedDiff(rd io.Reader, root string) (ChangedLines, error) {
+	changes := make(ChangedLines)
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	file := ""
+	// Lines of the current hunk left to skip on each side.
+	oldLeft, newLeft := 0, 0
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = diffTargetPath(line)
+		case strings.HasPrefix(line, "@@ "):
+			match := hunkHeaderPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			oldLeft = hunkCount(match[1])
+			start, _ := strconv.Atoi(match[2])
+			newLeft = hunkCount(match[3])
+			if file == "" {
+				continue
+			}
+
+			// A hunk that only deletes lines touches the line after the
+			// deletion.
+			end := start + newLeft - 1
+			if newLeft == 0 {
+				start, end = start+1, start+1
+			}
+			key := diffFileKey(file, root)
+			changes[key] = append(changes[key], LineRange{Start: start, End: end})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Contains reports whether line of file falls in a changed hunk. Relative
+// paths are resolved against root.
+func (c ChangedLines) Contains(file string, line int, root string) bool {
+	for _, r := range c[diffFileKey(file, root)] {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ChangedLines) touches(d Diagnostic, root string) bool {
+	if c.Contains(d.File, d.Line, root) {
+		return true
+	}
+	for _, rel := range d.Related {
+		if !rel.Trace && c.Contains(rel.File, rel.Line, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepChanged drops the findings and advisory warnings whose primary and
+// related positions all lie outside changes, moving them to OutsideDiff.
+// Witness trace steps are not sites of a finding and are not considered.
+// Unused suppressions outside changes are no longer listed either.
+func (r *Reporter) KeepChanged(changes ChangedLines, root string) {
+	r.changes = changes
+	r.changesRoot = root
+
+	filter := func(diags []Diagnostic) []Diagnostic {
+		kept := diags[:0]
+		for _, d := range diags {
+			if changes.touches(d, root) {
+				kept = append(kept, d)
+				continue
+			}
+			r.OutsideDiff = append(r.OutsideDiff, d)
+		}
+		return kept
+	}
+	r.Findings = filter(r.Findings)
+	r.Warnings = filter(r.Warnings)
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDiff = `diff --git a/app/f.go b/app/f.go
+index 1111111..2222222 100644
+--- a/app/f.go
++++ b/app/f.go
+@@ -10,3 +10,3 @@ func Get() {
+ 	a()
++	b()
+ 	c()
+--- d()
+@@ -40,2 +41,0 @@ func Put() {
+-	e()
+-	f()
+diff --git a/app/old.go b/app/old.go
+deleted file mode 100644
+--- a/app/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package app
+-
+`
+
+func TestParseUnifiedDiff(t *testing.T) {
+	changes, err := ParseUnifiedDiff(strings.NewReader(sampleDiff), "/src")
+	if err != nil {
+		t.Fatalf("ParseUnifiedDiff failed: %v", err)
+	}
+
+	want := []LineRange{{Start: 10, End: 12}, {Start: 42, End: 42}}
+	got := changes["/src/app/f.go"]
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("unexpected ranges for f.go: %+v", changes)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected the deleted file to be ignored, got %+v", changes)
+	}
+
+	if !changes.Contains("app/f.go", 12, "/src") || !changes.Contains("/src/app/f.go", 42, "/other") {
+		t.Fatal("expected lines in hunks to be contained")
+	}
+	if changes.Contains("/src/app/f.go", 13, "") || changes.Contains("/src/app/g.go", 12, "") {
+		t.Fatal("expected lines outside hunks not to be contained")
+	}
+}
+
+func TestKeepChanged(t *testing.T) {
+	changes := ChangedLines{"/src/f.go": {{Start: 10, End: 13}}}
+
+	r := NewReporter()
+	r.AddSuppression(Suppression{Rule: RuleLockLeak, Reason: "in diff", File: "/src/f.go", Line: 11, StartLine: 11, EndLine: 12})
+	r.AddSuppression(Suppression{Rule: RuleLockLeak, Reason: "outside diff", File: "/src/f.go", Line: 30, StartLine: 30, EndLine: 31})
+	r.Warn(Diagnostic{File: "/src/f.go", Line: 12, Rule: RuleGuardViolation, Message: "in a hunk"})
+	r.Warn(Diagnostic{File: "/src/f.go", Line: 50, Rule: RuleGuardViolation, Message: "unchanged"})
+	r.Warn(Diagnostic{
+		File: "/src/g.go", Line: 5, Rule: RuleLockOrderInversion, Message: "other site in a hunk",
+		Related: []RelatedPosition{{File: "/src/f.go", Line: 10}},
+	})
+	r.Warn(Diagnostic{
+		File: "/src/g.go", Line: 8, Rule: RuleLockLeak, Message: "only a trace step in a hunk",
+		Related: []RelatedPosition{{File: "/src/f.go", Line: 11, Trace: true}},
+	})
+
+	r.KeepChanged(changes, "/src")
+	if len(r.Findings) != 2 || len(r.OutsideDiff) != 2 || r.OutsideDiff[0].Line != 50 || r.OutsideDiff[1].Line != 8 {
+		t.Fatalf("unexpected findings %+v, outside diff %+v", r.Findings, r.OutsideDiff)
+	}
+	if unused := r.UnusedSuppressions(); len(unused) != 1 || unused[0].Reason != "in diff" {
+		t.Fatalf("expected only the unused suppression in the diff, got %+v", unused)
+	}
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of a run, for CI gating.
+const (
+	// ExitOK: nothing exceeds the failure thresholds.
+	ExitOK = 0
+	// ExitFindings: findings exceed the failure thresholds.
+	ExitFindings = 1
+	// ExitWarnings: only advisory warnings exceed the failure thresholds.
+	ExitWarnings = 2
+	// ExitError: invalid flags, or packages that fail to load or parse.
+	ExitError = 3
+)
+
+// What fails a run by default: findings only, findings and advisory
+// warnings, or nothing.
+const (
+	FailOnFindings = "findings"
+	FailOnWarnings = "warnings"
+	FailOnNone     = "none"
+)
+
+// NeverFail is the threshold of a rule that never fails the run.
+const NeverFail = -1
+
+// FailurePolicy decides which diagnostics fail a run.
+type FailurePolicy struct {
+	// FailOn is FailOnFindings, FailOnWarnings or FailOnNone.
+	FailOn string
+	// RuleThresholds maps rule IDs to the number of diagnostics of the rule
+	// tolerated before the run fails, overriding FailOn for that rule. A
+	// rule with threshold NeverFail does not fail the run.
+	RuleThresholds map[string]int
+}
+
+// ParseFailOn validates a -fail-on value.
+func ParseFailOn(value string) (string, error) {
+	switch value {
+	case FailOnFindings, FailOnWarnings, FailOnNone:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown value %q: expected %s, %s or %s", value, FailOnFindings, FailOnWarnings, FailOnNone)
+}
+
+// ParseRuleThresholds parses a comma-separated list of rule=N entries, where
+// N is the number of diagnostics of the rule tolerated, or "none" for a rule
+// that never fails the run.
+func ParseRuleThresholds(list string) (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid threshold %q: expected rule=N or rule=none", entry)
+		}
+		id = strings.TrimSpace(id)
+		value = strings.TrimSpace(value)
+		if _, known := RuleByID(id); !known {
+			return nil, fmt.Errorf("unknown rule %q", id)
+		}
+
+		if value == FailOnNone {
+			thresholds[id] = NeverFail
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid threshold %q for rule %s: expected a count or none", value, id)
+		}
+		thresholds[id] = n
+	}
+	return thresholds, nil
+}
+
+// Number of diagnostics of rule tolerated under policy, for a diagnostic
+// of the given category.
+func (p FailurePolicy) threshold(rule string, category string) int {
+	if n, ok := p.RuleThresholds[rule]; ok {
+		return n
+	}
+	switch p.FailOn {
+	case FailOnNone:
+		return NeverFail
+	case FailOnWarnings:
+		return 0
+	}
+	if category == CategoryFinding {
+		return 0
+	}
+	return NeverFail
+}
+
+// Whether the diagnostics exceed the thresholds of policy. Diagnostics
+// without a known rule are counted in category.
+func (p FailurePolicy) exceeded(diags []Diagnostic, category string) bool {
+	counts := make(map[string]int)
+	for _, d := range diags {
+		counts[d.Rule]++
+	}
+	for rule, count := range counts {
+		ruleCategory := category
+		if known, ok := RuleByID(rule); ok {
+			ruleCategory = known.Category
+		}
+		if limit := p.threshold(rule, ruleCategory); limit != NeverFail && count > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitCode returns the exit code of the run under policy: ExitFindings if
+// the findings exceed its thresholds, otherwise ExitWarnings if the
+// advisory warnings do, otherwise ExitOK.
+func (r *Reporter) ExitCode(policy FailurePolicy) int {
+	if r == nil {
+		return ExitOK
+	}
+	if policy.exceeded(r.Findings, CategoryFinding) {
+		return ExitFindings
+	}
+	if policy.exceeded(r.Warnings, CategoryAdvisory) {
+		return ExitWarnings
+	}
+	return ExitOK
+}
@@ -0,0 +1,48 @@
+package report
+
+import "testing"
+
+func TestExitCode(t *testing.T) {
+	r := NewReporter()
+	r.Warn(Diagnostic{File: "f.go", Line: 1, Rule: RuleLockLeak, Message: "leak 1"})
+	r.Warn(Diagnostic{File: "f.go", Line: 2, Rule: RuleLockLeak, Message: "leak 2"})
+	r.WarnHeuristic(Diagnostic{File: "f.go", Line: 3, Rule: RuleMissingAnnotation, Message: "missing annotation"})
+
+	tests := []struct {
+		name   string
+		policy FailurePolicy
+		want   int
+	}{
+		{"findings fail by default", FailurePolicy{FailOn: FailOnFindings}, ExitFindings},
+		{"none never fails", FailurePolicy{FailOn: FailOnNone}, ExitOK},
+		{"threshold at the count", FailurePolicy{FailOn: FailOnFindings, RuleThresholds: map[string]int{RuleLockLeak: 2}}, ExitOK},
+		{"threshold below the count", FailurePolicy{FailOn: FailOnFindings, RuleThresholds: map[string]int{RuleLockLeak: 1}}, ExitFindings},
+		{"rule never fails", FailurePolicy{FailOn: FailOnFindings, RuleThresholds: map[string]int{RuleLockLeak: NeverFail}}, ExitOK},
+		{"warnings fail on advisories", FailurePolicy{FailOn: FailOnWarnings, RuleThresholds: map[string]int{RuleLockLeak: NeverFail}}, ExitWarnings},
+		{"advisory rule threshold", FailurePolicy{FailOn: FailOnNone, RuleThresholds: map[string]int{RuleMissingAnnotation: 0}}, ExitWarnings},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ExitCode(tt.policy); got != tt.want {
+				t.Fatalf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRuleThresholds(t *testing.T) {
+	thresholds, err := ParseRuleThresholds("lock-leak=3, missing-annotation=none")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if thresholds[RuleLockLeak] != 3 || thresholds[RuleMissingAnnotation] != NeverFail {
+		t.Fatalf("unexpected thresholds: %v", thresholds)
+	}
+
+	for _, invalid := range []string{"lock-leak", "no-such-rule=1", "lock-leak=-1", "lock-leak=many"} {
+		if _, err := ParseRuleThresholds(invalid); err == nil {
+			t.Fatalf("expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSON output, one document per run. The layout is described by
+// report.schema.json; JSONSchemaVersion changes whenever a field is removed
+// or changes meaning, so tools can rely on it instead of the message text.
+// Adding fields does not change the version.
+
+const JSONSchemaVersion = 1
+
+// RunInfo describes an analysis run, for the metadata of machine-readable
+// reports.
+type RunInfo struct {
+	// Mode is "strict" or "lenient".
+	Mode         string
+	WholeProgram bool
+	// Patterns are the package patterns or file given on the command line;
+	// Packages the import paths of the packages they loaded.
+	Patterns  []string
+	Packages  []string
+	StartedAt time.Time
+	Duration  time.Duration
+	// Phases lists the duration of each phase of the run, in order.
+	Phases []PhaseTiming
+}
+
+// PhaseTiming is the duration of one phase of a run (loading, parsing
+// annotations, building SSA, analysis).
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+type jsonReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Tool          jsonTool         `json:"tool"`
+	Run           jsonRun          `json:"run"`
+	Summary       jsonSummary      `json:"summary"`
+	Findings      []jsonDiagnostic `json:"findings"`
+	Advisories    []jsonDiagnostic `json:"advisories"`
+	ParseWarnings []jsonDiagnostic `json:"parse_warnings"`
+	// Suppressions that matched no diagnostic.
+	UnusedSuppressions []jsonSuppression `json:"unused_suppressions"`
+}
+
+type jsonTool struct {
+	Name string `json:"name"`
+}
+
+type jsonRun struct {
+	Mode         string      `json:"mode"`
+	WholeProgram bool        `json:"whole_program"`
+	Patterns     []string    `json:"patterns"`
+	Packages     []string    `json:"packages"`
+	StartedAt    string      `json:"started_at,omitempty"`
+	DurationMS   float64     `json:"duration_ms"`
+	Phases       []jsonPhase `json:"phases"`
+}
+
+type jsonPhase struct {
+	Name       string  `json:"name"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type jsonSummary struct {
+	Findings      int `json:"findings"`
+	Advisories    int `json:"advisories"`
+	ParseWarnings int `json:"parse_warnings"`
+	Suppressed    int `json:"suppressed"`
+	Baselined     int `json:"baselined"`
+	OutsideDiff   int `json:"outside_diff"`
+}
+
+type jsonSuppression struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+}
+
+type jsonDiagnostic struct {
+	Rule      string         `json:"rule,omitempty"`
+	Severity  string         `json:"severity,omitempty"`
+	Message   string         `json:"message"`
+	File      string         `json:"file"`
+	Line      int            `json:"line"`
+	Column    int            `json:"column"`
+	Function  string         `json:"function,omitempty"`
+	Locks     []string       `json:"locks"`
+	Functions []string       `json:"functions"`
+	Related   []jsonLocation `json:"related"`
+}
+
+type jsonLocation struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+	// Set on the steps of a witness trace (-explain).
+	Trace bool `json:"trace,omitempty"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Lists are written as empty arrays rather than null.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+func jsonDiagnostics(diags []Diagnostic) []jsonDiagnostic {
+	out := make([]jsonDiagnostic, 0, len(diags))
+	for _, d := range diags {
+		related := make([]jsonLocation, 0, len(d.Related))
+		for _, rel := range d.Related {
+			related = append(related, jsonLocation{File: rel.File, Line: rel.Line, Column: rel.Column, Message: rel.Message, Trace: rel.Trace})
+		}
+		out = append(out, jsonDiagnostic{
+			Rule:      d.Rule,
+			Severity:  string(d.Severity),
+			Message:   d.Message,
+			File:      d.File,
+			Line:      d.Line,
+			Column:    d.Column,
+			Function:  d.Function,
+			Locks:     nonNil(d.Locks),
+			Functions: nonNil(d.Functions),
+			Related:   related,
+		})
+	}
+	return out
+}
+
+// WriteJSON writes the findings, advisory warnings and parse warnings of a
+// run as one JSON document.
+func (r *Reporter) WriteJSON(w io.Writer, run RunInfo) error {
+	sortDiagnostics(r.Findings)
+	sortDiagnostics(r.Warnings)
+	sortDiagnostics(r.ParseWarnings)
+
+	phases := make([]jsonPhase, 0, len(run.Phases))
+	for _, phase := range run.Phases {
+		phases = append(phases, jsonPhase{Name: phase.Name, DurationMS: milliseconds(phase.Duration)})
+	}
+
+	doc := jsonReport{
+		SchemaVersion: JSONSchemaVersion,
+		Tool:          jsonTool{Name: "gotsan"},
+		Run: jsonRun{
+			Mode:         run.Mode,
+			WholeProgram: run.WholeProgram,
+			Patterns:     nonNil(run.Patterns),
+			Packages:     nonNil(run.Packages),
+			DurationMS:   milliseconds(run.Duration),
+			Phases:       phases,
+		},
+		Summary: jsonSummary{
+			Findings:      len(r.Findings),
+			Advisories:    len(r.Warnings),
+			ParseWarnings: len(r.ParseWarnings),
+			Suppressed:    len(r.Suppressed),
+			Baselined:     len(r.Baselined),
+			OutsideDiff:   len(r.OutsideDiff),
+		},
+		Findings:           jsonDiagnostics(r.Findings),
+		Advisories:         jsonDiagnostics(r.Warnings),
+		ParseWarnings:      jsonDiagnostics(r.ParseWarnings),
+		UnusedSuppressions: make([]jsonSuppression, 0),
+	}
+	for _, s := range r.UnusedSuppressions() {
+		doc.UnusedSuppressions = append(doc.UnusedSuppressions, jsonSuppression{Rule: s.Rule, Reason: s.Reason, File: s.File, Line: s.Line})
+	}
+	if !run.StartedAt.IsZero() {
+		doc.Run.StartedAt = run.StartedAt.UTC().Format(time.RFC3339)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
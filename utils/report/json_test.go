@@ -0,0 +1,127 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWriteJSON(t *testing.T) {
+	r := NewReporter()
+	r.Warn(Diagnostic{
+		File:      "f.go",
+		Line:      12,
+		Column:    2,
+		Rule:      RuleMissingLock,
+		Message:   "Calling Get requires lock(s) mu",
+		Locks:     []string{"mu"},
+		Functions: []string{"Get"},
+		Related: []RelatedPosition{
+			{File: "f.go", Line: 8, Column: 2, Message: "other site"},
+			{File: "f.go", Line: 10, Column: 2, Message: "branch taken", Trace: true},
+		},
+	})
+	r.WarnHeuristic(Diagnostic{File: "f.go", Line: 3, Column: 1, Rule: RuleMissingAnnotation, Message: "Heuristic: missing annotation"})
+	r.WarnParse(Diagnostic{File: "f.go", Line: 1, Column: 1, Message: "Ignoring annotation"})
+
+	var buf bytes.Buffer
+	err := r.WriteJSON(&buf, RunInfo{
+		Mode:      "strict",
+		Patterns:  []string{"./..."},
+		Packages:  []string{"example.com/app"},
+		StartedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:  1500 * time.Microsecond,
+		Phases:    []PhaseTiming{{Name: "load", Duration: time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	var doc jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if doc.SchemaVersion != JSONSchemaVersion || doc.Tool.Name != "gotsan" {
+		t.Fatalf("unexpected header: %+v", doc)
+	}
+	if doc.Run.Mode != "strict" || doc.Run.StartedAt != "2024-01-02T03:04:05Z" || doc.Run.DurationMS != 1.5 {
+		t.Fatalf("unexpected run metadata: %+v", doc.Run)
+	}
+	if doc.Summary != (jsonSummary{Findings: 1, Advisories: 1, ParseWarnings: 1}) {
+		t.Fatalf("unexpected summary: %+v", doc.Summary)
+	}
+
+	finding := doc.Findings[0]
+	if finding.Rule != RuleMissingLock || finding.Severity != "error" || finding.Locks[0] != "mu" || len(finding.Related) != 2 {
+		t.Fatalf("unexpected finding: %+v", finding)
+	}
+	if finding.Related[0].Trace || !finding.Related[1].Trace {
+		t.Fatalf("expected only the trace step to be marked, got %+v", finding.Related)
+	}
+	if warning := doc.ParseWarnings[0]; warning.Rule != "" || warning.Severity != "warning" {
+		t.Fatalf("unexpected parse warning: %+v", warning)
+	}
+
+	// Empty lists are arrays, not null.
+	var raw map[string]any
+	_ = json.Unmarshal(buf.Bytes(), &raw)
+	advisory := raw["advisories"].([]any)[0].(map[string]any)
+	if _, ok := advisory["locks"].([]any); !ok {
+		t.Fatalf("expected an empty locks array, got %v", advisory["locks"])
+	}
+}
+
+// The output must carry every field report.schema.json requires.
+func TestWriteJSONMatchesSchema(t *testing.T) {
+	data, err := os.ReadFile("report.schema.json")
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties struct {
+			SchemaVersion struct {
+				Const int `json:"const"`
+			} `json:"schema_version"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if schema.Properties.SchemaVersion.Const != JSONSchemaVersion {
+		t.Fatalf("schema describes version %d, writer emits %d", schema.Properties.SchemaVersion.Const, JSONSchemaVersion)
+	}
+
+	var buf bytes.Buffer
+	if err := NewReporter().WriteJSON(&buf, RunInfo{Mode: "lenient"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	required := append([]string(nil), schema.Required...)
+	sort.Strings(required)
+	if len(keys) != len(required) {
+		t.Fatalf("top-level fields %v do not match schema %v", keys, required)
+	}
+	for i := range keys {
+		if keys[i] != required[i] {
+			t.Fatalf("top-level fields %v do not match schema %v", keys, required)
+		}
+	}
+	for _, list := range []string{"findings", "advisories", "parse_warnings"} {
+		if _, ok := raw[list].([]any); !ok {
+			t.Fatalf("expected %s to be an array, got %v", list, raw[list])
+		}
+	}
+}
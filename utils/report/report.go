@@ -3,26 +3,75 @@ package report
 import (
 	"fmt"
 	"go/token"
+	"io"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
 )
 
 type Diagnostic struct {
+	Pos    token.Pos
+	File   string
+	Line   int
+	Column int
+	// Rule is the ID of the rule the diagnostic belongs to (see rules.go).
+	Rule string
+	// Severity defaults to the severity of the rule when reported.
+	Severity Severity
+	Message  string
+	// Function is the function the diagnostic is in, where known.
+	Function string
+	// Locks and Functions name the locks and functions involved, in the
+	// order the message mentions them.
+	Locks     []string
+	Functions []string
+	// Related holds secondary positions, such as the other site of a
+	// deadlock or the steps of the path that led to the finding in explain
+	// mode.
+	Related []RelatedPosition
+}
+
+// RelatedPosition is a secondary location attached to a Diagnostic.
+type RelatedPosition struct {
 	Pos     token.Pos
 	File    string
 	Line    int
 	Column  int
 	Message string
+	// Trace marks a step of the path that led to the finding (see
+	// Reporter.Explain) rather than another site of it.
+	Trace bool
 }
 
 type Reporter struct {
-	Findings                 []Diagnostic
-	Warnings                 []Diagnostic
+	Findings []Diagnostic
+	Warnings []Diagnostic
+	// ParseWarnings holds malformed or misplaced annotations found before
+	// the analysis. They are logged as they are found, and only listed
+	// separately in machine-readable output.
+	ParseWarnings []Diagnostic
+	// Suppressed holds the diagnostics dropped by suppressions, Baselined
+	// those dropped by a baseline (see ApplyBaseline) and OutsideDiff those
+	// outside the changed lines (see KeepChanged).
+	Suppressed               []Diagnostic
+	Baselined                []Diagnostic
+	OutsideDiff              []Diagnostic
 	IgnoreMissingAnnotations bool
+	// Explain asks the analysis to attach witness traces to findings.
+	Explain bool
+	// EnabledRules, when non-empty, limits reporting to the listed rule IDs.
+	// DisabledRules drops the listed rule IDs.
+	EnabledRules  map[string]bool
+	DisabledRules map[string]bool
 	// seen holds diagnostics that have already been reported; used to avoid duplicates.
 	seen         map[string]struct{}
 	seenWarnings map[string]struct{}
+	seenParse    map[string]struct{}
+	suppressions []*Suppression
+	// Set by KeepChanged.
+	changes     ChangedLines
+	changesRoot string
 }
 
 // NewReporter constructs a Reporter with internal deduplication state initialized.
@@ -30,14 +79,36 @@ func NewReporter() *Reporter {
 	return &Reporter{
 		seen:         make(map[string]struct{}),
 		seenWarnings: make(map[string]struct{}),
+		seenParse:    make(map[string]struct{}),
+	}
+}
+
+// Whether diagnostics of rule pass the reporter's rule filters.
+func (r *Reporter) ruleEnabled(rule string) bool {
+	if r.DisabledRules[rule] {
+		return false
 	}
+	return len(r.EnabledRules) == 0 || r.EnabledRules[rule]
+}
+
+// Fill in the severity of d from its rule, or from fallback.
+func withSeverity(d Diagnostic, fallback Severity) Diagnostic {
+	if d.Severity != "" {
+		return d
+	}
+	d.Severity = fallback
+	if rule, ok := RuleByID(d.Rule); ok {
+		d.Severity = rule.Severity
+	}
+	return d
 }
 
 // Warn records an analysis finding.
 func (r *Reporter) Warn(d Diagnostic) {
-	if r == nil {
+	if r == nil || !r.ruleEnabled(d.Rule) {
 		return
 	}
+	d = withSeverity(d, SeverityError)
 	if r.seen == nil {
 		// if the reporter was constructed manually without NewReporter, lazily allocate
 		r.seen = make(map[string]struct{})
@@ -47,18 +118,23 @@ func (r *Reporter) Warn(d Diagnostic) {
 		return
 	}
 	r.seen[key] = struct{}{}
+	if r.suppressed(d) {
+		r.Suppressed = append(r.Suppressed, d)
+		return
+	}
 	r.Findings = append(r.Findings, d)
 }
 
 // WarnHeuristic records an advisory warning that should be printed separately
 // from core analysis findings.
 func (r *Reporter) WarnHeuristic(d Diagnostic) {
-	if r == nil {
+	if r == nil || !r.ruleEnabled(d.Rule) {
 		return
 	}
 	if r.IgnoreMissingAnnotations {
 		return
 	}
+	d = withSeverity(d, SeverityNote)
 	if r.seenWarnings == nil {
 		r.seenWarnings = make(map[string]struct{})
 	}
@@ -69,9 +145,33 @@ func (r *Reporter) WarnHeuristic(d Diagnostic) {
 	}
 
 	r.seenWarnings[key] = struct{}{}
+	if r.suppressed(d) {
+		r.Suppressed = append(r.Suppressed, d)
+		return
+	}
 	r.Warnings = append(r.Warnings, d)
 }
 
+// WarnParse records a parse warning. The test variants of a package share
+// its files, so the same warning may be handed in once per variant.
+func (r *Reporter) WarnParse(d Diagnostic) {
+	if r == nil {
+		return
+	}
+	if d.Severity == "" {
+		d.Severity = SeverityWarning
+	}
+	if r.seenParse == nil {
+		r.seenParse = make(map[string]struct{})
+	}
+	key := diagnosticKey(d)
+	if _, ok := r.seenParse[key]; ok {
+		return
+	}
+	r.seenParse[key] = struct{}{}
+	r.ParseWarnings = append(r.ParseWarnings, d)
+}
+
 func diagnosticKey(d Diagnostic) string {
 	var b strings.Builder
 	b.Grow(len(d.File) + len(d.Message) + 32)
@@ -82,6 +182,15 @@ func diagnosticKey(d Diagnostic) string {
 	b.WriteString(strconv.Itoa(d.Column))
 	b.WriteString(":")
 	b.WriteString(d.Message)
+	// Reports that differ only in their other sites are distinct.
+	for _, rel := range d.Related {
+		b.WriteString("|")
+		b.WriteString(rel.File)
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(rel.Line))
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(rel.Column))
+	}
 	return b.String()
 }
 
@@ -95,7 +204,7 @@ func (r *Reporter) Print() {
 		fmt.Printf("GOTSAN REPORT - %d finding(s)\n", len(r.Findings))
 		fmt.Println("============================================================")
 		for _, d := range r.Findings {
-			fmt.Printf("%s:%d:%d: %s\n", d.File, d.Line, d.Column, d.Message)
+			printDiagnostic(os.Stdout, d)
 		}
 		fmt.Println("============================================================")
 	}
@@ -106,12 +215,36 @@ func (r *Reporter) Print() {
 		fmt.Printf("ANNOTATION ADVISORY WARNINGS - %d warning(s)\n", len(r.Warnings))
 		fmt.Println("============================================================")
 		for _, d := range r.Warnings {
-			fmt.Printf("%s:%d:%d: %s\n", d.File, d.Line, d.Column, d.Message)
+			printDiagnostic(os.Stdout, d)
+		}
+		fmt.Println("============================================================")
+	}
+
+	if unused := r.UnusedSuppressions(); len(unused) > 0 {
+		fmt.Println()
+		fmt.Println("============================================================")
+		fmt.Printf("UNUSED SUPPRESSIONS - %d suppression(s) match no diagnostic\n", len(unused))
+		fmt.Println("============================================================")
+		for _, s := range unused {
+			fmt.Printf("%s:%d: //gotsan:ignore %s %s\n", s.File, s.Line, s.Rule, s.Reason)
 		}
 		fmt.Println("============================================================")
 	}
 }
 
+// printDiagnostic prints d, tagged with its rule, followed by its related
+// positions as an indented, numbered step list.
+func printDiagnostic(w io.Writer, d Diagnostic) {
+	if d.Rule != "" {
+		fmt.Fprintf(w, "%s:%d:%d: %s [%s]\n", d.File, d.Line, d.Column, d.Message, d.Rule)
+	} else {
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", d.File, d.Line, d.Column, d.Message)
+	}
+	for i, rel := range d.Related {
+		fmt.Fprintf(w, "    %d. %s:%d:%d: %s\n", i+1, rel.File, rel.Line, rel.Column, rel.Message)
+	}
+}
+
 func sortDiagnostics(diags []Diagnostic) {
 	sort.Slice(diags, func(i, j int) bool {
 		a := diags[i]
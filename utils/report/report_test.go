@@ -1,6 +1,8 @@
 package report
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -10,10 +12,10 @@ func TestReporterDeduplication(t *testing.T) {
 		t.Fatal("NewReporter returned nil")
 	}
 
-	d1 := Diagnostic{File: "f.go", Line: 10, Column: 2, Message: "duplicate error"}
-	d2 := Diagnostic{File: "f.go", Line: 20, Column: 4, Message: "duplicate error"}
-	d2Dup := Diagnostic{File: "f.go", Line: 20, Column: 4, Message: "duplicate error"}
-	d3 := Diagnostic{File: "f.go", Line: 30, Column: 6, Message: "another error"}
+	d1 := Diagnostic{File: "f.go", Line: 10, Column: 2, Severity: SeverityError, Message: "duplicate error"}
+	d2 := Diagnostic{File: "f.go", Line: 20, Column: 4, Severity: SeverityError, Message: "duplicate error"}
+	d2Dup := Diagnostic{File: "f.go", Line: 20, Column: 4, Severity: SeverityError, Message: "duplicate error"}
+	d3 := Diagnostic{File: "f.go", Line: 30, Column: 6, Severity: SeverityError, Message: "another error"}
 
 	r.Warn(d1)
 	r.Warn(d2)    // same message at different location should be preserved
@@ -23,13 +25,13 @@ func TestReporterDeduplication(t *testing.T) {
 	if len(r.Findings) != 3 {
 		t.Errorf("expected 3 findings after dedup, got %d: %v", len(r.Findings), r.Findings)
 	}
-	if r.Findings[0] != d1 {
+	if !reflect.DeepEqual(r.Findings[0], d1) {
 		t.Errorf("first finding wrong: %v", r.Findings[0])
 	}
-	if r.Findings[1] != d2 {
+	if !reflect.DeepEqual(r.Findings[1], d2) {
 		t.Errorf("second finding wrong: %v", r.Findings[1])
 	}
-	if r.Findings[2] != d3 {
+	if !reflect.DeepEqual(r.Findings[2], d3) {
 		t.Errorf("third finding wrong: %v", r.Findings[2])
 	}
 }
@@ -57,6 +59,19 @@ func TestReporterHeuristicWarningDeduplication(t *testing.T) {
 	}
 }
 
+func TestReporterParseWarningDeduplication(t *testing.T) {
+	r := NewReporter()
+
+	d := Diagnostic{File: "f.go", Line: 3, Column: 1, Message: "Ignoring annotation"}
+	r.WarnParse(d)
+	r.WarnParse(d) // the same file walked again for a test variant
+	r.WarnParse(Diagnostic{File: "f.go", Line: 7, Column: 1, Message: "Ignoring annotation"})
+
+	if len(r.ParseWarnings) != 2 {
+		t.Fatalf("expected 2 parse warnings after dedup, got %d: %v", len(r.ParseWarnings), r.ParseWarnings)
+	}
+}
+
 func TestReporterIgnoreMissingAnnotations(t *testing.T) {
 	r := NewReporter()
 	r.IgnoreMissingAnnotations = true
@@ -67,3 +82,59 @@ func TestReporterIgnoreMissingAnnotations(t *testing.T) {
 		t.Fatalf("expected warnings to be suppressed, got %d", len(r.Warnings))
 	}
 }
+
+func TestReporterRuleFilters(t *testing.T) {
+	r := NewReporter()
+	r.DisabledRules = map[string]bool{RuleLockLeak: true}
+
+	r.Warn(Diagnostic{File: "f.go", Line: 1, Rule: RuleLockLeak, Message: "leak"})
+	r.Warn(Diagnostic{File: "f.go", Line: 2, Rule: RuleMissingLock, Message: "missing"})
+	if len(r.Findings) != 1 || r.Findings[0].Rule != RuleMissingLock {
+		t.Fatalf("expected only the missing-lock finding, got %v", r.Findings)
+	}
+
+	r = NewReporter()
+	r.EnabledRules = map[string]bool{RuleLockLeak: true}
+	r.Warn(Diagnostic{File: "f.go", Line: 1, Rule: RuleLockLeak, Message: "leak"})
+	r.Warn(Diagnostic{File: "f.go", Line: 2, Rule: RuleMissingLock, Message: "missing"})
+	r.WarnHeuristic(Diagnostic{File: "f.go", Line: 3, Rule: RuleMissingAnnotation, Message: "advisory"})
+	if len(r.Findings) != 1 || r.Findings[0].Rule != RuleLockLeak || len(r.Warnings) != 0 {
+		t.Fatalf("expected only the lock-leak finding, got %v %v", r.Findings, r.Warnings)
+	}
+}
+
+func TestReporterFillsSeverityFromRule(t *testing.T) {
+	r := NewReporter()
+	r.Warn(Diagnostic{File: "f.go", Line: 1, Rule: RuleLockLeak, Message: "leak"})
+	r.WarnHeuristic(Diagnostic{File: "f.go", Line: 2, Message: "advisory without a rule"})
+
+	if got := r.Findings[0].Severity; got != SeverityWarning {
+		t.Fatalf("expected the lock-leak rule severity, got %q", got)
+	}
+	if got := r.Warnings[0].Severity; got != SeverityNote {
+		t.Fatalf("expected advisories to default to note, got %q", got)
+	}
+}
+
+func TestPrintDiagnosticRelatedSteps(t *testing.T) {
+	d := Diagnostic{
+		File:    "f.go",
+		Line:    12,
+		Column:  3,
+		Message: "lock not held",
+		Related: []RelatedPosition{
+			{File: "f.go", Line: 8, Column: 2, Message: "acquires mu"},
+			{File: "f.go", Line: 10, Column: 2, Message: "releases mu"},
+		},
+	}
+
+	var buf bytes.Buffer
+	printDiagnostic(&buf, d)
+
+	want := "f.go:12:3: lock not held\n" +
+		"    1. f.go:8:2: acquires mu\n" +
+		"    2. f.go:10:2: releases mu\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,94 @@
+package report
+
+// Rule IDs identify the kind of a diagnostic. They are stable across
+// releases, so external tools (SARIF consumers, suppressions) can refer to
+// them.
+const (
+	// Findings
+	RuleMissingLock           = "missing-lock"
+	RuleGuardViolation        = "guard-violation"
+	RuleReacquire             = "reacquire"
+	RuleReturnsContract       = "returns-contract"
+	RuleLockLeak              = "lock-leak"
+	RuleUnlockNotHeld         = "unlock-not-held"
+	RuleLockOrderInversion    = "lock-order-inversion"
+	RuleGoroutineReacquire    = "goroutine-reacquire"
+	RuleRWRDeadlock           = "rwr-deadlock"
+	RuleExcludedLockHeld      = "excluded-lock-held"
+	RuleContradictoryContract = "contradictory-contract"
+	RuleReleasesContract      = "releases-contract"
+	RuleLockOrderViolation    = "lock-order-violation"
+	RuleCondWaitUnlocked      = "cond-wait-unlocked"
+	RuleCondWaitHoldingLock   = "cond-wait-holding-lock"
+	RuleLockChannelDeadlock   = "lock-channel-deadlock"
+
+	// Advisories
+	RuleUnresolvableAnnotation = "unresolvable-annotation"
+	RuleMissingAnnotation      = "missing-annotation"
+	RuleCallbackUnderLock      = "callback-under-lock"
+	RuleRecursiveReacquire     = "recursive-reacquire"
+	RuleCondWaitOutsideLoop    = "cond-wait-outside-loop"
+	RuleCondSignalUnlocked     = "cond-signal-unlocked"
+	RuleBlockingUnderLock      = "blocking-under-lock"
+)
+
+// Rule categories: findings are violations the analysis is confident about,
+// advisories are heuristic hints printed separately.
+const (
+	CategoryFinding  = "finding"
+	CategoryAdvisory = "advisory"
+)
+
+// Severity of a diagnostic, using the SARIF level names.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityNote    Severity = "note"
+)
+
+// Rule describes a diagnostic kind.
+type Rule struct {
+	ID          string
+	Category    string
+	Severity    Severity
+	Description string
+}
+
+// Rules lists every rule, findings first.
+var Rules = []Rule{
+	{RuleMissingLock, CategoryFinding, SeverityError, "A call requires a lock that is not held, or not held exclusively."},
+	{RuleGuardViolation, CategoryFinding, SeverityError, "Data annotated @guarded_by is accessed without its lock, or written under a read lock."},
+	{RuleReacquire, CategoryFinding, SeverityError, "A lock is acquired, or upgraded to a write lock, while it is already held."},
+	{RuleReturnsContract, CategoryFinding, SeverityError, "A function's returned locks do not match its @returns or @returns_if contract."},
+	{RuleLockLeak, CategoryFinding, SeverityWarning, "A lock may still be held when the function returns."},
+	{RuleUnlockNotHeld, CategoryFinding, SeverityError, "A lock is released when it is not held, or in the wrong mode."},
+	{RuleLockOrderInversion, CategoryFinding, SeverityError, "Locks are acquired in conflicting orders, forming a potential deadlock cycle."},
+	{RuleGoroutineReacquire, CategoryFinding, SeverityError, "A goroutine may reacquire a lock it holds while another goroutine also acquires it."},
+	{RuleRWRDeadlock, CategoryFinding, SeverityError, "A goroutine read-locks an RWMutex it already holds shared while another goroutine write-locks it."},
+	{RuleExcludedLockHeld, CategoryFinding, SeverityError, "A function annotated @excludes is called while its lock is, or may be, held."},
+	{RuleContradictoryContract, CategoryFinding, SeverityError, "Annotations contradict each other: a contract excludes a lock it requires or releases, or declared lock orders form a cycle."},
+	{RuleReleasesContract, CategoryFinding, SeverityError, "A function annotated @releases may return without releasing its lock."},
+	{RuleLockOrderViolation, CategoryFinding, SeverityError, "A lock is acquired while holding a lock declared @acquired_after it."},
+	{RuleCondWaitUnlocked, CategoryFinding, SeverityError, "sync.Cond.Wait is called without the Cond's Locker held, or held in the wrong mode."},
+	{RuleCondWaitHoldingLock, CategoryFinding, SeverityWarning, "sync.Cond.Wait is called while holding another lock, which stays held while it waits."},
+	{RuleLockChannelDeadlock, CategoryFinding, SeverityError, "A goroutine blocks on a channel while holding a lock that the goroutine at the other end acquires first."},
+	{RuleUnresolvableAnnotation, CategoryAdvisory, SeverityNote, "An annotation target cannot be resolved where it is checked."},
+	{RuleMissingAnnotation, CategoryAdvisory, SeverityNote, "A function appears to be missing a lock annotation."},
+	{RuleCallbackUnderLock, CategoryAdvisory, SeverityNote, "A dynamic callback is invoked while locks are held."},
+	{RuleRecursiveReacquire, CategoryAdvisory, SeverityNote, "A recursive call may reacquire a lock that is already held."},
+	{RuleCondWaitOutsideLoop, CategoryAdvisory, SeverityNote, "sync.Cond.Wait is not called in a loop that rechecks the condition."},
+	{RuleCondSignalUnlocked, CategoryAdvisory, SeverityNote, "sync.Cond.Signal or Broadcast is called by a function that never takes the Cond's Locker, so a waiter may miss it."},
+	{RuleBlockingUnderLock, CategoryAdvisory, SeverityNote, "A channel operation, select or known-blocking call is made while locks are held."},
+}
+
+// RuleByID returns the rule with the given ID.
+func RuleByID(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
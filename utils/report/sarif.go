@@ -0,0 +1,212 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// SARIF 2.1.0 output, for code-scanning dashboards. Findings and advisory
+// warnings are results of rules in separate categories (see Rules); related
+// positions become related locations.
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// Base ID of artifact URIs relative to the analyzed source root.
+	sarifSourceRoot = "%SRCROOT%"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           sarifProperties    `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifProperties struct {
+	Category string   `json:"category"`
+	Tags     []string `json:"tags"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	RuleIndex        *int            `json:"ruleIndex,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	CodeFlows        []sarifCodeFlow `json:"codeFlows,omitempty"`
+}
+
+// A witness trace (-explain) is a code flow with a single thread flow.
+type sarifCodeFlow struct {
+	ThreadFlows []sarifThreadFlow `json:"threadFlows"`
+}
+
+type sarifThreadFlow struct {
+	Locations []sarifThreadFlowLocation `json:"locations"`
+}
+
+type sarifThreadFlowLocation struct {
+	Location sarifLocation `json:"location"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// Artifact location of file. Files under root are given relative to the
+// source root base ID, so results match checkouts in other directories.
+func sarifArtifact(file string, root string) sarifArtifactLocation {
+	if !filepath.IsAbs(file) {
+		return sarifArtifactLocation{URI: filepath.ToSlash(file), URIBaseID: sarifSourceRoot}
+	}
+	if rel, ok := relativeToRoot(file, root); ok {
+		return sarifArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: sarifSourceRoot}
+	}
+	return sarifArtifactLocation{URI: fileURI(file)}
+}
+
+func fileURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	return u.String()
+}
+
+func sarifPhysical(file string, line int, column int, root string) sarifPhysicalLocation {
+	return sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifact(file, root),
+		Region:           sarifRegion{StartLine: line, StartColumn: column},
+	}
+}
+
+func sarifResultFor(d Diagnostic, fallback Severity, ruleIndex map[string]int, root string) sarifResult {
+	level := d.Severity
+	if level == "" {
+		level = fallback
+	}
+
+	result := sarifResult{
+		RuleID:    d.Rule,
+		Level:     string(level),
+		Message:   sarifMessage{Text: d.Message},
+		Locations: []sarifLocation{{PhysicalLocation: sarifPhysical(d.File, d.Line, d.Column, root)}},
+	}
+	if idx, ok := ruleIndex[d.Rule]; ok {
+		result.RuleIndex = &idx
+	}
+
+	var trace []sarifThreadFlowLocation
+	for _, rel := range d.Related {
+		location := sarifLocation{
+			PhysicalLocation: sarifPhysical(rel.File, rel.Line, rel.Column, root),
+			Message:          &sarifMessage{Text: rel.Message},
+		}
+		if rel.Trace {
+			trace = append(trace, sarifThreadFlowLocation{Location: location})
+			continue
+		}
+		location.ID = len(result.RelatedLocations) + 1
+		result.RelatedLocations = append(result.RelatedLocations, location)
+	}
+	if len(trace) > 0 {
+		result.CodeFlows = []sarifCodeFlow{{ThreadFlows: []sarifThreadFlow{{Locations: trace}}}}
+	}
+	return result
+}
+
+// WriteSARIF writes the findings and warnings as a SARIF 2.1.0 log. Paths
+// under root are written relative to it.
+func (r *Reporter) WriteSARIF(w io.Writer, root string) error {
+	sortDiagnostics(r.Findings)
+	sortDiagnostics(r.Warnings)
+
+	rules := make([]sarifRule, 0, len(Rules))
+	ruleIndex := make(map[string]int, len(Rules))
+	for i, rule := range Rules {
+		ruleIndex[rule.ID] = i
+		rules = append(rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: string(rule.Severity)},
+			Properties:           sarifProperties{Category: rule.Category, Tags: []string{rule.Category, "concurrency"}},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(r.Findings)+len(r.Warnings))
+	for _, d := range r.Findings {
+		results = append(results, sarifResultFor(d, SeverityError, ruleIndex, root))
+	}
+	for _, d := range r.Warnings {
+		results = append(results, sarifResultFor(d, SeverityNote, ruleIndex, root))
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "gotsan", Rules: rules}},
+		Results: results,
+	}
+	if root != "" {
+		run.OriginalURIBaseIDs = map[string]sarifArtifactLocation{
+			sarifSourceRoot: {URI: fileURI(root) + "/"},
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+}
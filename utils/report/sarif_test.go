@@ -0,0 +1,103 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	r := NewReporter()
+	r.Warn(Diagnostic{
+		File:    "/src/app/f.go",
+		Line:    12,
+		Column:  2,
+		Rule:    RuleLockOrderInversion,
+		Message: "Potential deadlock between goroutines",
+		Related: []RelatedPosition{
+			{File: "/src/app/f.go", Line: 12, Column: 2, Message: "go a acquires mu1 before mu2"},
+			{File: "/src/app/g.go", Line: 20, Column: 2, Message: "go b acquires mu2 before mu1"},
+		},
+	})
+	r.WarnHeuristic(Diagnostic{File: "/elsewhere/h.go", Line: 3, Column: 1, Rule: RuleMissingAnnotation, Message: "Heuristic: missing annotation"})
+
+	var buf bytes.Buffer
+	if err := r.WriteSARIF(&buf, "/src/app"); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log header: %+v", log)
+	}
+
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(Rules) {
+		t.Fatalf("expected every rule to be described, got %d", len(run.Tool.Driver.Rules))
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected a finding and a warning, got %+v", run.Results)
+	}
+
+	finding := run.Results[0]
+	if finding.RuleID != RuleLockOrderInversion || finding.Level != "error" {
+		t.Fatalf("unexpected finding rule or level: %+v", finding)
+	}
+	if rule := run.Tool.Driver.Rules[*finding.RuleIndex]; rule.ID != finding.RuleID || rule.Properties.Category != CategoryFinding {
+		t.Fatalf("finding points at the wrong rule: %+v", rule)
+	}
+	if loc := finding.Locations[0].PhysicalLocation.ArtifactLocation; loc.URI != "f.go" || loc.URIBaseID != sarifSourceRoot {
+		t.Fatalf("expected a root-relative location, got %+v", loc)
+	}
+	if len(finding.RelatedLocations) != 2 || finding.RelatedLocations[1].PhysicalLocation.ArtifactLocation.URI != "g.go" {
+		t.Fatalf("expected both goroutine sites as related locations, got %+v", finding.RelatedLocations)
+	}
+
+	warning := run.Results[1]
+	if warning.RuleID != RuleMissingAnnotation || warning.Level != "note" {
+		t.Fatalf("unexpected warning rule or level: %+v", warning)
+	}
+	if loc := warning.Locations[0].PhysicalLocation.ArtifactLocation; loc.URI != "file:///elsewhere/h.go" || loc.URIBaseID != "" {
+		t.Fatalf("expected an absolute location outside the root, got %+v", loc)
+	}
+}
+
+func TestWriteSARIFTraceAsCodeFlow(t *testing.T) {
+	r := NewReporter()
+	r.Warn(Diagnostic{
+		File:    "/src/app/f.go",
+		Line:    12,
+		Column:  2,
+		Rule:    RuleMissingLock,
+		Message: "Calling Get requires lock(s) mu",
+		Related: []RelatedPosition{
+			{File: "/src/app/f.go", Line: 8, Column: 2, Message: "mu acquired", Trace: true},
+			{File: "/src/app/f.go", Line: 10, Column: 2, Message: "mu released", Trace: true},
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := r.WriteSARIF(&buf, "/src/app"); err != nil {
+		t.Fatalf("WriteSARIF failed: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	finding := log.Runs[0].Results[0]
+	if len(finding.RelatedLocations) != 0 {
+		t.Fatalf("expected trace steps not to be related locations, got %+v", finding.RelatedLocations)
+	}
+	if len(finding.CodeFlows) != 1 || len(finding.CodeFlows[0].ThreadFlows) != 1 {
+		t.Fatalf("expected one code flow with one thread flow, got %+v", finding.CodeFlows)
+	}
+	steps := finding.CodeFlows[0].ThreadFlows[0].Locations
+	if len(steps) != 2 || steps[0].Location.Message.Text != "mu acquired" || steps[1].Location.PhysicalLocation.Region.StartLine != 10 {
+		t.Fatalf("expected the trace steps in order, got %+v", steps)
+	}
+}
@@ -0,0 +1,76 @@
+package report
+
+import "go/token"
+
+// SuppressAllRules is the rule of a suppression that matches every rule.
+const SuppressAllRules = "all"
+
+// Suppression drops the diagnostics of Rule reported in File between
+// StartLine and EndLine. Line is where the directive itself is written.
+type Suppression struct {
+	Rule      string
+	Reason    string
+	Pos       token.Pos
+	File      string
+	Line      int
+	StartLine int
+	EndLine   int
+	// Number of diagnostics the suppression dropped.
+	hits int
+}
+
+// AddSuppression registers a suppression. It must be added before the
+// diagnostics it drops are reported.
+func (r *Reporter) AddSuppression(s Suppression) {
+	if r == nil {
+		return
+	}
+	r.suppressions = append(r.suppressions, &s)
+}
+
+func (s *Suppression) matches(d Diagnostic) bool {
+	if s.Rule != SuppressAllRules && s.Rule != d.Rule {
+		return false
+	}
+	return s.File == d.File && d.Line >= s.StartLine && d.Line <= s.EndLine
+}
+
+// Whether d is dropped by a suppression; every matching suppression counts
+// as used.
+func (r *Reporter) suppressed(d Diagnostic) bool {
+	matched := false
+	for _, s := range r.suppressions {
+		if s.matches(d) {
+			s.hits++
+			matched = true
+		}
+	}
+	return matched
+}
+
+// UnusedSuppressions returns the suppressions that dropped no diagnostic,
+// leaving out those of rules the reporter filters out anyway and, in diff
+// mode, those outside the changed lines.
+func (r *Reporter) UnusedSuppressions() []Suppression {
+	if r == nil {
+		return nil
+	}
+
+	unused := make([]Suppression, 0)
+	for _, s := range r.suppressions {
+		if s.hits > 0 {
+			continue
+		}
+		if s.Rule != SuppressAllRules && !r.ruleEnabled(s.Rule) {
+			continue
+		}
+		if rule, ok := RuleByID(s.Rule); ok && rule.Category == CategoryAdvisory && r.IgnoreMissingAnnotations {
+			continue
+		}
+		if r.changes != nil && !r.changes.Contains(s.File, s.Line, r.changesRoot) {
+			continue
+		}
+		unused = append(unused, *s)
+	}
+	return unused
+}
@@ -0,0 +1,28 @@
+package report
+
+import "testing"
+
+func TestReporterSuppressions(t *testing.T) {
+	r := NewReporter()
+	r.AddSuppression(Suppression{Rule: RuleGuardViolation, Reason: "benign", File: "f.go", Line: 4, StartLine: 4, EndLine: 5})
+	r.AddSuppression(Suppression{Rule: SuppressAllRules, Reason: "whole function", File: "f.go", Line: 9, StartLine: 10, EndLine: 20})
+	r.AddSuppression(Suppression{Rule: RuleLockLeak, Reason: "unused", File: "f.go", Line: 30, StartLine: 30, EndLine: 31})
+	r.AddSuppression(Suppression{Rule: RuleMissingLock, Reason: "filtered rule", File: "f.go", Line: 40, StartLine: 40, EndLine: 41})
+	r.DisabledRules = map[string]bool{RuleMissingLock: true}
+
+	r.Warn(Diagnostic{File: "f.go", Line: 5, Rule: RuleGuardViolation, Message: "suppressed by line"})
+	r.Warn(Diagnostic{File: "f.go", Line: 6, Rule: RuleGuardViolation, Message: "past the covered lines"})
+	r.Warn(Diagnostic{File: "g.go", Line: 5, Rule: RuleGuardViolation, Message: "other file"})
+	r.Warn(Diagnostic{File: "f.go", Line: 12, Rule: RuleReacquire, Message: "suppressed by function"})
+	r.WarnHeuristic(Diagnostic{File: "f.go", Line: 15, Rule: RuleMissingAnnotation, Message: "advisory suppressed by function"})
+	r.Warn(Diagnostic{File: "f.go", Line: 30, Rule: RuleGuardViolation, Message: "other rule"})
+
+	if len(r.Findings) != 3 || len(r.Warnings) != 0 || len(r.Suppressed) != 3 {
+		t.Fatalf("unexpected findings %+v, warnings %+v, suppressed %+v", r.Findings, r.Warnings, r.Suppressed)
+	}
+
+	unused := r.UnusedSuppressions()
+	if len(unused) != 1 || unused[0].Rule != RuleLockLeak {
+		t.Fatalf("expected only the lock-leak suppression to be unused, got %+v", unused)
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"go/token"
+	"io"
 
 	"golang.org/x/tools/go/ssa"
 )
@@ -16,30 +17,30 @@ func FormatPos(fset *token.FileSet, pos token.Pos) string {
 	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
 }
 
-func PrintSSABlock(block *ssa.BasicBlock) {
-	fmt.Printf("\n--- Block %d ---\n", block.Index)
+func PrintSSABlock(w io.Writer, block *ssa.BasicBlock) {
+	fmt.Fprintf(w, "\n--- Block %d ---\n", block.Index)
 	for _, instr := range block.Instrs {
-		fmt.Printf("  %v\t\t(%T)\n", instr, instr)
+		fmt.Fprintf(w, "  %v\t\t(%T)\n", instr, instr)
 	}
 }
 
 // Testing utility to print a basic block of a function in SSA form
-func PrintFunctionBlocks(fn *ssa.Function) {
-	fmt.Printf("Blocks for function: %s\n", fn.String())
+func PrintFunctionBlocks(w io.Writer, fn *ssa.Function) {
+	fmt.Fprintf(w, "Blocks for function: %s\n", fn.String())
 
 	for _, block := range fn.Blocks {
 		// 1. Print the instructions in the block
-		PrintSSABlock(block)
+		PrintSSABlock(w, block)
 
 		// 2. Print where this block can go next (Successors)
 		if len(block.Succs) > 0 {
-			fmt.Print("  Successors: ")
+			fmt.Fprint(w, "  Successors: ")
 			for _, succ := range block.Succs {
-				fmt.Printf("Block %d ", succ.Index)
+				fmt.Fprintf(w, "Block %d ", succ.Index)
 			}
-			fmt.Println()
+			fmt.Fprintln(w)
 		} else {
-			fmt.Println("  Successors: (Exit)")
+			fmt.Fprintln(w, "  Successors: (Exit)")
 		}
 	}
 }